@@ -17,6 +17,7 @@
 package v1
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -35,6 +36,7 @@ type Config struct {
 	Flags     Flags     `json:"flags,omitempty"     yaml:"flags,omitempty"`
 	Resources Resources `json:"resources,omitempty" yaml:"resources,omitempty"`
 	Sharing   Sharing   `json:"sharing,omitempty"   yaml:"sharing,omitempty"`
+	Health    Health    `json:"health,omitempty"    yaml:"health,omitempty"`
 }
 
 // NewConfig builds out a Config struct from a config file (or command line flags).
@@ -56,6 +58,33 @@ func NewConfig(c *cli.Context, flags []cli.Flag) (*Config, error) {
 	return config, nil
 }
 
+// EqualForResource checks whether two configs apply the same settings to the plugin for the named resource.
+// The flags and health settings apply to all resources, but only the sharing settings that apply to the
+// resource are compared. The resources of the configs are not compared, since these only determine which
+// devices are advertised under each name.
+func (c *Config) EqualForResource(o *Config, name ResourceName) bool {
+	if c == nil || o == nil {
+		return false
+	}
+	forResource := func(c *Config) ([]byte, error) {
+		return json.Marshal(struct {
+			Flags   Flags
+			Health  Health
+			Sharing *Sharing
+		}{
+			Flags:   c.Flags,
+			Health:  c.Health,
+			Sharing: c.Sharing.forResource(name),
+		})
+	}
+	cJSON, cErr := forResource(c)
+	oJSON, oErr := forResource(o)
+	if cErr != nil || oErr != nil {
+		return false
+	}
+	return string(cJSON) == string(oJSON)
+}
+
 // parseConfig parses a config file as either YAML of JSON and unmarshals it into a Config struct.
 func parseConfig(configFile string) (*Config, error) {
 	reader, err := os.Open(configFile)
@@ -97,3 +126,8 @@ func parseConfigFrom(reader io.Reader) (*Config, error) {
 
 	return &config, nil
 }
+
+// customizeSchema restricts the version of a Config to the supported version.
+func (Config) customizeSchema(s *jsonSchema) {
+	s.Properties["version"].Enum = []interface{}{Version}
+}
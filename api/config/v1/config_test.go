@@ -0,0 +1,120 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEqualForResource(t *testing.T) {
+	timeSlicing := `
+version: v1
+flags:
+  migStrategy: %s
+sharing:
+  timeSlicing:
+    failRequestsGreaterThanOne: %t
+    resources:
+    - name: nvidia.com/gpu
+      replicas: %d
+    - name: nvidia.com/mig-1g.5gb
+      rename: nvidia.com/mig-small
+      replicas: 2
+`
+	type settings struct {
+		migStrategy                string
+		failRequestsGreaterThanOne bool
+		gpuReplicas                int
+	}
+	testCases := []struct {
+		description string
+		running     settings
+		config      settings
+		resource    string
+		expected    bool
+	}{
+		{
+			description: "unchanged config is equal",
+			running:     settings{"none", false, 4},
+			config:      settings{"none", false, 4},
+			resource:    "nvidia.com/gpu",
+			expected:    true,
+		},
+		{
+			description: "changed replicas of the resource are not equal",
+			running:     settings{"none", false, 4},
+			config:      settings{"none", false, 8},
+			resource:    "nvidia.com/gpu",
+			expected:    false,
+		},
+		{
+			description: "changed replicas of another resource are equal",
+			running:     settings{"none", false, 4},
+			config:      settings{"none", false, 8},
+			resource:    "nvidia.com/mig-small",
+			expected:    true,
+		},
+		{
+			description: "changed replicas of another resource are equal for an unshared resource",
+			running:     settings{"none", false, 4},
+			config:      settings{"none", false, 8},
+			resource:    "nvidia.com/mig-2g.10gb",
+			expected:    true,
+		},
+		{
+			description: "changed sharing settings are not equal for a renamed resource",
+			running:     settings{"none", false, 4},
+			config:      settings{"none", true, 4},
+			resource:    "nvidia.com/mig-small",
+			expected:    false,
+		},
+		{
+			description: "changed sharing settings are equal for an unshared resource",
+			running:     settings{"none", false, 4},
+			config:      settings{"none", true, 4},
+			resource:    "nvidia.com/mig-2g.10gb",
+			expected:    true,
+		},
+		{
+			description: "changed flags are not equal for an unshared resource",
+			running:     settings{"none", false, 4},
+			config:      settings{"single", false, 4},
+			resource:    "nvidia.com/mig-2g.10gb",
+			expected:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			newConfig := func(s settings) *Config {
+				config, err := parseConfigFrom(strings.NewReader(
+					fmt.Sprintf(timeSlicing, s.migStrategy, s.failRequestsGreaterThanOne, s.gpuReplicas),
+				))
+				require.NoError(t, err)
+				return config
+			}
+			running := newConfig(tc.running)
+			config := newConfig(tc.config)
+
+			require.Equal(t, tc.expected, running.EqualForResource(config, NoErrorNewResourceName(tc.resource)))
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 const (
 	ResourceNamePrefix              = "nvidia.com"
 	DefaultSharedResourceNameSuffix = ".shared"
+	DefaultMemoryResourceNameSuffix = "mem"
 	MaxResourceNameLength           = 63
 )
 
@@ -39,6 +40,7 @@ const (
 	DeviceListStrategyEnvvar         = "envvar"
 	DeviceListStrategyVolumeMounts   = "volume-mounts"
 	DeviceListStrategyCDIAnnotations = "cdi-annotations"
+	DeviceListStrategyCDICRI         = "cdi-cri"
 )
 
 // Constants to represent the various device id strategies
@@ -47,6 +49,43 @@ const (
 	DeviceIDStrategyIndex = "index"
 )
 
+// Constants to represent the various sharing strategies
+const (
+	SharingStrategyNone        = "none"
+	SharingStrategyTimeSlicing = "time-slicing"
+	SharingStrategyMPS         = "mps"
+	SharingStrategyMemory      = "memory"
+)
+
+// Constants to represent the various allocation policies
+const (
+	AllocationPolicyBestEffort       = "best-effort"
+	AllocationPolicySimple           = "simple"
+	AllocationPolicyStaticDGX1Pascal = "static-dgx1-pascal"
+	AllocationPolicyStaticDGX1Volta  = "static-dgx1-volta"
+	AllocationPolicyPacking          = "packing"
+	AllocationPolicySpreading        = "spreading"
+)
+
+// Constants to represent the various policies for allocating replicas of time-sliced devices
+const (
+	ReplicaPolicyDistributed = "distributed"
+	ReplicaPolicyAligned     = "aligned"
+	ReplicaPolicyPacked      = "packed"
+)
+
+// Constants related to sharing devices with MPS
+const (
+	DefaultMPSRoot = "/run/nvidia/mps"
+)
+
+// Constants to represent the various health actions
+const (
+	HealthActionMarkUnhealthy  = "mark-unhealthy"
+	HealthActionLogOnly        = "log-only"
+	HealthActionCountThreshold = "count-threshold"
+)
+
 // Constants related to generating CDI specifications
 const (
 	DefaultCDIAnnotationPrefix = cdiapi.AnnotationPrefix
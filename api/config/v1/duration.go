@@ -51,3 +51,19 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 		return fmt.Errorf("invalid duration")
 	}
 }
+
+// Patterns matching the durations accepted by time.ParseDuration.
+const (
+	durationPattern            = `^[-+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+	nonNegativeDurationPattern = `^[+]?(0|(([0-9]+(\.[0-9]*)?|\.[0-9]+)(ns|us|µs|μs|ms|s|m|h))+)$`
+)
+
+// customizeSchema allows a Duration to be specified as a string or as a number of nanoseconds.
+func (Duration) customizeSchema(s *jsonSchema) {
+	*s = jsonSchema{
+		OneOf: []*jsonSchema{
+			{Type: "string", Pattern: durationPattern},
+			{Type: "number"},
+		},
+	}
+}
@@ -40,6 +40,8 @@ func updateFromCLIFlag[T any](pflag **T, c *cli.Context, flagName string) {
 			*flag = ptr(c.Bool(flagName))
 		case **Duration:
 			*flag = ptr(Duration(c.Duration(flagName)))
+		case **deviceListStrategyFlag:
+			*flag = ptr(deviceListStrategyFlag(c.StringSlice(flagName)))
 		}
 	}
 }
@@ -62,12 +64,18 @@ type CommandLineFlags struct {
 
 // PluginCommandLineFlags holds the list of command line flags specific to the device plugin.
 type PluginCommandLineFlags struct {
-	PassDeviceSpecs     *bool                   `json:"passDeviceSpecs"     yaml:"passDeviceSpecs"`
-	DeviceListStrategy  *deviceListStrategyFlag `json:"deviceListStrategy"  yaml:"deviceListStrategy"`
-	DeviceIDStrategy    *string                 `json:"deviceIDStrategy"    yaml:"deviceIDStrategy"`
-	CDIAnnotationPrefix *string                 `json:"cdiAnnotationPrefix" yaml:"cdiAnnotationPrefix"`
-	NvidiaCTKPath       *string                 `json:"nvidiaCTKPath"       yaml:"nvidiaCTKPath"`
-	ContainerDriverRoot *string                 `json:"containerDriverRoot" yaml:"containerDriverRoot"`
+	PassDeviceSpecs      *bool                   `json:"passDeviceSpecs"      yaml:"passDeviceSpecs"`
+	DeviceListStrategy   *deviceListStrategyFlag `json:"deviceListStrategy"   yaml:"deviceListStrategy"`
+	DeviceIDStrategy     *string                 `json:"deviceIDStrategy"     yaml:"deviceIDStrategy"`
+	CDIAnnotationPrefix  *string                 `json:"cdiAnnotationPrefix"  yaml:"cdiAnnotationPrefix"`
+	NvidiaCTKPath        *string                 `json:"nvidiaCTKPath"        yaml:"nvidiaCTKPath"`
+	ContainerDriverRoot  *string                 `json:"containerDriverRoot"  yaml:"containerDriverRoot"`
+	HealthRecoveryPeriod *Duration               `json:"healthRecoveryPeriod" yaml:"healthRecoveryPeriod"`
+	MPSRoot              *string                 `json:"mpsRoot"              yaml:"mpsRoot"`
+	AllocationPolicy     *string                 `json:"allocationPolicy"     yaml:"allocationPolicy"`
+	AffinityEnvvars      *bool                   `json:"affinityEnvvars"      yaml:"affinityEnvvars"`
+	PreStartChecks       *bool                   `json:"preStartChecks"       yaml:"preStartChecks"`
+	KubeletCDIDevices    *bool                   `json:"kubeletCDIDevices"    yaml:"kubeletCDIDevices"`
 }
 
 // deviceListStrategyFlag is a custom type for parsing the deviceListStrategy flag.
@@ -93,6 +101,16 @@ func (f *deviceListStrategyFlag) UnmarshalJSON(b []byte) error {
 	return fmt.Errorf("invalid deviceListStrategy: %v", string(b))
 }
 
+// customizeSchema allows the deviceListStrategy to be specified as a single string or a list of strings.
+func (deviceListStrategyFlag) customizeSchema(s *jsonSchema) {
+	*s = jsonSchema{
+		OneOf: []*jsonSchema{
+			{Type: "string"},
+			{Type: "array", Items: &jsonSchema{Type: "string"}},
+		},
+	}
+}
+
 // GFDCommandLineFlags holds the list of command line flags specific to GFD.
 type GFDCommandLineFlags struct {
 	Oneshot         *bool     `json:"oneshot"         yaml:"oneshot"`
@@ -136,6 +154,18 @@ func (f *Flags) UpdateFromCLIFlags(c *cli.Context, flags []cli.Flag) {
 				updateFromCLIFlag(&f.Plugin.NvidiaCTKPath, c, n)
 			case "container-driver-root":
 				updateFromCLIFlag(&f.Plugin.ContainerDriverRoot, c, n)
+			case "health-recovery-period":
+				updateFromCLIFlag(&f.Plugin.HealthRecoveryPeriod, c, n)
+			case "mps-root":
+				updateFromCLIFlag(&f.Plugin.MPSRoot, c, n)
+			case "allocation-policy":
+				updateFromCLIFlag(&f.Plugin.AllocationPolicy, c, n)
+			case "affinity-envvars":
+				updateFromCLIFlag(&f.Plugin.AffinityEnvvars, c, n)
+			case "pre-start-checks":
+				updateFromCLIFlag(&f.Plugin.PreStartChecks, c, n)
+			case "kubelet-cdi-devices":
+				updateFromCLIFlag(&f.Plugin.KubeletCDIDevices, c, n)
 			}
 			// GFD specific flags
 			if f.GFD == nil {
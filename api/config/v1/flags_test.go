@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	cli "github.com/urfave/cli/v2"
 )
 
 func TestUnmarshalFlags(t *testing.T) {
@@ -222,3 +223,57 @@ func TestMarshalFlags(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateFromCLIFlags(t *testing.T) {
+	testCases := []struct {
+		description                string
+		args                       []string
+		initial                    *deviceListStrategyFlag
+		expectedDeviceListStrategy deviceListStrategyFlag
+	}{
+		{
+			description:                "default",
+			args:                       []string{"app"},
+			expectedDeviceListStrategy: deviceListStrategyFlag{"envvar"},
+		},
+		{
+			description:                "set on command line",
+			args:                       []string{"app", "--device-list-strategy=envvar", "--device-list-strategy=cdi-annotations"},
+			expectedDeviceListStrategy: deviceListStrategyFlag{"envvar", "cdi-annotations"},
+		},
+		{
+			description:                "set in config file",
+			args:                       []string{"app"},
+			initial:                    &deviceListStrategyFlag{"volume-mounts"},
+			expectedDeviceListStrategy: deviceListStrategyFlag{"volume-mounts"},
+		},
+		{
+			description:                "command line overrides config file",
+			args:                       []string{"app", "--device-list-strategy=cdi-annotations"},
+			initial:                    &deviceListStrategyFlag{"volume-mounts"},
+			expectedDeviceListStrategy: deviceListStrategyFlag{"cdi-annotations"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			f := Flags{CommandLineFlags{Plugin: &PluginCommandLineFlags{DeviceListStrategy: tc.initial}}}
+
+			app := cli.NewApp()
+			app.Flags = []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "device-list-strategy",
+					Value: cli.NewStringSlice("envvar"),
+				},
+			}
+			app.Action = func(c *cli.Context) error {
+				f.UpdateFromCLIFlags(c, app.Flags)
+				return nil
+			}
+			require.NoError(t, app.Run(tc.args))
+
+			require.NotNil(t, f.Plugin.DeviceListStrategy)
+			require.Equal(t, tc.expectedDeviceListStrategy, *f.Plugin.DeviceListStrategy)
+		})
+	}
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// HealthAction defines the action to take when a health event is seen on a device.
+type HealthAction string
+
+// Health defines the policy applied to the health events reported for devices.
+// If IgnoredXids is not set, a default set of application-level Xids is ignored.
+type Health struct {
+	IgnoredXids []uint64    `json:"ignoredXids,omitempty" yaml:"ignoredXids,omitempty"`
+	FatalXids   []uint64    `json:"fatalXids,omitempty"   yaml:"fatalXids,omitempty"`
+	Xids        []XidPolicy `json:"xids,omitempty"        yaml:"xids,omitempty"`
+	ECC         ECCPolicy   `json:"ecc,omitempty"         yaml:"ecc,omitempty"`
+}
+
+// HealthPolicy pairs a HealthAction with the settings for that action.
+// Threshold and Window are only used by the count-threshold action. If no
+// Window is set, all events since the plugin was started are counted.
+type HealthPolicy struct {
+	Action    HealthAction `json:"action"              yaml:"action"`
+	Threshold int          `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	Window    *Duration    `json:"window,omitempty"    yaml:"window,omitempty"`
+}
+
+// XidPolicy defines the HealthPolicy to apply to a set of Xids.
+type XidPolicy struct {
+	Xids []uint64 `json:"xids" yaml:"xids"`
+	HealthPolicy
+}
+
+// ECCPolicy defines the HealthPolicy to apply to single- and double-bit ECC errors.
+type ECCPolicy struct {
+	SingleBit *HealthPolicy `json:"singleBit,omitempty" yaml:"singleBit,omitempty"`
+	DoubleBit *HealthPolicy `json:"doubleBit,omitempty" yaml:"doubleBit,omitempty"`
+}
+
+// UnmarshalJSON unmarshals raw bytes into a 'HealthPolicy' struct.
+func (p *HealthPolicy) UnmarshalJSON(b []byte) error {
+	hp := make(map[string]json.RawMessage)
+	err := json.Unmarshal(b, &hp)
+	if err != nil {
+		return err
+	}
+
+	action, exists := hp["action"]
+	if !exists {
+		return fmt.Errorf("no action specified")
+	}
+
+	err = json.Unmarshal(action, &p.Action)
+	if err != nil {
+		return err
+	}
+
+	switch p.Action {
+	case HealthActionMarkUnhealthy, HealthActionLogOnly:
+		return nil
+	case HealthActionCountThreshold:
+	default:
+		return fmt.Errorf("unknown action: %v", p.Action)
+	}
+
+	threshold, exists := hp["threshold"]
+	if !exists {
+		return fmt.Errorf("no threshold specified for action %v", p.Action)
+	}
+
+	err = json.Unmarshal(threshold, &p.Threshold)
+	if err != nil {
+		return err
+	}
+
+	if p.Threshold < 1 {
+		return fmt.Errorf("threshold must be >= 1")
+	}
+
+	window, exists := hp["window"]
+	if !exists {
+		return nil
+	}
+
+	err = json.Unmarshal(window, &p.Window)
+	if err != nil {
+		return err
+	}
+
+	if p.Window != nil && *p.Window < 0 {
+		return fmt.Errorf("window must not be negative")
+	}
+
+	return nil
+}
+
+// UnmarshalJSON unmarshals raw bytes into an 'XidPolicy' struct.
+// Since HealthPolicy implements json.Unmarshaler, the embedded fields need to
+// be unmarshalled explicitly.
+func (p *XidPolicy) UnmarshalJSON(b []byte) error {
+	xp := make(map[string]json.RawMessage)
+	err := json.Unmarshal(b, &xp)
+	if err != nil {
+		return err
+	}
+
+	xids, exists := xp["xids"]
+	if !exists {
+		return fmt.Errorf("no xids specified")
+	}
+
+	err = json.Unmarshal(xids, &p.Xids)
+	if err != nil {
+		return err
+	}
+
+	if len(p.Xids) == 0 {
+		return fmt.Errorf("no xids specified")
+	}
+
+	return json.Unmarshal(b, &p.HealthPolicy)
+}
+
+// customizeSchema requires an action for a HealthPolicy. The threshold and
+// window are only checked if the action is count-threshold.
+func (HealthPolicy) customizeSchema(s *jsonSchema) {
+	*s = jsonSchema{
+		Type:     "object",
+		Required: []string{"action"},
+		Properties: map[string]*jsonSchema{
+			"action": {
+				Type: "string",
+				Enum: []interface{}{HealthActionMarkUnhealthy, HealthActionLogOnly, HealthActionCountThreshold},
+			},
+		},
+		If: &jsonSchema{
+			Properties: map[string]*jsonSchema{
+				"action": {Const: HealthActionCountThreshold},
+			},
+		},
+		Then: &jsonSchema{
+			Required: []string{"threshold"},
+			Properties: map[string]*jsonSchema{
+				"threshold": {Type: "integer", Minimum: ptr(1)},
+				"window": {
+					OneOf: []*jsonSchema{
+						{Type: "string", Pattern: nonNegativeDurationPattern},
+						{Type: "number", Minimum: ptr(0)},
+					},
+				},
+			},
+		},
+	}
+}
+
+// customizeSchema requires a non-empty list of xids for an XidPolicy.
+func (XidPolicy) customizeSchema(s *jsonSchema) {
+	s.Required = []string{"xids"}
+	s.Properties["xids"].MinItems = ptr(1)
+}
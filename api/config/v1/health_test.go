@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalHealth(t *testing.T) {
+	testCases := []struct {
+		input  string
+		output Health
+		err    bool
+	}{
+		{
+			input:  `{}`,
+			output: Health{},
+		},
+		{
+			input: `{
+				"ignoredXids": [13, 31],
+				"fatalXids": [79]
+			}`,
+			output: Health{
+				IgnoredXids: []uint64{13, 31},
+				FatalXids:   []uint64{79},
+			},
+		},
+		{
+			input: `{
+				"ignoredXids": []
+			}`,
+			output: Health{
+				IgnoredXids: []uint64{},
+			},
+		},
+		{
+			input: `{
+				"xids": [{
+					"xids": [48],
+					"action": "log-only"
+				}]
+			}`,
+			output: Health{
+				Xids: []XidPolicy{
+					{
+						Xids:         []uint64{48},
+						HealthPolicy: HealthPolicy{Action: "log-only"},
+					},
+				},
+			},
+		},
+		{
+			input: `{
+				"xids": [{
+					"xids": [63, 64],
+					"action": "count-threshold",
+					"threshold": 3,
+					"window": "1h"
+				}]
+			}`,
+			output: Health{
+				Xids: []XidPolicy{
+					{
+						Xids: []uint64{63, 64},
+						HealthPolicy: HealthPolicy{
+							Action:    "count-threshold",
+							Threshold: 3,
+							Window:    ptr(Duration(time.Hour)),
+						},
+					},
+				},
+			},
+		},
+		{
+			input: `{
+				"xids": [{
+					"action": "log-only"
+				}]
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"xids": [{
+					"xids": [],
+					"action": "log-only"
+				}]
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"xids": [{
+					"xids": [48]
+				}]
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"xids": [{
+					"xids": [48],
+					"action": "unknown"
+				}]
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"xids": [{
+					"xids": [48],
+					"action": "count-threshold"
+				}]
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"xids": [{
+					"xids": [48],
+					"action": "count-threshold",
+					"threshold": 0
+				}]
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"ecc": {
+					"doubleBit": {
+						"action": "mark-unhealthy"
+					},
+					"singleBit": {
+						"action": "count-threshold",
+						"threshold": 10,
+						"window": "24h"
+					}
+				}
+			}`,
+			output: Health{
+				ECC: ECCPolicy{
+					DoubleBit: &HealthPolicy{Action: "mark-unhealthy"},
+					SingleBit: &HealthPolicy{
+						Action:    "count-threshold",
+						Threshold: 10,
+						Window:    ptr(Duration(24 * time.Hour)),
+					},
+				},
+			},
+		},
+		{
+			input: `{
+				"ecc": {
+					"singleBit": {
+						"action": "count-threshold",
+						"threshold": 10,
+						"window": "-1h"
+					}
+				}
+			}`,
+			err: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", i), func(t *testing.T) {
+			var output Health
+			err := json.Unmarshal([]byte(tc.input), &output)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.output, output)
+		})
+	}
+}
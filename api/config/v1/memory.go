@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Memory defines the set of resources whose devices are advertised in units of device memory.
+// By default, devices are shared using MPS and the memory limit of a container is enforced by MPS.
+type Memory struct {
+	Envvar    string           `json:"envvar,omitempty"    yaml:"envvar,omitempty"`
+	Resources []MemoryResource `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+// MemoryResource represents a resource whose devices are advertised in units of device memory.
+type MemoryResource struct {
+	Name    ResourceName      `json:"name"             yaml:"name"`
+	Rename  ResourceName      `json:"rename,omitempty" yaml:"rename,omitempty"`
+	Devices ReplicatedDevices `json:"devices"          yaml:"devices,flow"`
+}
+
+// UsesMPS returns whether the memory limit of a container is enforced by MPS.
+// This is the case unless a custom environment variable is set to the limit instead.
+func (m *Memory) UsesMPS() bool {
+	return m.Envvar == ""
+}
+
+// UnmarshalJSON unmarshals raw bytes into a 'Memory' struct.
+func (m *Memory) UnmarshalJSON(b []byte) error {
+	mem := make(map[string]json.RawMessage)
+	err := json.Unmarshal(b, &mem)
+	if err != nil {
+		return err
+	}
+
+	envvar, exists := mem["envvar"]
+	if exists {
+		err = json.Unmarshal(envvar, &m.Envvar)
+		if err != nil {
+			return err
+		}
+	}
+
+	resources, exists := mem["resources"]
+	if !exists {
+		return fmt.Errorf("no resources specified")
+	}
+
+	err = json.Unmarshal(resources, &m.Resources)
+	if err != nil {
+		return err
+	}
+
+	if len(m.Resources) == 0 {
+		return fmt.Errorf("no resources specified")
+	}
+
+	return nil
+}
+
+// UnmarshalJSON unmarshals raw bytes into a 'MemoryResource' struct.
+// If no rename is specified, the resource is renamed to '<resource-name>mem' (e.g. nvidia.com/gpumem).
+func (r *MemoryResource) UnmarshalJSON(b []byte) error {
+	mr := make(map[string]json.RawMessage)
+	err := json.Unmarshal(b, &mr)
+	if err != nil {
+		return err
+	}
+
+	name, exists := mr["name"]
+	if !exists {
+		return fmt.Errorf("no resource name specified")
+	}
+
+	err = json.Unmarshal(name, &r.Name)
+	if err != nil {
+		return err
+	}
+
+	devices, exists := mr["devices"]
+	if !exists {
+		devices = []byte(`"all"`)
+	}
+
+	err = json.Unmarshal(devices, &r.Devices)
+	if err != nil {
+		return err
+	}
+
+	rename, exists := mr["rename"]
+	if exists {
+		return json.Unmarshal(rename, &r.Rename)
+	}
+
+	r.Rename, err = NewResourceName(string(r.Name) + DefaultMemoryResourceNameSuffix)
+	if err != nil {
+		return fmt.Errorf("unable to rename '%v' by default: %v", r.Name, err)
+	}
+
+	return nil
+}
+
+// customizeSchema requires a non-empty list of resources for Memory.
+func (Memory) customizeSchema(s *jsonSchema) {
+	s.Required = []string{"resources"}
+	s.Properties["resources"].MinItems = ptr(1)
+}
+
+// customizeSchema requires a name for a MemoryResource.
+func (MemoryResource) customizeSchema(s *jsonSchema) {
+	s.Required = []string{"name"}
+}
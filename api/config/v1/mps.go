@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MPS defines the set of replicas to be shared using the CUDA Multi-Process Service (MPS).
+// Each replica is given an equal share of the compute and memory of the underlying device.
+type MPS struct {
+	RenameByDefault bool                 `json:"renameByDefault,omitempty" yaml:"renameByDefault,omitempty"`
+	Resources       []ReplicatedResource `json:"resources,omitempty"       yaml:"resources,omitempty"`
+}
+
+// UnmarshalJSON unmarshals raw bytes into an 'MPS' struct.
+func (s *MPS) UnmarshalJSON(b []byte) error {
+	mps := make(map[string]json.RawMessage)
+	err := json.Unmarshal(b, &mps)
+	if err != nil {
+		return err
+	}
+
+	renameByDefault, exists := mps["renameByDefault"]
+	if !exists {
+		renameByDefault = []byte(`false`)
+	}
+
+	err = json.Unmarshal(renameByDefault, &s.RenameByDefault)
+	if err != nil {
+		return err
+	}
+
+	s.Resources, err = unmarshalReplicatedResources(mps, s.RenameByDefault)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range s.Resources {
+		for _, ref := range r.Devices.List {
+			if ref.IsMigIndex() || ref.IsMigUUID() {
+				return fmt.Errorf("MPS sharing is not supported for MIG devices: %v", ref)
+			}
+		}
+	}
+
+	return nil
+}
+
+// customizeSchema requires a non-empty list of resources for MPS,
+// none of which can list MIG devices.
+func (MPS) customizeSchema(s *jsonSchema) {
+	s.Required = []string{"resources"}
+	s.Properties["resources"].MinItems = ptr(1)
+	s.Properties["resources"].Items = &jsonSchema{
+		AllOf: []*jsonSchema{
+			s.Properties["resources"].Items,
+			{
+				Properties: map[string]*jsonSchema{
+					"devices": {
+						Not: &jsonSchema{
+							Type:     "array",
+							Contains: &jsonSchema{Type: "string", Pattern: "^(" + migIndexPattern + "|" + migUUIDPattern + ")$"},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -29,6 +29,7 @@ import (
 type TimeSlicing struct {
 	RenameByDefault            bool                 `json:"renameByDefault,omitempty"            yaml:"renameByDefault,omitempty"`
 	FailRequestsGreaterThanOne bool                 `json:"failRequestsGreaterThanOne,omitempty" yaml:"failRequestsGreaterThanOne,omitempty"`
+	ReplicaPolicy              string               `json:"replicaPolicy,omitempty"              yaml:"replicaPolicy,omitempty"`
 	Resources                  []ReplicatedResource `json:"resources,omitempty"                  yaml:"resources,omitempty"`
 }
 
@@ -51,6 +52,15 @@ type ReplicatedDevices struct {
 // ReplicatedDeviceRef can either be a full GPU index, a MIG index, or a UUID (full GPU or MIG)
 type ReplicatedDeviceRef string
 
+// Patterns matching the forms of a ReplicatedDeviceRef in the JSON Schema of a Config.
+const (
+	uuidPattern     = "[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}"
+	gpuIndexPattern = "[0-9]+"
+	migIndexPattern = "[0-9]+:[0-9]+"
+	gpuUUIDPattern  = "GPU-" + uuidPattern
+	migUUIDPattern  = "MIG-(" + uuidPattern + "|GPU-" + uuidPattern + "/[0-9]+/[0-9]+)"
+)
+
 // IsGPUIndex checks if a ReplicatedDeviceRef is a full GPU index
 func (d ReplicatedDeviceRef) IsGPUIndex() bool {
 	if _, err := strconv.ParseUint(string(d), 10, 0); err != nil {
@@ -145,27 +155,62 @@ func (s *TimeSlicing) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
-	resources, exists := ts["resources"]
-	if !exists {
-		return fmt.Errorf("no resources specified")
+	if replicaPolicy, exists := ts["replicaPolicy"]; exists {
+		err = json.Unmarshal(replicaPolicy, &s.ReplicaPolicy)
+		if err != nil {
+			return err
+		}
+		switch s.ReplicaPolicy {
+		case ReplicaPolicyDistributed, ReplicaPolicyAligned, ReplicaPolicyPacked:
+		default:
+			return fmt.Errorf("unknown replica policy: %v", s.ReplicaPolicy)
+		}
 	}
 
-	err = json.Unmarshal(resources, &s.Resources)
+	s.Resources, err = unmarshalReplicatedResources(ts, s.RenameByDefault)
 	if err != nil {
 		return err
 	}
 
-	if len(s.Resources) == 0 {
-		return fmt.Errorf("no resources specified")
+	return nil
+}
+
+// customizeSchema requires a non-empty list of resources for TimeSlicing.
+func (TimeSlicing) customizeSchema(s *jsonSchema) {
+	s.Required = []string{"resources"}
+	s.Properties["resources"].MinItems = ptr(1)
+	s.Properties["replicaPolicy"].Enum = []interface{}{ReplicaPolicyDistributed, ReplicaPolicyAligned, ReplicaPolicyPacked}
+}
+
+// unmarshalReplicatedResources unmarshals the 'resources' of a sharing strategy,
+// renaming each resource to its default shared name if requested.
+func unmarshalReplicatedResources(raw map[string]json.RawMessage, renameByDefault bool) ([]ReplicatedResource, error) {
+	resources, exists := raw["resources"]
+	if !exists {
+		return nil, fmt.Errorf("no resources specified")
+	}
+
+	var replicatedResources []ReplicatedResource
+	err := json.Unmarshal(resources, &replicatedResources)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(replicatedResources) == 0 {
+		return nil, fmt.Errorf("no resources specified")
 	}
 
-	for i, r := range s.Resources {
-		if s.RenameByDefault && r.Rename == "" {
-			s.Resources[i].Rename = r.Name.DefaultSharedRename()
+	for i, r := range replicatedResources {
+		if renameByDefault && r.Rename == "" {
+			rename, err := NewResourceName(string(r.Name.DefaultSharedRename()))
+			if err != nil {
+				return nil, fmt.Errorf("unable to rename '%v' by default: %v", r.Name, err)
+			}
+			replicatedResources[i].Rename = rename
 		}
 	}
 
-	return nil
+	return replicatedResources, nil
 }
 
 // UnmarshalJSON unmarshals raw bytes into a 'ReplicatedResource' struct.
@@ -223,6 +268,12 @@ func (s *ReplicatedResource) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// customizeSchema requires a name and at least 2 replicas for a ReplicatedResource.
+func (ReplicatedResource) customizeSchema(s *jsonSchema) {
+	s.Required = []string{"name", "replicas"}
+	s.Properties["replicas"].Minimum = ptr(2)
+}
+
 // UnmarshalJSON unmarshals raw bytes into a 'ReplicatedDevices' struct.
 func (s *ReplicatedDevices) UnmarshalJSON(b []byte) error {
 	// Match the string 'all'
@@ -280,6 +331,26 @@ func (s *ReplicatedDevices) UnmarshalJSON(b []byte) error {
 	return fmt.Errorf("unrecognized type for devices spec: %v", string(b))
 }
 
+// customizeSchema allows ReplicatedDevices to be specified as 'all', a count of
+// devices, or a list of GPU indices, MIG indices, and UUIDs.
+func (ReplicatedDevices) customizeSchema(s *jsonSchema) {
+	*s = jsonSchema{
+		OneOf: []*jsonSchema{
+			{Const: "all"},
+			{Type: "integer", Minimum: ptr(1)},
+			{
+				Type: "array",
+				Items: &jsonSchema{
+					OneOf: []*jsonSchema{
+						{Type: "integer", Minimum: ptr(0)},
+						{Type: "string", Pattern: "^(" + gpuIndexPattern + "|" + migIndexPattern + "|" + gpuUUIDPattern + "|" + migUUIDPattern + ")$"},
+					},
+				},
+			},
+		},
+	}
+}
+
 // MarshalJSON marshals ReplicatedDevices to its raw bytes representation
 func (s *ReplicatedDevices) MarshalJSON() ([]byte, error) {
 	if s.All == true {
@@ -449,6 +449,40 @@ func TestUnmarshalTimeSlicing(t *testing.T) {
 			}`,
 			err: true,
 		},
+		{
+			input: `{
+				"renameByDefault": true,
+				"resources": [
+					{
+						"name": "valid",
+						"replicas": 2
+					}
+				]
+			}`,
+			output: TimeSlicing{
+				RenameByDefault: true,
+				Resources: []ReplicatedResource{
+					{
+						Name:     NoErrorNewResourceName("valid"),
+						Rename:   NoErrorNewResourceName("valid.shared"),
+						Devices:  ReplicatedDevices{All: true},
+						Replicas: 2,
+					},
+				},
+			},
+		},
+		{
+			input: `{
+				"renameByDefault": true,
+				"resources": [
+					{
+						"name": "gpu-with-a-resource-name-that-is-too-long-to-share",
+						"replicas": 2
+					}
+				]
+			}`,
+			err: true,
+		},
 	}
 
 	for i, tc := range testCases {
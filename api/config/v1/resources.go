@@ -123,6 +123,63 @@ func (r *Resource) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// customizeSchema requires a pattern and a name for a Resource.
+func (Resource) customizeSchema(s *jsonSchema) {
+	s.Required = []string{"pattern", "name"}
+}
+
+// UnmarshalJSON unmarshals raw bytes into a 'Resources' struct.
+func (r *Resources) UnmarshalJSON(b []byte) error {
+	res := make(map[string]json.RawMessage)
+	err := json.Unmarshal(b, &res)
+	if err != nil {
+		return err
+	}
+
+	if gpus, exists := res["gpus"]; exists {
+		err = json.Unmarshal(gpus, &r.GPUs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if migs, exists := res["mig"]; exists {
+		err = json.Unmarshal(migs, &r.MIGs)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = assertNoShadowedPatterns(r.GPUs)
+	if err != nil {
+		return fmt.Errorf("invalid 'gpus' resources: %v", err)
+	}
+
+	err = assertNoShadowedPatterns(r.MIGs)
+	if err != nil {
+		return fmt.Errorf("invalid 'mig' resources: %v", err)
+	}
+
+	return nil
+}
+
+// assertNoShadowedPatterns checks that every pattern in a list of resources can match a device.
+// Since devices are assigned to the first resource with a matching pattern, a
+// pattern is never used if an earlier pattern matches everything that it does.
+func assertNoShadowedPatterns(resources []Resource) error {
+	for i, r := range resources {
+		for _, earlier := range resources[:i] {
+			// Matching the literal text of a pattern (with '*' included) against
+			// an earlier pattern can only succeed if the earlier pattern matches
+			// every string that the pattern itself matches.
+			if earlier.Pattern.Matches(string(r.Pattern)) {
+				return fmt.Errorf("pattern '%v' for resource '%v' is shadowed by pattern '%v' for resource '%v'", r.Pattern, r.Name, earlier.Pattern, earlier.Name)
+			}
+		}
+	}
+	return nil
+}
+
 // UnmarshalJSON unmarshals raw bytes into a 'ResourceName' type.
 func (r *ResourceName) UnmarshalJSON(b []byte) error {
 	var raw string
@@ -139,6 +196,20 @@ func (r *ResourceName) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// customizeSchema restricts a ResourceName to the names accepted by NewResourceName.
+// The 'nvidia.com/' prefix is optional, but counts towards the maximum length.
+func (ResourceName) customizeSchema(s *jsonSchema) {
+	dnsSubdomain := "[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*"
+	prefix := strings.ReplaceAll(ResourceNamePrefix, ".", "\\.") + "/"
+	*s = jsonSchema{
+		Type: "string",
+		AnyOf: []*jsonSchema{
+			{Pattern: "^" + prefix + dnsSubdomain + "$", MaxLength: ptr(MaxResourceNameLength)},
+			{Pattern: "^" + dnsSubdomain + "$", MaxLength: ptr(MaxResourceNameLength - len(ResourceNamePrefix+"/"))},
+		},
+	}
+}
+
 // AddGPUResource adds a GPU resource to the list of GPU resources.
 func (r *Resources) AddGPUResource(pattern, name string) error {
 	resource, err := NewResource(pattern, name)
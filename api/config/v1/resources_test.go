@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2022, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalResources(t *testing.T) {
+	testCases := []struct {
+		input  string
+		output Resources
+		err    bool
+	}{
+		{
+			input:  `{}`,
+			output: Resources{},
+		},
+		{
+			input: `{
+				"gpus": [
+					{"pattern": "*A100*", "name": "a100"},
+					{"pattern": "*T4*", "name": "t4"}
+				]
+			}`,
+			output: Resources{
+				GPUs: []Resource{
+					{Pattern: "*A100*", Name: "nvidia.com/a100"},
+					{Pattern: "*T4*", Name: "nvidia.com/t4"},
+				},
+			},
+		},
+		{
+			input: `{
+				"gpus": [
+					{"pattern": "*A100-SXM4-80GB*", "name": "a100-80gb"},
+					{"pattern": "*A100*", "name": "a100"}
+				],
+				"mig": [
+					{"pattern": "1g.10gb", "name": "mig-small"},
+					{"pattern": "*", "name": "mig-other"}
+				]
+			}`,
+			output: Resources{
+				GPUs: []Resource{
+					{Pattern: "*A100-SXM4-80GB*", Name: "nvidia.com/a100-80gb"},
+					{Pattern: "*A100*", Name: "nvidia.com/a100"},
+				},
+				MIGs: []Resource{
+					{Pattern: "1g.10gb", Name: "nvidia.com/mig-small"},
+					{Pattern: "*", Name: "nvidia.com/mig-other"},
+				},
+			},
+		},
+		{
+			// A more general pattern before a more specific one
+			input: `{
+				"gpus": [
+					{"pattern": "*A100*", "name": "a100"},
+					{"pattern": "*A100-SXM4-80GB*", "name": "a100-80gb"}
+				]
+			}`,
+			err: true,
+		},
+		{
+			// A wildcard before any other pattern
+			input: `{
+				"mig": [
+					{"pattern": "*", "name": "mig-any"},
+					{"pattern": "1g.10gb", "name": "mig-small"}
+				]
+			}`,
+			err: true,
+		},
+		{
+			// The same pattern is used twice
+			input: `{
+				"gpus": [
+					{"pattern": "Tesla T4", "name": "t4"},
+					{"pattern": "Tesla T4", "name": "tesla-t4"}
+				]
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"gpus": [
+					{"pattern": "*", "name": "$invalid$"}
+				]
+			}`,
+			err: true,
+		},
+		{
+			input: fmt.Sprintf(`{
+				"gpus": [
+					{"pattern": "*", "name": "%s"}
+				]
+			}`, strings.Repeat("a", MaxResourceNameLength)),
+			err: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", i), func(t *testing.T) {
+			var output Resources
+			err := output.UnmarshalJSON([]byte(tc.input))
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.output, output)
+		})
+	}
+}
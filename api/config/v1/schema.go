@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+//go:generate go run schema_gen.go
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// SchemaFile is the name of the file holding the JSON Schema generated for the Config struct.
+const SchemaFile = "config.schema.json"
+
+// jsonSchema holds the subset of the JSON Schema (draft-07) keywords used to describe a Config.
+type jsonSchema struct {
+	Schema      string                 `json:"$schema,omitempty"`
+	Title       string                 `json:"title,omitempty"`
+	Ref         string                 `json:"$ref,omitempty"`
+	Type        string                 `json:"type,omitempty"`
+	Enum        []interface{}          `json:"enum,omitempty"`
+	Const       interface{}            `json:"const,omitempty"`
+	Pattern     string                 `json:"pattern,omitempty"`
+	MaxLength   *int                   `json:"maxLength,omitempty"`
+	Minimum     *int                   `json:"minimum,omitempty"`
+	Items       *jsonSchema            `json:"items,omitempty"`
+	MinItems    *int                   `json:"minItems,omitempty"`
+	Contains    *jsonSchema            `json:"contains,omitempty"`
+	Properties  map[string]*jsonSchema `json:"properties,omitempty"`
+	Required    []string               `json:"required,omitempty"`
+	AllOf       []*jsonSchema          `json:"allOf,omitempty"`
+	AnyOf       []*jsonSchema          `json:"anyOf,omitempty"`
+	OneOf       []*jsonSchema          `json:"oneOf,omitempty"`
+	Not         *jsonSchema            `json:"not,omitempty"`
+	If          *jsonSchema            `json:"if,omitempty"`
+	Then        *jsonSchema            `json:"then,omitempty"`
+	Definitions map[string]*jsonSchema `json:"definitions,omitempty"`
+}
+
+// schemaCustomizer is implemented by types whose custom unmarshaling accepts
+// values (or imposes constraints) that cannot be derived from their fields.
+// The schema passed in is the one generated from the type itself.
+type schemaCustomizer interface {
+	customizeSchema(s *jsonSchema)
+}
+
+// Schema returns the JSON Schema describing the config files accepted by the plugin.
+// The schema mirrors the custom unmarshaling of the Config struct, with the exception
+// of checks that span multiple fields (e.g. shadowed resource patterns).
+func Schema() ([]byte, error) {
+	g := &schemaGenerator{definitions: make(map[string]*jsonSchema)}
+	g.schemaFor(reflect.TypeOf(Config{}))
+
+	name := definitionName(reflect.TypeOf(Config{}))
+	root := g.definitions[name]
+	delete(g.definitions, name)
+
+	root.Schema = "http://json-schema.org/draft-07/schema#"
+	root.Title = "NVIDIA device plugin config (" + Version + ")"
+	root.Definitions = g.definitions
+
+	return json.MarshalIndent(root, "", "  ")
+}
+
+// schemaGenerator generates the schema for a type from its fields and json tags.
+// Structs and types implementing schemaCustomizer are added as definitions.
+type schemaGenerator struct {
+	definitions map[string]*jsonSchema
+}
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) *jsonSchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	customizer, isCustomized := reflect.Zero(t).Interface().(schemaCustomizer)
+	if t.Kind() != reflect.Struct && !isCustomized {
+		return g.baseSchemaFor(t)
+	}
+
+	name := definitionName(t)
+	if _, exists := g.definitions[name]; !exists {
+		// Reserve the definition before generating it to handle recursive types.
+		g.definitions[name] = nil
+		s := g.baseSchemaFor(t)
+		if isCustomized {
+			customizer.customizeSchema(s)
+		}
+		g.definitions[name] = s
+	}
+	return schemaRef(name)
+}
+
+func (g *schemaGenerator) baseSchemaFor(t reflect.Type) *jsonSchema {
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: "boolean"}
+	case reflect.String:
+		return &jsonSchema{Type: "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &jsonSchema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &jsonSchema{Type: "integer", Minimum: ptr(0)}
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &jsonSchema{Type: "array", Items: g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		return g.structSchemaFor(t)
+	}
+	return &jsonSchema{}
+}
+
+// structSchemaFor generates the schema for the exported fields of a struct.
+// The fields of embedded structs are included through an 'allOf' clause.
+func (g *schemaGenerator) structSchemaFor(t reflect.Type) *jsonSchema {
+	s := &jsonSchema{Type: "object"}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			s.AllOf = append(s.AllOf, g.schemaFor(field.Type))
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if s.Properties == nil {
+			s.Properties = make(map[string]*jsonSchema)
+		}
+		s.Properties[name] = g.schemaFor(field.Type)
+	}
+	return s
+}
+
+func definitionName(t reflect.Type) string {
+	return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+}
+
+func schemaRef(name string) *jsonSchema {
+	return &jsonSchema{Ref: "#/definitions/" + name}
+}
@@ -0,0 +1,40 @@
+//go:build ignore
+
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// This program generates the JSON Schema for the Config struct.
+// It is invoked by running 'go generate'.
+package main
+
+import (
+	"log"
+	"os"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+)
+
+func main() {
+	schema, err := spec.Schema()
+	if err != nil {
+		log.Fatalf("Failed to generate schema: %v", err)
+	}
+
+	err = os.WriteFile(spec.SchemaFile, append(schema, '\n'), 0644)
+	if err != nil {
+		log.Fatalf("Failed to write %v: %v", spec.SchemaFile, err)
+	}
+}
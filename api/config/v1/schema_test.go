@@ -0,0 +1,409 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/require"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestSchemaFileIsUpToDate(t *testing.T) {
+	schema, err := Schema()
+	require.NoError(t, err)
+
+	contents, err := os.ReadFile(SchemaFile)
+	require.NoError(t, err)
+	require.Equal(t, string(schema)+"\n", string(contents), "%v is out of date; run 'go generate' to update it", SchemaFile)
+}
+
+// TestSchemaMatchesUnmarshal checks that the configs accepted by a JSON Schema draft-07 validator are
+// those that can be parsed by the plugin. The validator matches patterns with Go's RE2 engine rather than
+// an ECMA-262 engine, which is covered by TestSchemaPatternsArePortable.
+func TestSchemaMatchesUnmarshal(t *testing.T) {
+	testCases := []struct {
+		description string
+		config      string
+	}{
+		{
+			description: "minimal config",
+			config:      `version: v1`,
+		},
+		{
+			description: "unknown version",
+			config:      `version: v2`,
+		},
+		{
+			description: "flags",
+			config: `
+version: v1
+flags:
+  migStrategy: mixed
+  failOnInitError: false
+  plugin:
+    deviceListStrategy: envvar
+    healthRecoveryPeriod: 5m30s
+  gfd:
+    sleepInterval: 60000000000
+`,
+		},
+		{
+			description: "device list strategy as list",
+			config: `
+flags:
+  plugin:
+    deviceListStrategy: [envvar, cdi-annotations]
+`,
+		},
+		{
+			description: "device list strategy as number",
+			config: `
+flags:
+  plugin:
+    deviceListStrategy: 1
+`,
+		},
+		{
+			description: "invalid duration",
+			config: `
+flags:
+  plugin:
+    healthRecoveryPeriod: 5 minutes
+`,
+		},
+		{
+			description: "resources",
+			config: `
+resources:
+  gpus:
+  - pattern: "*A100*"
+    name: a100
+  mig:
+  - pattern: "1g.5gb"
+    name: nvidia.com/mig-small
+`,
+		},
+		{
+			description: "resource without a pattern",
+			config: `
+resources:
+  gpus:
+  - name: a100
+`,
+		},
+		{
+			description: "invalid resource name",
+			config: `
+resources:
+  gpus:
+  - pattern: "*"
+    name: Big_GPU
+`,
+		},
+		{
+			description: "resource name too long",
+			config: `
+resources:
+  gpus:
+  - pattern: "*"
+    name: a-resource-name-that-is-just-a-little-bit-too-long-for-k8s
+`,
+		},
+		{
+			description: "time-slicing",
+			config: `
+sharing:
+  timeSlicing:
+    renameByDefault: true
+    replicaPolicy: packed
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 4
+    - name: mig-1g.5gb
+      devices: 2
+      replicas: 2
+    - name: mig-2g.10gb
+      devices: [0, "1", "1:0", "GPU-4cf8db2d-06c0-7d70-1a51-e59b25b2c16c", "MIG-GPU-662077db-fa3f-0d8f-9502-21ab0ef058a2/10/0"]
+      replicas: 2
+`,
+		},
+		{
+			description: "time-slicing without resources",
+			config: `
+sharing:
+  timeSlicing:
+    renameByDefault: true
+`,
+		},
+		{
+			description: "time-slicing with unknown replica policy",
+			config: `
+sharing:
+  timeSlicing:
+    replicaPolicy: random
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 4
+`,
+		},
+		{
+			description: "single replica",
+			config: `
+sharing:
+  timeSlicing:
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 1
+`,
+		},
+		{
+			description: "no replicas",
+			config: `
+sharing:
+  timeSlicing:
+    resources:
+    - name: nvidia.com/gpu
+`,
+		},
+		{
+			description: "devices as invalid string",
+			config: `
+sharing:
+  timeSlicing:
+    resources:
+    - name: nvidia.com/gpu
+      devices: some
+      replicas: 2
+`,
+		},
+		{
+			description: "devices as zero count",
+			config: `
+sharing:
+  timeSlicing:
+    resources:
+    - name: nvidia.com/gpu
+      devices: 0
+      replicas: 2
+`,
+		},
+		{
+			description: "devices with invalid entry",
+			config: `
+sharing:
+  timeSlicing:
+    resources:
+    - name: nvidia.com/gpu
+      devices: ["GPU-0"]
+      replicas: 2
+`,
+		},
+		{
+			description: "mps",
+			config: `
+sharing:
+  mps:
+    resources:
+    - name: nvidia.com/gpu
+      devices: ["0", "GPU-4cf8db2d-06c0-7d70-1a51-e59b25b2c16c"]
+      replicas: 2
+`,
+		},
+		{
+			description: "mps with MIG devices",
+			config: `
+sharing:
+  mps:
+    resources:
+    - name: nvidia.com/gpu
+      devices: ["0:1"]
+      replicas: 2
+`,
+		},
+		{
+			description: "memory",
+			config: `
+sharing:
+  memory:
+    envvar: CUDA_MEM_LIMIT
+    resources:
+    - name: nvidia.com/gpu
+      rename: gpu-memory
+`,
+		},
+		{
+			description: "memory with empty resources",
+			config: `
+sharing:
+  memory:
+    resources: []
+`,
+		},
+		{
+			description: "multiple sharing strategies",
+			config: `
+sharing:
+  timeSlicing:
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 2
+  mps:
+    resources:
+    - name: nvidia.com/gpu
+      replicas: 2
+`,
+		},
+		{
+			description: "health",
+			config: `
+health:
+  ignoredXids: [13, 31]
+  xids:
+  - xids: [79]
+    action: count-threshold
+    threshold: 3
+    window: 10m
+  - xids: [48]
+    action: log-only
+    threshold: many
+  ecc:
+    doubleBit:
+      action: mark-unhealthy
+`,
+		},
+		{
+			description: "health policy without an action",
+			config: `
+health:
+  ecc:
+    singleBit:
+      threshold: 10
+`,
+		},
+		{
+			description: "count-threshold without a threshold",
+			config: `
+health:
+  ecc:
+    singleBit:
+      action: count-threshold
+`,
+		},
+		{
+			description: "count-threshold with a negative window",
+			config: `
+health:
+  ecc:
+    singleBit:
+      action: count-threshold
+      threshold: 10
+      window: -1h
+`,
+		},
+		{
+			description: "xid policy without xids",
+			config: `
+health:
+  xids:
+  - xids: []
+    action: log-only
+`,
+		},
+		{
+			description: "negative xid",
+			config: `
+health:
+  fatalXids: [-1]
+`,
+		},
+	}
+
+	schema := compileSchema(t)
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			_, err := parseConfigFrom(strings.NewReader(tc.config))
+
+			configJSON, yamlErr := yaml.YAMLToJSON([]byte(tc.config))
+			require.NoError(t, yamlErr)
+			var config interface{}
+			require.NoError(t, json.Unmarshal(configJSON, &config))
+
+			schemaErr := schema.Validate(config)
+			require.Equal(t, err == nil, schemaErr == nil, "unmarshal error: %v; schema error: %v", err, schemaErr)
+		})
+	}
+}
+
+// TestSchemaPatternsArePortable checks that the patterns in the schema only use regular expression syntax
+// that is interpreted in the same way by the RE2 engine used to validate the schema in these tests and by
+// the ECMA-262 engines that JSON Schema specifies and that many validators use.
+func TestSchemaPatternsArePortable(t *testing.T) {
+	contents, err := Schema()
+	require.NoError(t, err)
+	var schema interface{}
+	require.NoError(t, json.Unmarshal(contents, &schema))
+
+	// Character classes, assertions, flags, and groups whose meaning or support differs between the engines.
+	nonPortable := regexp.MustCompile(`\\[dDwWsSbBpPzAQE]|\(\?|\[\[:`)
+
+	var patterns []string
+	var visit func(value interface{})
+	visit = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				if pattern, ok := value.(string); ok && key == "pattern" {
+					patterns = append(patterns, pattern)
+					continue
+				}
+				visit(value)
+			}
+		case []interface{}:
+			for _, value := range v {
+				visit(value)
+			}
+		}
+	}
+	visit(schema)
+
+	require.NotEmpty(t, patterns)
+	for _, pattern := range patterns {
+		require.False(t, nonPortable.MatchString(pattern), "pattern %q is not portable", pattern)
+	}
+}
+
+// compileSchema compiles the schema with a JSON Schema draft-07 validator.
+func compileSchema(t *testing.T) *jsonschema.Schema {
+	contents, err := Schema()
+	require.NoError(t, err)
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft7
+	require.NoError(t, compiler.AddResource(SchemaFile, bytes.NewReader(contents)))
+	schema, err := compiler.Compile(SchemaFile)
+	require.NoError(t, err)
+	return schema
+}
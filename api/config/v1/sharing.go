@@ -16,7 +16,161 @@
 
 package v1
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // Sharing encapsulates the set of sharing strategies that are supported.
 type Sharing struct {
 	TimeSlicing TimeSlicing `json:"timeSlicing,omitempty" yaml:"timeSlicing,omitempty"`
+	MPS         *MPS        `json:"mps,omitempty"         yaml:"mps,omitempty"`
+	Memory      *Memory     `json:"memory,omitempty"      yaml:"memory,omitempty"`
+}
+
+// UnmarshalJSON unmarshals raw bytes into a 'Sharing' struct.
+// At most one sharing strategy can be specified.
+func (s *Sharing) UnmarshalJSON(b []byte) error {
+	sharing := make(map[string]json.RawMessage)
+	err := json.Unmarshal(b, &sharing)
+	if err != nil {
+		return err
+	}
+
+	timeSlicing, hasTimeSlicing := sharing["timeSlicing"]
+	mps, hasMPS := sharing["mps"]
+	memory, hasMemory := sharing["memory"]
+
+	strategies := 0
+	for _, has := range []bool{hasTimeSlicing, hasMPS, hasMemory} {
+		if has {
+			strategies++
+		}
+	}
+	if strategies > 1 {
+		return fmt.Errorf("only one of 'timeSlicing', 'mps', and 'memory' can be specified")
+	}
+
+	if hasTimeSlicing {
+		err = json.Unmarshal(timeSlicing, &s.TimeSlicing)
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasMPS {
+		s.MPS = &MPS{}
+		err = json.Unmarshal(mps, s.MPS)
+		if err != nil {
+			return err
+		}
+	}
+
+	if hasMemory {
+		s.Memory = &Memory{}
+		err = json.Unmarshal(memory, s.Memory)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// customizeSchema allows at most one sharing strategy to be specified.
+func (Sharing) customizeSchema(s *jsonSchema) {
+	s.Not = &jsonSchema{
+		AnyOf: []*jsonSchema{
+			{Required: []string{"timeSlicing", "mps"}},
+			{Required: []string{"timeSlicing", "memory"}},
+			{Required: []string{"mps", "memory"}},
+		},
+	}
+}
+
+// SharingStrategy returns the sharing strategy that is configured.
+func (s *Sharing) SharingStrategy() string {
+	if s.MPS != nil {
+		return SharingStrategyMPS
+	}
+	if s.Memory != nil {
+		return SharingStrategyMemory
+	}
+	if len(s.TimeSlicing.Resources) > 0 {
+		return SharingStrategyTimeSlicing
+	}
+	return SharingStrategyNone
+}
+
+// ReplicatedResources returns the resources replicated by the configured sharing strategy.
+// No resources are replicated if devices are shared by memory.
+func (s *Sharing) ReplicatedResources() []ReplicatedResource {
+	if s.MPS != nil {
+		return s.MPS.Resources
+	}
+	if s.Memory != nil {
+		return nil
+	}
+	return s.TimeSlicing.Resources
+}
+
+// UsesMPS returns whether the configured sharing strategy requires MPS control daemons.
+func (s *Sharing) UsesMPS() bool {
+	if s.MPS != nil {
+		return true
+	}
+	if s.Memory != nil {
+		return s.Memory.UsesMPS()
+	}
+	return false
+}
+
+// FailRequestsGreaterThanOne returns whether requests for more than one replica should fail.
+// This is always the case with MPS, since each replica is limited to a share of a single device.
+func (s *Sharing) FailRequestsGreaterThanOne() bool {
+	if s.MPS != nil {
+		return true
+	}
+	return s.TimeSlicing.FailRequestsGreaterThanOne
+}
+
+// forResource returns the sharing settings that apply to the named resource. These are the settings of
+// the configured sharing strategy and the entries that share the devices of the resource or advertise
+// shared devices under its name. Nil is returned if no entries apply to the resource.
+func (s *Sharing) forResource(name ResourceName) *Sharing {
+	var applies bool
+	replicated := func(resources []ReplicatedResource) []ReplicatedResource {
+		var filtered []ReplicatedResource
+		for _, r := range resources {
+			if r.Name == name || r.Rename == name {
+				filtered = append(filtered, r)
+			}
+		}
+		applies = applies || len(filtered) > 0
+		return filtered
+	}
+
+	sharing := *s
+	sharing.TimeSlicing.Resources = replicated(s.TimeSlicing.Resources)
+	if s.MPS != nil {
+		mps := *s.MPS
+		mps.Resources = replicated(s.MPS.Resources)
+		sharing.MPS = &mps
+	}
+	if s.Memory != nil {
+		memory := *s.Memory
+		memory.Resources = nil
+		for _, r := range s.Memory.Resources {
+			if r.Name == name || r.Rename == name {
+				memory.Resources = append(memory.Resources, r)
+			}
+		}
+		applies = applies || len(memory.Resources) > 0
+		sharing.Memory = &memory
+	}
+
+	if !applies {
+		return nil
+	}
+	return &sharing
 }
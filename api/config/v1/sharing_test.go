@@ -0,0 +1,242 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalSharing(t *testing.T) {
+	testCases := []struct {
+		input                      string
+		output                     Sharing
+		strategy                   string
+		failRequestsGreaterThanOne bool
+		err                        bool
+	}{
+		{
+			input:    `{}`,
+			strategy: SharingStrategyNone,
+		},
+		{
+			input: `{
+				"timeSlicing": {
+					"resources": [
+						{
+							"name": "gpu",
+							"replicas": 2
+						}
+					]
+				}
+			}`,
+			output: Sharing{
+				TimeSlicing: TimeSlicing{
+					Resources: []ReplicatedResource{
+						{
+							Name:     NoErrorNewResourceName("gpu"),
+							Devices:  ReplicatedDevices{All: true},
+							Replicas: 2,
+						},
+					},
+				},
+			},
+			strategy: SharingStrategyTimeSlicing,
+		},
+		{
+			input: `{
+				"timeSlicing": {
+					"replicaPolicy": "packed",
+					"resources": [
+						{
+							"name": "gpu",
+							"replicas": 2
+						}
+					]
+				}
+			}`,
+			output: Sharing{
+				TimeSlicing: TimeSlicing{
+					ReplicaPolicy: ReplicaPolicyPacked,
+					Resources: []ReplicatedResource{
+						{
+							Name:     NoErrorNewResourceName("gpu"),
+							Devices:  ReplicatedDevices{All: true},
+							Replicas: 2,
+						},
+					},
+				},
+			},
+			strategy: SharingStrategyTimeSlicing,
+		},
+		{
+			input: `{
+				"timeSlicing": {
+					"replicaPolicy": "unknown",
+					"resources": [
+						{
+							"name": "gpu",
+							"replicas": 2
+						}
+					]
+				}
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"mps": {
+					"renameByDefault": true,
+					"resources": [
+						{
+							"name": "gpu",
+							"devices": [0, 1],
+							"replicas": 4
+						}
+					]
+				}
+			}`,
+			output: Sharing{
+				MPS: &MPS{
+					RenameByDefault: true,
+					Resources: []ReplicatedResource{
+						{
+							Name:     NoErrorNewResourceName("gpu"),
+							Rename:   NoErrorNewResourceName("gpu.shared"),
+							Devices:  ReplicatedDevices{List: []ReplicatedDeviceRef{"0", "1"}},
+							Replicas: 4,
+						},
+					},
+				},
+			},
+			strategy:                   SharingStrategyMPS,
+			failRequestsGreaterThanOne: true,
+		},
+		{
+			input: `{
+				"mps": {
+					"resources": []
+				}
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"mps": {
+					"resources": [
+						{
+							"name": "gpu",
+							"devices": ["0:1"],
+							"replicas": 2
+						}
+					]
+				}
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"timeSlicing": {
+					"resources": [
+						{
+							"name": "gpu",
+							"replicas": 2
+						}
+					]
+				},
+				"mps": {
+					"resources": [
+						{
+							"name": "gpu",
+							"replicas": 2
+						}
+					]
+				}
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"memory": {
+					"resources": [
+						{
+							"name": "gpu",
+							"devices": [1]
+						}
+					]
+				}
+			}`,
+			output: Sharing{
+				Memory: &Memory{
+					Resources: []MemoryResource{
+						{
+							Name:    NoErrorNewResourceName("gpu"),
+							Rename:  NoErrorNewResourceName("gpumem"),
+							Devices: ReplicatedDevices{List: []ReplicatedDeviceRef{"1"}},
+						},
+					},
+				},
+			},
+			strategy: SharingStrategyMemory,
+		},
+		{
+			input: `{
+				"memory": {
+					"resources": []
+				}
+			}`,
+			err: true,
+		},
+		{
+			input: `{
+				"memory": {
+					"resources": [
+						{
+							"name": "gpu"
+						}
+					]
+				},
+				"mps": {
+					"resources": [
+						{
+							"name": "gpu",
+							"replicas": 2
+						}
+					]
+				}
+			}`,
+			err: true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("test case %d", i), func(t *testing.T) {
+			var output Sharing
+			err := output.UnmarshalJSON([]byte(tc.input))
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.output, output)
+			require.Equal(t, tc.strategy, output.SharingStrategy())
+			require.Equal(t, tc.failRequestsGreaterThanOne, output.FailRequestsGreaterThanOne())
+		})
+	}
+}
@@ -18,7 +18,6 @@ package v1
 
 import (
 	"fmt"
-	"strings"
 )
 
 // DeviceListStrategies defines which strategies are enabled and should
@@ -31,6 +30,7 @@ func NewDeviceListStrategies(strategies []string) (DeviceListStrategies, error)
 		DeviceListStrategyEnvvar:         false,
 		DeviceListStrategyVolumeMounts:   false,
 		DeviceListStrategyCDIAnnotations: false,
+		DeviceListStrategyCDICRI:         false,
 	}
 	for _, s := range strategies {
 		if _, ok := ret[s]; !ok {
@@ -49,10 +49,5 @@ func (s DeviceListStrategies) Includes(strategy string) bool {
 
 // IsCDIEnabled returns whether any of the strategies being used require CDI.
 func (s DeviceListStrategies) IsCDIEnabled() bool {
-	for k, v := range s {
-		if strings.HasPrefix(k, "cdi-") && v {
-			return true
-		}
-	}
-	return false
+	return s.Includes(DeviceListStrategyCDIAnnotations) || s.Includes(DeviceListStrategyCDICRI)
 }
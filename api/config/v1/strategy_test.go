@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package v1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceListStrategies(t *testing.T) {
+	testCases := []struct {
+		description        string
+		strategies         []string
+		expectedError      bool
+		expectedCDIEnabled bool
+	}{
+		{
+			description: "envvar does not enable CDI",
+			strategies:  []string{"envvar"},
+		},
+		{
+			description:        "cdi-annotations enables CDI",
+			strategies:         []string{"envvar", "cdi-annotations"},
+			expectedCDIEnabled: true,
+		},
+		{
+			description:        "cdi-cri enables CDI",
+			strategies:         []string{"cdi-cri"},
+			expectedCDIEnabled: true,
+		},
+		{
+			description:   "unknown strategy is an error",
+			strategies:    []string{"cdi-unknown"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			s, err := NewDeviceListStrategies(tc.strategies)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedCDIEnabled, s.IsCDIEnabled())
+			for _, strategy := range tc.strategies {
+				require.True(t, s.Includes(strategy))
+			}
+		})
+	}
+}
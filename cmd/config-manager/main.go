@@ -21,25 +21,17 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
 	"syscall"
 
-	"github.com/prometheus/procfs"
 	cli "github.com/urfave/cli/v2"
 
-	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/fields"
+	"github.com/NVIDIA/k8s-device-plugin/internal/watch"
+
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
 )
 
-const (
-	// ResourceNodes represents the name the K8s resource 'nodes'
-	ResourceNodes = "nodes"
-)
-
 // These constants represent the default value of flags to the CLI
 const (
 	DefaultOneshot         = false
@@ -74,45 +66,6 @@ type Flags struct {
 	ProcessToSignal    string
 }
 
-// SyncableConfig is used to synchronize on changes to a configuration value
-// That is, callers of Get() will block until a call to Set() is made.
-// Multiple calls to Set() do not queue, meaning that only calls to Get() made
-// *before* a call to Set() will be notified.
-type SyncableConfig struct {
-	cond     *sync.Cond
-	mutex    sync.Mutex
-	current  string
-	lastRead string
-}
-
-// NewSyncableConfig creates a new SyncableConfig
-func NewSyncableConfig(f *Flags) *SyncableConfig {
-	var m SyncableConfig
-	m.cond = sync.NewCond(&m.mutex)
-	return &m
-}
-
-// Set sets the value of the config.
-// All callers of Get() before the Set() will be unblocked.
-func (m *SyncableConfig) Set(value string) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	m.current = value
-	m.cond.Broadcast()
-}
-
-// Get gets the value of the config.
-// A call to Get() will block until a subsequent Set() call is made.
-func (m *SyncableConfig) Get() string {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	if m.lastRead == m.current {
-		m.cond.Wait()
-	}
-	m.lastRead = m.current
-	return m.lastRead
-}
-
 func main() {
 	flags := Flags{}
 
@@ -237,9 +190,9 @@ func start(c *cli.Context, f *Flags) error {
 		return fmt.Errorf("error building kubernetes clientset from config: %s", err)
 	}
 
-	config := NewSyncableConfig(f)
+	config := watch.NewSyncableConfig()
 
-	stop := continuouslySyncConfigChanges(clientset, config, f)
+	stop := watch.NodeLabel(clientset, f.NodeName, f.NodeLabel, config)
 	defer close(stop)
 
 	for {
@@ -253,41 +206,6 @@ func start(c *cli.Context, f *Flags) error {
 	}
 }
 
-func continuouslySyncConfigChanges(clientset *kubernetes.Clientset, config *SyncableConfig, f *Flags) chan struct{} {
-	listWatch := cache.NewListWatchFromClient(
-		clientset.CoreV1().RESTClient(),
-		ResourceNodes,
-		v1.NamespaceAll,
-		fields.OneTermEqualSelector("metadata.name", f.NodeName),
-	)
-
-	_, controller := cache.NewInformer(
-		listWatch, &v1.Node{}, 0,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				config.Set(obj.(*v1.Node).Labels[f.NodeLabel])
-			},
-			UpdateFunc: func(oldObj, newObj interface{}) {
-				oldLabel := oldObj.(*v1.Node).Labels[f.NodeLabel]
-				newLabel := newObj.(*v1.Node).Labels[f.NodeLabel]
-				if oldLabel != newLabel {
-					config.Set(newLabel)
-				}
-			},
-			DeleteFunc: func(obj interface{}) {
-				oldLabel := obj.(*v1.Node).Labels[f.NodeLabel]
-				if oldLabel != "" {
-					config.Set("")
-				}
-			},
-		},
-	)
-
-	stop := make(chan struct{})
-	go controller.Run(stop)
-	return stop
-}
-
 func updateConfig(config string, f *Flags) error {
 	config, err := updateConfigName(config, f)
 	if err != nil {
@@ -317,7 +235,7 @@ func updateConfig(config string, f *Flags) error {
 
 	if f.SendSignal {
 		klog.Infof("Sending signal '%s' to '%s'", syscall.Signal(f.Signal), f.ProcessToSignal)
-		err := signalProcess(f)
+		err := watch.SignalProcess(f.ProcessToSignal, syscall.Signal(f.Signal))
 		if err != nil {
 			return err
 		}
@@ -426,35 +344,6 @@ func updateSymlink(config string, f *Flags) (bool, error) {
 	return true, nil
 }
 
-func signalProcess(f *Flags) error {
-	pid, err := findPidToSignal(f)
-	if err != nil {
-		return fmt.Errorf("error finding pid: %v", err)
-	}
-	err = syscall.Kill(pid, syscall.Signal(f.Signal))
-	if err != nil {
-		return fmt.Errorf("error sending signal: %v", err)
-	}
-	return nil
-}
-
-func findPidToSignal(f *Flags) (int, error) {
-	procs, err := procfs.AllProcs()
-	if err != nil {
-		return -1, fmt.Errorf("error getting list of all procs: %v", err)
-	}
-	for _, p := range procs {
-		cmdline, err := p.CmdLine()
-		if err != nil {
-			return -1, fmt.Errorf("error getting cmdline: %v", err)
-		}
-		if cmdline[0] == f.ProcessToSignal {
-			return p.PID, nil
-		}
-	}
-	return -1, fmt.Errorf("no process found")
-}
-
 func fileExists(filename string) (bool, error) {
 	info, err := os.Stat(filename)
 	if os.IsNotExist(err) {
@@ -0,0 +1,442 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/mig"
+	"github.com/NVIDIA/k8s-device-plugin/internal/watch"
+	cli "github.com/urfave/cli/v2"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/klog/v2"
+)
+
+// These constants represent the default value of flags to the CLI
+const (
+	DefaultOneshot         = false
+	DefaultSendSignal      = true
+	DefaultSignal          = int(syscall.SIGHUP)
+	DefaultProcessToSignal = "nvidia-device-plugin"
+	DefaultConfigLabel     = "nvidia.com/mig.config"
+	DefaultStateLabel      = "nvidia.com/mig.config.state"
+	DefaultWaitTimeout     = 5 * time.Minute
+)
+
+// These constants represent the values of the state label
+const (
+	StatePending = "pending"
+	StateSuccess = "success"
+	StateFailed  = "failed"
+)
+
+const (
+	// resourcePrefix is the prefix of the extended resources whose allocations block a MIG reconfiguration
+	resourcePrefix = "nvidia.com/"
+	// pollInterval is the interval at which the pods on the node are checked while waiting for devices to be freed
+	pollInterval = 5 * time.Second
+	// requestTimeout is the timeout of the individual requests made to the API server
+	requestTimeout = 10 * time.Second
+	// maxConflictRetries is the number of times an update of the node is retried if it conflicts with another update
+	maxConflictRetries = 5
+)
+
+// reconfiguringTaint keeps new pods from being scheduled on the node while its MIG devices are reconfigured,
+// since the plugin advertises the current MIG devices until the new MIG config has been applied.
+var reconfiguringTaint = v1.Taint{
+	Key:    "nvidia.com/mig.reconfiguring",
+	Value:  "true",
+	Effect: v1.TaintEffectNoSchedule,
+}
+
+// Flags holds configurable settings as set via the CLI
+type Flags struct {
+	Oneshot         bool
+	Kubeconfig      string
+	NodeName        string
+	NodeLabel       string
+	StateLabel      string
+	ConfigFile      string
+	WaitTimeout     time.Duration
+	SendSignal      bool
+	Signal          int
+	ProcessToSignal string
+}
+
+func main() {
+	flags := Flags{}
+
+	c := cli.NewApp()
+	c.Name = "NVIDIA MIG Manager"
+	c.Usage = "apply the MIG layout selected by a node label"
+	c.Before = func(c *cli.Context) error {
+		return validateFlags(c, &flags)
+	}
+	c.Action = func(c *cli.Context) error {
+		return start(c, &flags)
+	}
+
+	c.Flags = []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "oneshot",
+			Value:       DefaultOneshot,
+			Usage:       "check and apply the MIG config only once and then exit",
+			Destination: &flags.Oneshot,
+			EnvVars:     []string{"ONESHOT"},
+		},
+		&cli.StringFlag{
+			Name:        "kubeconfig",
+			Value:       "",
+			Usage:       "absolute path to the kubeconfig file",
+			Destination: &flags.Kubeconfig,
+			EnvVars:     []string{"KUBECONFIG"},
+		},
+		&cli.StringFlag{
+			Name:        "node-name",
+			Value:       "",
+			Usage:       "the name of the node to watch for label changes on",
+			Destination: &flags.NodeName,
+			EnvVars:     []string{"NODE_NAME"},
+		},
+		&cli.StringFlag{
+			Name:        "node-label",
+			Value:       DefaultConfigLabel,
+			Usage:       "the name of the node label to use for selecting a MIG config",
+			Destination: &flags.NodeLabel,
+			EnvVars:     []string{"NODE_LABEL"},
+		},
+		&cli.StringFlag{
+			Name:        "state-label",
+			Value:       DefaultStateLabel,
+			Usage:       "the name of the node label to report the state of the MIG reconfiguration in",
+			Destination: &flags.StateLabel,
+			EnvVars:     []string{"STATE_LABEL"},
+		},
+		&cli.StringFlag{
+			Name:        "config-file",
+			Value:       "",
+			Usage:       "the path to the file containing the available MIG configs",
+			Destination: &flags.ConfigFile,
+			EnvVars:     []string{"CONFIG_FILE"},
+		},
+		&cli.DurationFlag{
+			Name:        "wait-timeout",
+			Value:       DefaultWaitTimeout,
+			Usage:       "the time to wait for allocated devices to be freed before giving up on a MIG reconfiguration",
+			Destination: &flags.WaitTimeout,
+			EnvVars:     []string{"WAIT_TIMEOUT"},
+		},
+		&cli.BoolFlag{
+			Name:        "send-signal",
+			Value:       DefaultSendSignal,
+			Usage:       "send a signal to <process-to-signal> once a MIG config has been applied",
+			Destination: &flags.SendSignal,
+			EnvVars:     []string{"SEND_SIGNAL"},
+		},
+		&cli.IntFlag{
+			Name:        "signal",
+			Value:       DefaultSignal,
+			Usage:       "the signal to sent to <process-to-signal> if <send-signal> is set",
+			Destination: &flags.Signal,
+			EnvVars:     []string{"SIGNAL"},
+		},
+		&cli.StringFlag{
+			Name:        "process-to-signal",
+			Value:       DefaultProcessToSignal,
+			Usage:       "the name of the process to signal if <send-signal> is set",
+			Destination: &flags.ProcessToSignal,
+			EnvVars:     []string{"PROCESS_TO_SIGNAL"},
+		},
+	}
+
+	err := c.Run(os.Args)
+	if err != nil {
+		klog.Error(err)
+		os.Exit(1)
+	}
+}
+
+func validateFlags(c *cli.Context, f *Flags) error {
+	if f.NodeName == "" {
+		return fmt.Errorf("invalid <node-name>: must not be empty string")
+	}
+	if f.NodeLabel == "" {
+		return fmt.Errorf("invalid <node-label>: must not be empty string")
+	}
+	if f.StateLabel == "" {
+		return fmt.Errorf("invalid <state-label>: must not be empty string")
+	}
+	if f.ConfigFile == "" {
+		return fmt.Errorf("invalid <config-file>: must not be empty string")
+	}
+	if f.WaitTimeout <= 0 {
+		return fmt.Errorf("invalid <wait-timeout>: must be positive")
+	}
+	return nil
+}
+
+func start(c *cli.Context, f *Flags) error {
+	kubeconfig, err := clientcmd.BuildConfigFromFlags("", f.Kubeconfig)
+	if err != nil {
+		return fmt.Errorf("error building kubernetes clientcmd config: %s", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("error building kubernetes clientset from config: %s", err)
+	}
+
+	config := watch.NewSyncableConfig()
+
+	stop := watch.NodeLabel(clientset, f.NodeName, f.NodeLabel, config)
+	defer close(stop)
+
+	for {
+		klog.Infof("Waiting for change to '%s' label", f.NodeLabel)
+		config := config.Get()
+		klog.Infof("Label change detected: %s=%s", f.NodeLabel, config)
+		if config == "" {
+			klog.Infof("No MIG config selected. Leaving MIG devices unchanged...")
+			if f.Oneshot {
+				return nil
+			}
+			continue
+		}
+
+		err := updateMigConfig(clientset, config, f)
+		if err != nil {
+			klog.Errorf("Failed to apply MIG config %s: %v", config, err)
+		}
+		if f.Oneshot {
+			return err
+		}
+	}
+}
+
+// updateMigConfig applies the named MIG config and reports the state of the
+// reconfiguration in the state label of the node. The node is tainted until
+// the plugin has been signalled to advertise the new MIG devices. If the MIG
+// devices that existed before could not be restored after a failure, the node
+// is left tainted until a MIG config is applied successfully.
+func updateMigConfig(clientset kubernetes.Interface, config string, f *Flags) (rerr error) {
+	err := setStateLabel(clientset, f, StatePending)
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("Tainting node %s with %s while its MIG devices are reconfigured", f.NodeName, reconfiguringTaint.ToString())
+	err = updateReconfiguringTaint(clientset, f, true)
+	if err != nil {
+		if err := setStateLabel(clientset, f, StateFailed); err != nil {
+			klog.Warningf("Failed to set %s label: %v", f.StateLabel, err)
+		}
+		return err
+	}
+	defer func() {
+		if _, ok := rerr.(*mig.RestoreError); ok {
+			klog.Errorf("Leaving node %s tainted with %s since its MIG devices are in an unknown state", f.NodeName, reconfiguringTaint.ToString())
+			return
+		}
+		if err := updateReconfiguringTaint(clientset, f, false); err != nil {
+			klog.Warningf("Failed to remove %s taint: %v", reconfiguringTaint.Key, err)
+		}
+	}()
+
+	err = applyMigConfig(clientset, config, f)
+	if err != nil {
+		if err := setStateLabel(clientset, f, StateFailed); err != nil {
+			klog.Warningf("Failed to set %s label: %v", f.StateLabel, err)
+		}
+		return err
+	}
+
+	err = setStateLabel(clientset, f, StateSuccess)
+	if err != nil {
+		return err
+	}
+	klog.Infof("Successfully applied MIG config: %s", config)
+
+	if f.SendSignal {
+		klog.Infof("Sending signal '%s' to '%s'", syscall.Signal(f.Signal), f.ProcessToSignal)
+		err := watch.SignalProcess(f.ProcessToSignal, syscall.Signal(f.Signal))
+		if err != nil {
+			return err
+		}
+		klog.Infof("Successfully sent signal")
+	}
+
+	return nil
+}
+
+func applyMigConfig(clientset kubernetes.Interface, config string, f *Flags) error {
+	// The config file is read on every change so that updates to the
+	// ConfigMap it is mounted from are picked up without a restart.
+	spec, err := mig.ParseSpec(f.ConfigFile)
+	if err != nil {
+		return err
+	}
+	migConfig, err := spec.Get(config)
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("Waiting for allocated devices on node %s to be freed", f.NodeName)
+	err = waitForDevicesToBeFreed(clientset, f)
+	if err != nil {
+		return err
+	}
+
+	klog.Infof("Applying MIG config: %s", config)
+	return mig.New().Apply(migConfig)
+}
+
+// updateReconfiguringTaint adds the reconfiguringTaint to the node if taint is set and removes it otherwise.
+// Since the taints of a node are replaced as a whole, the node is updated and retried on conflicts.
+func updateReconfiguringTaint(clientset kubernetes.Interface, f *Flags, taint bool) error {
+	var err error
+	for i := 0; i < maxConflictRetries; i++ {
+		err = func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			defer cancel()
+
+			node, err := clientset.CoreV1().Nodes().Get(ctx, f.NodeName, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+
+			var taints []v1.Taint
+			tainted := false
+			for _, t := range node.Spec.Taints {
+				if t.MatchTaint(&reconfiguringTaint) {
+					tainted = true
+					if !taint {
+						continue
+					}
+				}
+				taints = append(taints, t)
+			}
+			if tainted == taint {
+				return nil
+			}
+			if taint {
+				taints = append(taints, reconfiguringTaint)
+			}
+			node.Spec.Taints = taints
+
+			_, err = clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+			return err
+		}()
+		if !apierrors.IsConflict(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error updating %s taint on node %s: %v", reconfiguringTaint.Key, f.NodeName, err)
+	}
+	return nil
+}
+
+// waitForDevicesToBeFreed waits until no running pods on the node request NVIDIA resources.
+// Evicting or draining these pods is left to the cluster operator.
+func waitForDevicesToBeFreed(clientset kubernetes.Interface, f *Flags) error {
+	var pending []string
+	err := wait.PollUntilContextTimeout(context.Background(), pollInterval, f.WaitTimeout, true, func(ctx context.Context) (bool, error) {
+		ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+
+		pods, err := clientset.CoreV1().Pods(v1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", f.NodeName).String(),
+		})
+		if err != nil {
+			klog.Warningf("Failed to list pods on node %s: %v", f.NodeName, err)
+			return false, nil
+		}
+
+		pending = nil
+		for _, pod := range pods.Items {
+			if podRequestsDevices(&pod) {
+				pending = append(pending, pod.Namespace+"/"+pod.Name)
+			}
+		}
+		if len(pending) > 0 {
+			klog.Infof("Waiting for pods with allocated devices to complete: %v", pending)
+		}
+		return len(pending) == 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out waiting for pods with allocated devices to complete: %v", pending)
+	}
+	return nil
+}
+
+// podRequestsDevices checks whether a pod that has not yet terminated requests NVIDIA resources.
+func podRequestsDevices(pod *v1.Pod) bool {
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return false
+	}
+	containers := append([]v1.Container{}, pod.Spec.InitContainers...)
+	containers = append(containers, pod.Spec.Containers...)
+	for _, c := range containers {
+		for name := range c.Resources.Limits {
+			if strings.HasPrefix(string(name), resourcePrefix) {
+				return true
+			}
+		}
+		for name := range c.Resources.Requests {
+			if strings.HasPrefix(string(name), resourcePrefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func setStateLabel(clientset kubernetes.Interface, f *Flags, state string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]string{
+				f.StateLabel: state,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error constructing patch for %s label: %v", f.StateLabel, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	_, err = clientset.CoreV1().Nodes().Patch(ctx, f.NodeName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("error setting %s=%s on node %s: %v", f.StateLabel, state, f.NodeName, err)
+	}
+	return nil
+}
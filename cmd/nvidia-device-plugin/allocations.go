@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/plugin"
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+)
+
+// allocationsAPI serves the devices advertised by the plugins started by the
+// start() loop together with the containers they are allocated to.
+type allocationsAPI struct {
+	sync.Mutex
+	podResources podresources.Interface
+	plugins      []plugin.Interface
+}
+
+// allocationsResponse is the body returned by the allocations handler.
+type allocationsResponse struct {
+	Devices []plugin.DeviceAllocation `json:"devices"`
+	Error   string                    `json:"error,omitempty"`
+}
+
+// setPlugins updates the set of plugins after they have been (re)started.
+func (a *allocationsAPI) setPlugins(plugins []plugin.Interface) {
+	a.Lock()
+	defer a.Unlock()
+	a.plugins = plugins
+}
+
+// getDeviceAllocations joins the devices of all plugins with the allocations reported by the kubelet.
+func (a *allocationsAPI) getDeviceAllocations() ([]plugin.DeviceAllocation, error) {
+	a.Lock()
+	plugins := a.plugins
+	a.Unlock()
+
+	allocations, err := a.podResources.GetAllocations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocations from the kubelet: %v", err)
+	}
+
+	devices := []plugin.DeviceAllocation{}
+	for _, p := range plugins {
+		devices = append(devices, p.GetDeviceAllocations(allocations)...)
+	}
+	return devices, nil
+}
+
+// ServeHTTP serves the device allocations as JSON.
+func (a *allocationsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(allocationsResponse{Error: fmt.Sprintf("method %s not allowed", r.Method)})
+		return
+	}
+
+	devices, err := a.getDeviceAllocations()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(allocationsResponse{Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(allocationsResponse{Devices: devices})
+}
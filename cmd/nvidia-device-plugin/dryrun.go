@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/plugin"
+	"github.com/NVIDIA/k8s-device-plugin/internal/reporter"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	cli "github.com/urfave/cli/v2"
+)
+
+const (
+	dryRunFormatTable = "table"
+	dryRunFormatJSON  = "json"
+)
+
+// dryRun constructs the plugins for the current config as startPlugins does and
+// prints the resources they would advertise, without starting them.
+func dryRun(c *cli.Context, flags []cli.Flag) error {
+	format := c.String("dry-run-format")
+	if format != dryRunFormatTable && format != dryRunFormatJSON {
+		return fmt.Errorf("invalid --dry-run-format option: %v", format)
+	}
+
+	config, err := loadConfig(c, flags)
+	if err != nil {
+		return fmt.Errorf("unable to load config: %v", err)
+	}
+	err = rm.AddDefaultResourcesToConfig(config)
+	if err != nil {
+		return fmt.Errorf("unable to add default resources to config: %v", err)
+	}
+
+	pluginManager, err := NewPluginManager(config, reporter.NewNullReporter(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("error creating plugin manager: %v", err)
+	}
+	plugins, err := pluginManager.GetPlugins()
+	if err != nil {
+		return fmt.Errorf("error getting plugins: %v", err)
+	}
+
+	descriptions := []*plugin.Description{}
+	for _, p := range plugins {
+		if len(p.Devices()) == 0 {
+			continue
+		}
+		d, err := p.Describe()
+		if err != nil {
+			return fmt.Errorf("error describing plugin for '%s': %v", p.Status().Resource, err)
+		}
+		descriptions = append(descriptions, d)
+	}
+
+	if format == dryRunFormatJSON {
+		output, err := json.MarshalIndent(descriptions, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal resources to JSON: %v", err)
+		}
+		fmt.Fprintln(c.App.Writer, string(output))
+		return nil
+	}
+	return printDescriptions(c.App.Writer, descriptions)
+}
+
+// printDescriptions prints a table of the devices of each resource followed by
+// the response to its sample allocation request.
+func printDescriptions(w io.Writer, descriptions []*plugin.Description) error {
+	if len(descriptions) == 0 {
+		fmt.Fprintln(w, "No devices found.")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESOURCE\tID\tINDEX\tNUMA NODE\tREPLICAS\tPATHS\tCDI DEVICES")
+	for _, d := range descriptions {
+		for _, dd := range d.Devices {
+			numaNode := "-"
+			if dd.NUMANode != nil {
+				numaNode = fmt.Sprintf("%d", *dd.NUMANode)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				d.Resource, dd.ID, dd.Index, numaNode, len(dd.Replicas),
+				orNone(dd.Paths), orNone(dd.CDIDevices))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, d := range descriptions {
+		response, err := json.MarshalIndent(d.SampleResponse, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal allocate response to JSON: %v", err)
+		}
+		fmt.Fprintf(w, "\nAllocate response for '%s' request %v:\n%s\n", d.Resource, d.SampleRequest, response)
+	}
+	return nil
+}
+
+func orNone(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	return strings.Join(values, ",")
+}
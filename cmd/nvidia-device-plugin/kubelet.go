@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/plugin"
+	cli "github.com/urfave/cli/v2"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newKubeletVersion creates the function used by the plugins to get the version of the kubelet from
+// the node they are running on. If <node-name> is not set, nil is returned and the version is unknown.
+func newKubeletVersion(c *cli.Context) (plugin.KubeletVersionFunc, error) {
+	nodeName := c.String("node-name")
+	if nodeName == "" {
+		return nil, nil
+	}
+
+	clientset, err := newClientset(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (string, error) {
+		node, err := clientset.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("error getting node %s: %v", nodeName, err)
+		}
+		return node.Status.NodeInfo.KubeletVersion, nil
+	}, nil
+}
@@ -19,16 +19,22 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"syscall"
 	"time"
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
 	"github.com/NVIDIA/k8s-device-plugin/internal/info"
+	"github.com/NVIDIA/k8s-device-plugin/internal/metrics"
+	"github.com/NVIDIA/k8s-device-plugin/internal/mps"
 	"github.com/NVIDIA/k8s-device-plugin/internal/plugin"
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+	"github.com/NVIDIA/k8s-device-plugin/internal/reporter"
 	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
 	"github.com/fsnotify/fsnotify"
 	cli "github.com/urfave/cli/v2"
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
 
 	"k8s.io/klog/v2"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
@@ -42,6 +48,9 @@ func main() {
 	c.Usage = "NVIDIA device plugin for Kubernetes"
 	c.Version = info.GetVersionString()
 	c.Action = func(ctx *cli.Context) error {
+		if ctx.Bool("dry-run") {
+			return dryRun(ctx, c.Flags)
+		}
 		return start(ctx, c.Flags)
 	}
 
@@ -73,7 +82,7 @@ func main() {
 		&cli.StringSliceFlag{
 			Name:    "device-list-strategy",
 			Value:   cli.NewStringSlice(string(spec.DeviceListStrategyEnvvar)),
-			Usage:   "the desired strategy for passing the device list to the underlying runtime:\n\t\t[envvar | volume-mounts | cdi-annotations]",
+			Usage:   "the desired strategy for passing the device list to the underlying runtime:\n\t\t[envvar | volume-mounts | cdi-annotations | cdi-cri]\n\t\tcdi-annotations and cdi-cri can be combined, in which case the CDI devices are passed both as annotations and in the CDIDevices field",
 			EnvVars: []string{"DEVICE_LIST_STRATEGY"},
 		},
 		&cli.StringFlag{
@@ -113,9 +122,92 @@ func main() {
 		&cli.StringFlag{
 			Name:    "container-driver-root",
 			Value:   spec.DefaultContainerDriverRoot,
-			Usage:   "the path where the NVIDIA driver root is mounted in the container; used for generating CDI specifications",
+			Usage:   "the path where the NVIDIA driver root is mounted in the container; used for generating CDI specifications and for pre-start checks",
 			EnvVars: []string{"CONTAINER_DRIVER_ROOT"},
 		},
+		&cli.DurationFlag{
+			Name:    "health-recovery-period",
+			Value:   0,
+			Usage:   "the time a device must be free of errors before it is marked healthy again; a value of 0 disables recovery of unhealthy devices",
+			EnvVars: []string{"HEALTH_RECOVERY_PERIOD"},
+		},
+		&cli.StringFlag{
+			Name:    "mps-root",
+			Value:   spec.DefaultMPSRoot,
+			Usage:   "the host path under which the pipe and log directories of the MPS control daemons are created; must be mounted at the same path in the container",
+			EnvVars: []string{"MPS_ROOT"},
+		},
+		&cli.StringFlag{
+			Name:    "allocation-policy",
+			Value:   spec.AllocationPolicyBestEffort,
+			Usage:   "the policy used to choose the preferred devices for an allocation:\n\t\t[best-effort | simple | static-dgx1-pascal | static-dgx1-volta | packing | spreading]",
+			EnvVars: []string{"ALLOCATION_POLICY"},
+		},
+		&cli.BoolFlag{
+			Name:    "affinity-envvars",
+			Usage:   "set the NCCL_IB_HCA and UCX_NET_DEVICES environment variables to the RDMA devices local to the devices allocated to a container",
+			EnvVars: []string{"AFFINITY_ENVVARS"},
+		},
+		&cli.BoolFlag{
+			Name:    "pre-start-checks",
+			Usage:   "check that the devices allocated to a container are healthy and that their device nodes and MIG capabilities exist under <container-driver-root> before the container is started",
+			EnvVars: []string{"PRE_START_CHECKS"},
+		},
+		&cli.BoolFlag{
+			Name:    "kubelet-cdi-devices",
+			Usage:   "pass the CDI devices of the cdi-cri strategy in the CDIDevices field regardless of the kubelet version, e.g. for a v1.28 kubelet with the DevicePluginCDIDevices feature gate enabled",
+			EnvVars: []string{"KUBELET_CDI_DEVICES"},
+		},
+		&cli.StringFlag{
+			Name:    "metrics-address",
+			Usage:   "the address (e.g. ':9400') on which to serve Prometheus metrics under /metrics; metrics are not served if empty",
+			EnvVars: []string{"METRICS_ADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:    "health-probe-address",
+			Usage:   "the address (e.g. ':8081') on which to serve the /healthz and /readyz probes; the probes are not served if empty",
+			EnvVars: []string{"HEALTH_PROBE_ADDRESS"},
+		},
+		&cli.BoolFlag{
+			Name:    "report-health",
+			Usage:   "report changes in device health as Kubernetes Events and a NvidiaGPUHealthy condition on the node; requires <node-name>",
+			EnvVars: []string{"REPORT_HEALTH"},
+		},
+		&cli.StringFlag{
+			Name:    "node-name",
+			Usage:   "the name of the node the plugin is running on",
+			EnvVars: []string{"NODE_NAME"},
+		},
+		&cli.StringFlag{
+			Name:    "pod-resources-socket",
+			Usage:   "the path to the PodResources socket of the kubelet (e.g. '" + podresources.DefaultSocket + "'); if set, the devices allocated to containers are queried to balance replicas across GPUs",
+			EnvVars: []string{"POD_RESOURCES_SOCKET"},
+		},
+		&cli.StringFlag{
+			Name:    "allocations-address",
+			Usage:   "the address (e.g. '127.0.0.1:8082') on which to serve the devices allocated to each container under /v1/allocations; requires <pod-resources-socket>",
+			EnvVars: []string{"ALLOCATIONS_ADDRESS"},
+		},
+		&cli.BoolFlag{
+			Name:    "dry-run",
+			Usage:   "print the resources that the plugin would advertise and exit without registering with the kubelet",
+			EnvVars: []string{"DRY_RUN"},
+		},
+		&cli.StringFlag{
+			Name:    "dry-run-format",
+			Value:   dryRunFormatTable,
+			Usage:   "the format in which to print the resources for --dry-run:\n\t\t[table | json]",
+			EnvVars: []string{"DRY_RUN_FORMAT"},
+		},
+		&cli.StringFlag{
+			Name:    "kubeconfig",
+			Usage:   "absolute path to the kubeconfig file; the in-cluster config is used if not set",
+			EnvVars: []string{"KUBECONFIG"},
+		},
+	}
+
+	c.Commands = []*cli.Command{
+		newValidateCommand(c.Flags),
 	}
 
 	err := c.Run(os.Args)
@@ -134,6 +226,14 @@ func validateFlags(config *spec.Config) error {
 	if *config.Flags.Plugin.DeviceIDStrategy != spec.DeviceIDStrategyUUID && *config.Flags.Plugin.DeviceIDStrategy != spec.DeviceIDStrategyIndex {
 		return fmt.Errorf("invalid --device-id-strategy option: %v", *config.Flags.Plugin.DeviceIDStrategy)
 	}
+
+	switch *config.Flags.Plugin.AllocationPolicy {
+	case spec.AllocationPolicyBestEffort, spec.AllocationPolicySimple:
+	case spec.AllocationPolicyStaticDGX1Pascal, spec.AllocationPolicyStaticDGX1Volta:
+	case spec.AllocationPolicyPacking, spec.AllocationPolicySpreading:
+	default:
+		return fmt.Errorf("invalid --allocation-policy option: %v", *config.Flags.Plugin.AllocationPolicy)
+	}
 	return nil
 }
 
@@ -150,6 +250,24 @@ func loadConfig(c *cli.Context, flags []cli.Flag) (*spec.Config, error) {
 	return config, nil
 }
 
+// validateConfig checks that the current config can be loaded and that the devices
+// of its resources can be built on the node, without starting any plugins.
+func validateConfig(c *cli.Context, flags []cli.Flag) error {
+	config, err := loadConfig(c, flags)
+	if err != nil {
+		return err
+	}
+	err = rm.AddDefaultResourcesToConfig(config)
+	if err != nil {
+		return fmt.Errorf("unable to add default resources to config: %v", err)
+	}
+	_, err = rm.NewResourceManagers(nvml.New(), config, nil)
+	if err != nil {
+		return fmt.Errorf("unable to build resources: %v", err)
+	}
+	return nil
+}
+
 func start(c *cli.Context, flags []cli.Flag) error {
 	klog.Info("Starting FS watcher.")
 	watcher, err := newFSWatcher(pluginapi.DevicePluginPath)
@@ -158,63 +276,165 @@ func start(c *cli.Context, flags []cli.Flag) error {
 	}
 	defer watcher.Close()
 
+	var configWatcher *configFileWatcher
+	if configFile := c.String("config-file"); configFile != "" {
+		klog.Infof("Watching config file %s for changes.", configFile)
+		configWatcher = newConfigFileWatcher(watcher, configFile)
+	}
+
 	klog.Info("Starting OS watcher.")
 	sigs := newOSWatcher(syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
-	var restarting bool
+	var podResources podresources.Interface
+	if socket := c.String("pod-resources-socket"); socket != "" {
+		klog.Infof("Querying device allocations from the kubelet at %s.", socket)
+		podResources = podresources.New(
+			podresources.WithSocket(socket),
+			podresources.WithResourcePrefix(spec.ResourceNamePrefix),
+		)
+	}
+
+	probes := &probes{}
+	allocations := &allocationsAPI{podResources: podResources}
+
+	// The metrics, the health probes, and the allocations API are served by
+	// the same server if they are configured with the same address.
+	handlers := make(map[string]map[string]http.Handler)
+	if address := c.String("metrics-address"); address != "" {
+		handlers[address] = map[string]http.Handler{"/metrics": metrics.Handler()}
+	}
+	if address := c.String("health-probe-address"); address != "" {
+		if handlers[address] == nil {
+			handlers[address] = make(map[string]http.Handler)
+		}
+		handlers[address]["/healthz"] = http.HandlerFunc(probes.healthz)
+		handlers[address]["/readyz"] = http.HandlerFunc(probes.readyz)
+	}
+	if address := c.String("allocations-address"); address != "" {
+		if podResources == nil {
+			return fmt.Errorf("invalid --allocations-address option: --pod-resources-socket must be set")
+		}
+		if handlers[address] == nil {
+			handlers[address] = make(map[string]http.Handler)
+		}
+		handlers[address]["/v1/allocations"] = allocations
+	}
+	for address, h := range handlers {
+		klog.Infof("Starting HTTP server on %s.", address)
+		server, err := startHTTPServer(address, h)
+		if err != nil {
+			return fmt.Errorf("failed to start HTTP server: %v", err)
+		}
+		defer server.Close()
+	}
+
+	healthReporter, err := newHealthReporter(c)
+	if err != nil {
+		return fmt.Errorf("failed to create health reporter: %v", err)
+	}
+
+	// The version of the kubelet determines whether CDI devices can be passed
+	// in the allocate response; without it, these are passed as annotations.
+	kubeletVersion, err := newKubeletVersion(c)
+	if err != nil {
+		klog.Warningf("Unable to get the kubelet version from the node: %v", err)
+	}
+
+	// The MPS control daemons are kept running when the plugins are restarted,
+	// so that running workloads keep their MPS servers, and are stopped on exit.
+	defer func() {
+		if err := mps.StopDaemons(); err != nil {
+			klog.Warningf("Failed to stop MPS control daemons: %v", err)
+		}
+	}()
+
 	var restartTimeout <-chan time.Time
 	var plugins []plugin.Interface
+	var config *spec.Config
 restart:
 	// If we are restarting, stop plugins from previous run.
-	if restarting {
+	if plugins != nil {
+		probes.reset()
+		allocations.setPlugins(nil)
 		err := stopPlugins(plugins)
 		if err != nil {
 			return fmt.Errorf("error stopping plugins from previous run: %v", err)
 		}
+		plugins, config = nil, nil
 	}
 
+reload:
 	klog.Info("Starting Plugins.")
-	plugins, restartPlugins, err := startPlugins(c, flags, restarting)
+	started, startedConfig, restartPlugins, err := startPlugins(c, flags, plugins, config, healthReporter, kubeletVersion, podResources)
+	if err != nil && len(plugins) > 0 {
+		// The running plugins are only stopped once the new plugins have been
+		// created, so these keep running with the previous config.
+		klog.Errorf("Failed to reload plugins; continuing with the previous config: %v", err)
+		goto events
+	}
 	if err != nil {
 		return fmt.Errorf("error starting plugins: %v", err)
 	}
+	plugins, config = started, startedConfig
 
+	restartTimeout = nil
 	if restartPlugins {
 		klog.Infof("Failed to start one or more plugins. Retrying in 30s...")
 		restartTimeout = time.After(30 * time.Second)
+	} else if err := mps.StopUnusedDaemons(); err != nil {
+		klog.Warningf("Failed to stop unused MPS control daemons: %v", err)
 	}
+	probes.setPlugins(plugins, restartPlugins)
+	allocations.setPlugins(plugins)
 
-	restarting = true
-
+events:
 	// Start an infinite loop, waiting for several indicators to either log
 	// some messages, trigger a restart of the plugins, or exit the program.
 	for {
 		select {
-		// If the restart timeout has expired, then restart the plugins
+		// If the restart timeout has expired, then reload the plugins,
+		// restarting those that failed to start.
 		case <-restartTimeout:
-			goto restart
+			metrics.PluginRestarts.WithLabelValues(metrics.RestartRetry).Inc()
+			goto reload
 
 		// Detect a kubelet restart by watching for a newly created
 		// 'pluginapi.KubeletSocket' file. When this occurs, restart this loop,
-		// restarting all of the plugins in the process.
+		// restarting all of the plugins in the process, since the kubelet
+		// removes their sockets and forgets their registrations.
 		case event := <-watcher.Events:
 			if event.Name == pluginapi.KubeletSocket && event.Op&fsnotify.Create == fsnotify.Create {
 				klog.Infof("inotify: %s created, restarting.", pluginapi.KubeletSocket)
+				metrics.PluginRestarts.WithLabelValues(metrics.RestartKubeletSocket).Inc()
 				goto restart
 			}
 
+			// Reload the plugins when the contents of the config file change.
+			// If the new config is invalid, keep running with the old one.
+			if configWatcher != nil && configWatcher.changed(event) {
+				klog.Infof("inotify: %s changed, validating config.", configWatcher.path)
+				if err := validateConfig(c, flags); err != nil {
+					klog.Errorf("Invalid config; continuing with the previous config: %v", err)
+					continue
+				}
+				klog.Info("Config is valid, reloading.")
+				metrics.PluginRestarts.WithLabelValues(metrics.RestartConfigFile).Inc()
+				goto reload
+			}
+
 		// Watch for any other fs errors and log them.
 		case err := <-watcher.Errors:
 			klog.Infof("inotify: %s", err)
 
-		// Watch for any signals from the OS. On SIGHUP, restart this loop,
-		// restarting all of the plugins in the process. On all other
-		// signals, exit the loop and exit the program.
+		// Watch for any signals from the OS. On SIGHUP, reload the plugins,
+		// restarting only those whose devices or config have changed. On all
+		// other signals, exit the loop and exit the program.
 		case s := <-sigs:
 			switch s {
 			case syscall.SIGHUP:
-				klog.Info("Received SIGHUP, restarting.")
-				goto restart
+				klog.Info("Received SIGHUP, reloading.")
+				metrics.PluginRestarts.WithLabelValues(metrics.RestartSIGHUP).Inc()
+				goto reload
 			default:
 				klog.Infof("Received signal \"%v\", shutting down.", s)
 				goto exit
@@ -229,45 +449,67 @@ exit:
 	return nil
 }
 
-func startPlugins(c *cli.Context, flags []cli.Flag, restarting bool) ([]plugin.Interface, bool, error) {
+// startPlugins starts the plugins for the current config in place of the running plugins.
+// Running plugins whose devices and config are unchanged are kept as is, so that their
+// resources remain advertised to the kubelet while the other plugins are restarted.
+func startPlugins(c *cli.Context, flags []cli.Flag, running []plugin.Interface, runningConfig *spec.Config, healthReporter reporter.Interface, kubeletVersion plugin.KubeletVersionFunc, podResources podresources.Interface) ([]plugin.Interface, *spec.Config, bool, error) {
 	// Load the configuration file
 	klog.Info("Loading configuration.")
 	config, err := loadConfig(c, flags)
 	if err != nil {
-		return nil, false, fmt.Errorf("unable to load config: %v", err)
+		return nil, nil, false, fmt.Errorf("unable to load config: %v", err)
 	}
-	disableResourceRenamingInConfig(config)
 
 	// Update the configuration file with default resources.
 	klog.Info("Updating config with default resource matching patterns.")
 	err = rm.AddDefaultResourcesToConfig(config)
 	if err != nil {
-		return nil, false, fmt.Errorf("unable to add default resources to config: %v", err)
+		return nil, nil, false, fmt.Errorf("unable to add default resources to config: %v", err)
 	}
 
 	// Print the config to the output.
 	configJSON, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to marshal config to JSON: %v", err)
+		return nil, nil, false, fmt.Errorf("failed to marshal config to JSON: %v", err)
 	}
 	klog.Infof("\nRunning with config:\n%v", string(configJSON))
 
 	// Get the set of plugins.
 	klog.Info("Retrieving plugins.")
-	pluginManager, err := NewPluginManager(config)
+	pluginManager, err := NewPluginManager(config, healthReporter, kubeletVersion, podResources)
 	if err != nil {
-		return nil, false, fmt.Errorf("error creating plugin manager: %v", err)
+		return nil, nil, false, fmt.Errorf("error creating plugin manager: %v", err)
+	}
+	if err := pluginManager.CreateCDISpecFile(); err != nil {
+		return nil, nil, false, fmt.Errorf("unable to create cdi spec file: %v", err)
 	}
 	plugins, err := pluginManager.GetPlugins()
 	if err != nil {
-		return nil, false, fmt.Errorf("error getting plugins: %v", err)
+		return nil, nil, false, fmt.Errorf("error getting plugins: %v", err)
+	}
+
+	// Keep the running plugins whose resources are unchanged and stop the rest.
+	unchanged := plugin.GetUnchangedPlugins(running, runningConfig, plugins, config)
+	for _, p := range running {
+		if unchanged[p.Status().Resource] != p {
+			p.Stop()
+		}
+	}
+	for i, p := range plugins {
+		if u, exists := unchanged[p.Status().Resource]; exists {
+			plugins[i] = u
+		}
 	}
 
 	// Loop through all plugins, starting them if they have any devices
 	// to serve. If even one plugin fails to start properly, try
-	// starting them all again.
-	started := 0
+	// starting the plugins that are not serving again later.
+	started := len(unchanged)
 	for _, p := range plugins {
+		if _, exists := unchanged[p.Status().Resource]; exists {
+			continue
+		}
+
 		// Just continue if there are no devices to serve for plugin p.
 		if len(p.Devices()) == 0 {
 			continue
@@ -278,7 +520,7 @@ func startPlugins(c *cli.Context, flags []cli.Flag, restarting bool) ([]plugin.I
 			klog.Error("Could not contact Kubelet. Did you enable the device plugin feature gate?")
 			klog.Error("You can check the prerequisites at: https://github.com/NVIDIA/k8s-device-plugin#prerequisites")
 			klog.Error("You can learn how to set the runtime at: https://github.com/NVIDIA/k8s-device-plugin#quick-start")
-			return plugins, true, nil
+			return plugins, config, true, nil
 		}
 		started++
 	}
@@ -287,7 +529,7 @@ func startPlugins(c *cli.Context, flags []cli.Flag, restarting bool) ([]plugin.I
 		klog.Info("No devices found. Waiting indefinitely.")
 	}
 
-	return plugins, false, nil
+	return plugins, config, false, nil
 }
 
 func stopPlugins(plugins []plugin.Interface) error {
@@ -297,41 +539,3 @@ func stopPlugins(plugins []plugin.Interface) error {
 	}
 	return nil
 }
-
-// disableResourceRenamingInConfig temporarily disable the resource renaming feature of the plugin.
-// We plan to reeenable this feature in a future release.
-func disableResourceRenamingInConfig(config *spec.Config) {
-	// Disable resource renaming through config.Resource
-	if len(config.Resources.GPUs) > 0 || len(config.Resources.MIGs) > 0 {
-		klog.Infof("Customizing the 'resources' field is not yet supported in the config. Ignoring...")
-	}
-	config.Resources.GPUs = nil
-	config.Resources.MIGs = nil
-
-	// Disable renaming / device selection in Sharing.TimeSlicing.Resources
-	renameByDefault := config.Sharing.TimeSlicing.RenameByDefault
-	setsNonDefaultRename := false
-	setsDevices := false
-	for i, r := range config.Sharing.TimeSlicing.Resources {
-		if !renameByDefault && r.Rename != "" {
-			setsNonDefaultRename = true
-			config.Sharing.TimeSlicing.Resources[i].Rename = ""
-		}
-		if renameByDefault && r.Rename != r.Name.DefaultSharedRename() {
-			setsNonDefaultRename = true
-			config.Sharing.TimeSlicing.Resources[i].Rename = r.Name.DefaultSharedRename()
-		}
-		if !r.Devices.All {
-			setsDevices = true
-			config.Sharing.TimeSlicing.Resources[i].Devices.All = true
-			config.Sharing.TimeSlicing.Resources[i].Devices.Count = 0
-			config.Sharing.TimeSlicing.Resources[i].Devices.List = nil
-		}
-	}
-	if setsNonDefaultRename {
-		klog.Warning("Setting the 'rename' field in sharing.timeSlicing.resources is not yet supported in the config. Ignoring...")
-	}
-	if setsDevices {
-		klog.Warning("Customizing the 'devices' field in sharing.timeSlicing.resources is not yet supported in the config. Ignoring...")
-	}
-}
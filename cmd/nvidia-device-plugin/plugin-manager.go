@@ -21,12 +21,15 @@ import (
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
 	"github.com/NVIDIA/k8s-device-plugin/internal/cdi"
+	"github.com/NVIDIA/k8s-device-plugin/internal/plugin"
 	"github.com/NVIDIA/k8s-device-plugin/internal/plugin/manager"
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+	"github.com/NVIDIA/k8s-device-plugin/internal/reporter"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
 )
 
 // NewPluginManager creates an NVML-based plugin manager
-func NewPluginManager(config *spec.Config) (manager.Interface, error) {
+func NewPluginManager(config *spec.Config, healthReporter reporter.Interface, kubeletVersion plugin.KubeletVersionFunc, podResources podresources.Interface) (manager.Interface, error) {
 	var err error
 	switch *config.Flags.MigStrategy {
 	case spec.MigStrategyNone:
@@ -67,14 +70,13 @@ func NewPluginManager(config *spec.Config) (manager.Interface, error) {
 		manager.WithConfig(config),
 		manager.WithFailOnInitError(*config.Flags.FailOnInitError),
 		manager.WithMigStrategy(*config.Flags.MigStrategy),
+		manager.WithHealthReporter(healthReporter),
+		manager.WithKubeletVersion(kubeletVersion),
+		manager.WithPodResources(podResources),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create plugin manager: %v", err)
 	}
 
-	if err := m.CreateCDISpecFile(); err != nil {
-		return nil, fmt.Errorf("unable to create cdi spec file: %v", err)
-	}
-
 	return m, nil
 }
@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/plugin"
+)
+
+// probes tracks the plugins started by the start() loop and serves their status as liveness and readiness probes.
+type probes struct {
+	sync.Mutex
+	plugins  []plugin.Interface
+	started  bool
+	retrying bool
+}
+
+// probeResponse is the body returned by the probe handlers.
+type probeResponse struct {
+	Ready   bool            `json:"ready"`
+	Alive   bool            `json:"alive"`
+	Message string          `json:"message,omitempty"`
+	Plugins []plugin.Status `json:"plugins"`
+}
+
+// setPlugins updates the set of plugins after they have been (re)started.
+// If retrying is set, one or more plugins failed to start and a restart is pending.
+func (p *probes) setPlugins(plugins []plugin.Interface, retrying bool) {
+	p.Lock()
+	defer p.Unlock()
+	p.plugins = plugins
+	p.started = true
+	p.retrying = retrying
+}
+
+// reset clears the set of plugins while they are being restarted.
+func (p *probes) reset() {
+	p.Lock()
+	defer p.Unlock()
+	p.plugins = nil
+	p.started = false
+	p.retrying = false
+}
+
+// check returns the status of the plugins that have devices to serve.
+// A plugin is alive as long as it is serving, and ready once it is also registered
+// with the kubelet. Since a plugin keeps serving with health checks disabled if
+// these stop with an error (e.g. if NVML events are not supported), such errors
+// are only reported in the status of the plugin.
+func (p *probes) check() probeResponse {
+	p.Lock()
+	defer p.Unlock()
+
+	response := probeResponse{
+		Ready:   true,
+		Alive:   true,
+		Plugins: []plugin.Status{},
+	}
+
+	if !p.started {
+		response.Ready = false
+		response.Message = "plugins are being started"
+		return response
+	}
+
+	if p.retrying {
+		response.Ready = false
+		response.Message = "failed to start one or more plugins; retrying"
+	}
+
+	for _, pl := range p.plugins {
+		if len(pl.Devices()) == 0 {
+			continue
+		}
+		status := pl.Status()
+		response.Plugins = append(response.Plugins, status)
+
+		if !status.Serving || !status.Registered {
+			response.Ready = false
+		}
+		if p.retrying {
+			continue
+		}
+		if !status.Serving {
+			response.Alive = false
+			response.Message = fmt.Sprintf("plugin for '%s' is not serving", status.Resource)
+		}
+	}
+
+	if len(response.Plugins) == 0 && response.Message == "" {
+		response.Ready = false
+		response.Message = "no devices found"
+	}
+
+	return response
+}
+
+// healthz serves the liveness of the plugins.
+func (p *probes) healthz(w http.ResponseWriter, r *http.Request) {
+	response := p.check()
+	writeProbeResponse(w, response, response.Alive)
+}
+
+// readyz serves the readiness of the plugins.
+func (p *probes) readyz(w http.ResponseWriter, r *http.Request) {
+	response := p.check()
+	writeProbeResponse(w, response, response.Ready)
+}
+
+func writeProbeResponse(w http.ResponseWriter, response probeResponse, ok bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/reporter"
+	cli "github.com/urfave/cli/v2"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// newHealthReporter creates the reporter used to report the health of devices to the Kubernetes API.
+// If health reporting is not enabled, a reporter that does nothing is returned.
+func newHealthReporter(c *cli.Context) (reporter.Interface, error) {
+	if !c.Bool("report-health") {
+		return reporter.NewNullReporter(), nil
+	}
+
+	nodeName := c.String("node-name")
+	if nodeName == "" {
+		return nil, fmt.Errorf("invalid --node-name option: must be set if --report-health is enabled")
+	}
+
+	clientset, err := newClientset(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return reporter.New(
+		reporter.WithClient(clientset),
+		reporter.WithNodeName(nodeName),
+	)
+}
+
+// newClientset creates a clientset for the Kubernetes API from the <kubeconfig> option.
+// If it is not set, the in-cluster config is used.
+func newClientset(c *cli.Context) (kubernetes.Interface, error) {
+	kubeconfig, err := clientcmd.BuildConfigFromFlags("", c.String("kubeconfig"))
+	if err != nil {
+		return nil, fmt.Errorf("error building kubernetes clientcmd config: %v", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("error building kubernetes clientset from config: %v", err)
+	}
+	return clientset, nil
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	cli "github.com/urfave/cli/v2"
+)
+
+// newValidateCommand creates the 'validate' subcommand, which checks a config
+// file offline, without access to any GPUs or to the kubelet.
+func newValidateCommand(flags []cli.Flag) *cli.Command {
+	return &cli.Command{
+		Name:  "validate",
+		Usage: "validate a config file without starting the plugin",
+		Description: "Parses the config file, applies any command line options or environment variables\n" +
+			"given to the plugin itself, and validates the result. If a mock topology is given, the\n" +
+			"resources and sharing settings of the config are also applied to the devices it describes.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "config-file",
+				Usage:    "the path to the config file to validate",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "mock-topology",
+				Usage: "the path to a file describing the GPUs and MIG devices to validate the config against",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return validate(c, flags)
+		},
+	}
+}
+
+func validate(c *cli.Context, flags []cli.Flag) error {
+	config, err := loadConfig(c, flags)
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+
+	topologyFile := c.String("mock-topology")
+	if topologyFile == "" {
+		err = rm.AddDefaultResourcesToConfig(config)
+		if err != nil {
+			return fmt.Errorf("invalid config: unable to add default resources to config: %v", err)
+		}
+		fmt.Fprintf(c.App.Writer, "Config %s is valid\n", c.String("config-file"))
+		return nil
+	}
+
+	topology, err := rm.ParseTopology(topologyFile)
+	if err != nil {
+		return err
+	}
+	err = topology.AddDefaultResourcesToConfig(config)
+	if err != nil {
+		return fmt.Errorf("invalid config: unable to add default resources to config: %v", err)
+	}
+
+	deviceMap, err := rm.NewDeviceMapFromTopology(topology, config)
+	if err != nil {
+		return fmt.Errorf("invalid config for topology %s: %v", topologyFile, err)
+	}
+
+	var names []string
+	for name := range deviceMap {
+		_, err := spec.NewResourceName(string(name))
+		if err != nil {
+			return fmt.Errorf("invalid config for topology %s: %v", topologyFile, err)
+		}
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(c.App.Writer, "Config %s is valid for topology %s\n", c.String("config-file"), topologyFile)
+	for _, name := range names {
+		fmt.Fprintf(c.App.Writer, "  %s: %d devices\n", name, len(deviceMap[spec.ResourceName(name)]))
+	}
+	return nil
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
-	"github.com/fsnotify/fsnotify"
+	"bytes"
 	"os"
 	"os/signal"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/klog/v2"
 )
 
 func newFSWatcher(files ...string) (*fsnotify.Watcher, error) {
@@ -29,3 +33,69 @@ func newOSWatcher(sigs ...os.Signal) chan os.Signal {
 
 	return sigChan
 }
+
+// configFileWatcher detects changes to the contents of a config file from the
+// events of an fsnotify watcher. Since the config file is typically a symlink
+// (e.g. into a ConfigMap volume), the directories of every link along the way
+// to the file are watched so that retargeting any of the links is detected.
+type configFileWatcher struct {
+	path     string
+	watcher  *fsnotify.Watcher
+	dirs     map[string]bool
+	contents []byte
+}
+
+func newConfigFileWatcher(watcher *fsnotify.Watcher, path string) *configFileWatcher {
+	w := &configFileWatcher{
+		path:    path,
+		watcher: watcher,
+		dirs:    make(map[string]bool),
+	}
+	w.contents, _ = os.ReadFile(path)
+	w.addWatches()
+	return w
+}
+
+// changed checks whether the contents of the config file have changed in response to an event.
+func (w *configFileWatcher) changed(event fsnotify.Event) bool {
+	if !w.dirs[filepath.Dir(event.Name)] {
+		return false
+	}
+	w.addWatches()
+
+	contents, err := os.ReadFile(w.path)
+	if err != nil {
+		// The file may briefly not exist while a symlink is being retargeted.
+		klog.V(4).Infof("Unable to read config file %s: %v", w.path, err)
+		return false
+	}
+	if bytes.Equal(contents, w.contents) {
+		return false
+	}
+	w.contents = contents
+	return true
+}
+
+// addWatches adds the directories of the config file and of each link it resolves through to the watcher.
+func (w *configFileWatcher) addWatches() {
+	path := w.path
+	for i := 0; i < 255; i++ {
+		dir := filepath.Dir(path)
+		if !w.dirs[dir] {
+			if err := w.watcher.Add(dir); err != nil {
+				klog.Warningf("Unable to watch %s for config file changes: %v", dir, err)
+			} else {
+				w.dirs[dir] = true
+			}
+		}
+
+		target, err := os.Readlink(path)
+		if err != nil {
+			return
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dir, target)
+		}
+		path = target
+	}
+}
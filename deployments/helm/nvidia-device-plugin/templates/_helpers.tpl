@@ -93,7 +93,7 @@ Security context for the plugin
 {{ toYaml .Values.securityContext }}
 {{- else if .Values.compatWithCPUManager -}}
 privileged: true
-{{- else if ne (include "nvidia-device-plugin.allPossibleMigStrategiesAreNone" .) "true" -}}
+{{- else if or .Values.mps.enabled (ne (include "nvidia-device-plugin.allPossibleMigStrategiesAreNone" .) "true") -}}
 capabilities:
   add:
     - SYS_ADMIN
@@ -167,6 +167,37 @@ Check if there is a ConfigMap in use or not
 {{- $result -}}
 {{- end }}
 
+{{/*
+Check if a service account is required to access the Kubernetes API or not
+*/}}
+{{- define "nvidia-device-plugin.requiresServiceAccount" -}}
+{{- $result := false -}}
+{{- if eq (include "nvidia-device-plugin.hasConfigMap" .) "true" -}}
+  {{- $result = true -}}
+{{- end -}}
+{{- if eq (toString .Values.reportHealth) "true" -}}
+  {{- $result = true -}}
+{{- end -}}
+{{- if .Values.migManager.enabled -}}
+  {{- $result = true -}}
+{{- end -}}
+{{- if contains "cdi-cri" (toString .Values.deviceListStrategy) -}}
+  {{- $result = true -}}
+{{- end -}}
+{{- $result -}}
+{{- end }}
+
+{{/*
+Get the name of the ConfigMap holding the MIG configs
+*/}}
+{{- define "nvidia-device-plugin.migConfigMapName" -}}
+{{- if .Values.migManager.configMapName -}}
+{{ .Values.migManager.configMapName }}
+{{- else -}}
+{{ include "nvidia-device-plugin.fullname" . }}-mig-configs
+{{- end -}}
+{{- end }}
+
 {{/*
 Get the name of the default configuration
 */}}
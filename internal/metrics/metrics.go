@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "nvidia_device_plugin"
+
+// Reasons for which an Allocate request can fail.
+const (
+	AllocationFailureRequestTooLarge = "request-too-large"
+	AllocationFailureUnknownDevice   = "unknown-device"
+	AllocationFailureResponseError   = "response-error"
+)
+
+// Checks that can fail before a container is started.
+const (
+	PreStartCheckUnknownDevice   = "unknown-device"
+	PreStartCheckUnhealthyDevice = "unhealthy-device"
+	PreStartCheckDeviceNode      = "device-node"
+	PreStartCheckMigCapability   = "mig-capability"
+)
+
+// Triggers for restarting the plugins.
+const (
+	RestartKubeletSocket = "kubelet-socket"
+	RestartSIGHUP        = "sighup"
+	RestartRetry         = "retry"
+	RestartConfigFile    = "config-file"
+)
+
+// Registry is the registry that holds the metrics of the device plugin process.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// DevicesAdvertised is the number of devices advertised to the kubelet for each resource.
+	DevicesAdvertised = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "devices_advertised",
+			Help:      "Number of devices advertised to the kubelet.",
+		},
+		[]string{"resource"},
+	)
+	// DevicesHealthy is the number of healthy devices for each resource.
+	DevicesHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "devices_healthy",
+			Help:      "Number of healthy devices advertised to the kubelet.",
+		},
+		[]string{"resource"},
+	)
+	// DevicesUnhealthy is the number of unhealthy devices for each resource.
+	DevicesUnhealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "devices_unhealthy",
+			Help:      "Number of unhealthy devices advertised to the kubelet.",
+		},
+		[]string{"resource"},
+	)
+
+	// AllocateRequests is the number of Allocate calls for each resource.
+	AllocateRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "allocate_requests_total",
+			Help:      "Number of Allocate calls received from the kubelet.",
+		},
+		[]string{"resource"},
+	)
+	// AllocateDuration is the latency of Allocate calls for each resource.
+	AllocateDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "allocate_duration_seconds",
+			Help:      "Latency of Allocate calls in seconds.",
+		},
+		[]string{"resource"},
+	)
+	// AllocationFailures is the number of failed Allocate calls for each resource and reason.
+	AllocationFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "allocation_failures_total",
+			Help:      "Number of Allocate calls that failed, by reason.",
+		},
+		[]string{"resource", "reason"},
+	)
+
+	// PreStartCheckFailures is the number of failed PreStartContainer calls for each resource and check.
+	PreStartCheckFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "pre_start_check_failures_total",
+			Help:      "Number of PreStartContainer calls that failed, by check.",
+		},
+		[]string{"resource", "check"},
+	)
+
+	// PreferredAllocationRequests is the number of GetPreferredAllocation calls for each resource.
+	PreferredAllocationRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "preferred_allocation_requests_total",
+			Help:      "Number of GetPreferredAllocation calls received from the kubelet.",
+		},
+		[]string{"resource"},
+	)
+	// PreferredAllocationDuration is the latency of GetPreferredAllocation calls for each resource.
+	PreferredAllocationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "preferred_allocation_duration_seconds",
+			Help:      "Latency of GetPreferredAllocation calls in seconds.",
+		},
+		[]string{"resource"},
+	)
+
+	// XidEvents is the number of Xid events seen for each resource and Xid.
+	XidEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "xid_events_total",
+			Help:      "Number of Xid events seen on the devices of a resource, by Xid.",
+		},
+		[]string{"resource", "xid"},
+	)
+
+	// PluginRestarts is the number of times the plugins were restarted, by trigger.
+	PluginRestarts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "restarts_total",
+			Help:      "Number of times the plugins were restarted, by trigger.",
+		},
+		[]string{"trigger"},
+	)
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		DevicesAdvertised,
+		DevicesHealthy,
+		DevicesUnhealthy,
+		AllocateRequests,
+		AllocateDuration,
+		AllocationFailures,
+		PreStartCheckFailures,
+		PreferredAllocationRequests,
+		PreferredAllocationDuration,
+		XidEvents,
+		PluginRestarts,
+	)
+}
+
+// Handler returns the http.Handler that serves the metrics of the Registry.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mig
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Version indicates the version of the MIG configuration file format.
+const Version = "v1"
+
+// Spec holds a set of named MIG configurations. Each configuration defines a
+// MIG layout for the devices on a node and is selected by its name.
+type Spec struct {
+	Version    string                     `json:"version"     yaml:"version"`
+	MigConfigs map[string][]MigConfigSpec `json:"mig-configs" yaml:"mig-configs"`
+}
+
+// MigConfigSpec defines the MIG layout of a set of devices.
+type MigConfigSpec struct {
+	Devices    DeviceSelector `json:"devices"               yaml:"devices,flow"`
+	MigEnabled bool           `json:"mig-enabled"           yaml:"mig-enabled"`
+	MigDevices map[string]int `json:"mig-devices,omitempty" yaml:"mig-devices,omitempty"`
+}
+
+// DeviceSelector selects the devices that a MigConfigSpec applies to.
+// It can be set to 'all' or to a list of device indices.
+type DeviceSelector struct {
+	All     bool
+	Indices []int
+}
+
+// ParseSpec parses a MIG configuration file as either YAML or JSON.
+func ParseSpec(path string) (*Spec, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading MIG config file: %v", err)
+	}
+
+	var spec Spec
+	err = yaml.Unmarshal(contents, &spec)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing MIG config file: %v", err)
+	}
+
+	if spec.Version != Version {
+		return nil, fmt.Errorf("unknown version: %v", spec.Version)
+	}
+	if len(spec.MigConfigs) == 0 {
+		return nil, fmt.Errorf("no MIG configs specified")
+	}
+
+	return &spec, nil
+}
+
+// Get returns the MIG config with the specified name.
+func (s *Spec) Get(name string) ([]MigConfigSpec, error) {
+	config, exists := s.MigConfigs[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown MIG config: %v", name)
+	}
+	return config, nil
+}
+
+// UnmarshalJSON unmarshals raw bytes into a 'MigConfigSpec' struct.
+func (m *MigConfigSpec) UnmarshalJSON(b []byte) error {
+	type migConfigSpec MigConfigSpec
+	var spec migConfigSpec
+	err := json.Unmarshal(b, &spec)
+	if err != nil {
+		return err
+	}
+
+	if !spec.Devices.All && len(spec.Devices.Indices) == 0 {
+		return fmt.Errorf("no devices specified")
+	}
+	if !spec.MigEnabled && len(spec.MigDevices) > 0 {
+		return fmt.Errorf("MIG devices specified with MIG disabled")
+	}
+	for profile, count := range spec.MigDevices {
+		if count < 0 {
+			return fmt.Errorf("invalid count for MIG profile %v: %v", profile, count)
+		}
+	}
+
+	*m = MigConfigSpec(spec)
+	return nil
+}
+
+// UnmarshalJSON unmarshals raw bytes into a 'DeviceSelector' struct.
+func (d *DeviceSelector) UnmarshalJSON(b []byte) error {
+	var all string
+	if err := json.Unmarshal(b, &all); err == nil {
+		if all != "all" {
+			return fmt.Errorf("unrecognized devices value: %v", all)
+		}
+		*d = DeviceSelector{All: true}
+		return nil
+	}
+
+	var indices []int
+	if err := json.Unmarshal(b, &indices); err != nil {
+		return fmt.Errorf("unrecognized devices value: %v", string(b))
+	}
+	for _, i := range indices {
+		if i < 0 {
+			return fmt.Errorf("invalid device index: %v", i)
+		}
+	}
+	*d = DeviceSelector{Indices: indices}
+	return nil
+}
+
+// MarshalJSON marshals a 'DeviceSelector' struct into raw bytes.
+func (d DeviceSelector) MarshalJSON() ([]byte, error) {
+	if d.All {
+		return json.Marshal("all")
+	}
+	return json.Marshal(d.Indices)
+}
+
+// Selects checks whether the device with the specified index is selected.
+func (d DeviceSelector) Selects(index int) bool {
+	if d.All {
+		return true
+	}
+	for _, i := range d.Indices {
+		if i == index {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpec(t *testing.T) {
+	testCases := []struct {
+		description   string
+		contents      string
+		expectedError bool
+		expectedSpec  *Spec
+	}{
+		{
+			description: "valid spec",
+			contents: `
+version: v1
+mig-configs:
+  all-disabled:
+    - devices: all
+      mig-enabled: false
+  mixed:
+    - devices: [0, 1]
+      mig-enabled: true
+      mig-devices:
+        "1g.5gb": 3
+        "3g.20gb": 1
+    - devices: [2]
+      mig-enabled: false
+`,
+			expectedSpec: &Spec{
+				Version: "v1",
+				MigConfigs: map[string][]MigConfigSpec{
+					"all-disabled": {
+						{Devices: DeviceSelector{All: true}},
+					},
+					"mixed": {
+						{
+							Devices:    DeviceSelector{Indices: []int{0, 1}},
+							MigEnabled: true,
+							MigDevices: map[string]int{"1g.5gb": 3, "3g.20gb": 1},
+						},
+						{Devices: DeviceSelector{Indices: []int{2}}},
+					},
+				},
+			},
+		},
+		{
+			description: "unknown version",
+			contents: `
+version: v2
+mig-configs:
+  all-disabled:
+    - devices: all
+`,
+			expectedError: true,
+		},
+		{
+			description:   "no configs",
+			contents:      "version: v1\n",
+			expectedError: true,
+		},
+		{
+			description: "invalid devices",
+			contents: `
+version: v1
+mig-configs:
+  bad:
+    - devices: some
+`,
+			expectedError: true,
+		},
+		{
+			description: "no devices",
+			contents: `
+version: v1
+mig-configs:
+  bad:
+    - mig-enabled: false
+`,
+			expectedError: true,
+		},
+		{
+			description: "MIG devices with MIG disabled",
+			contents: `
+version: v1
+mig-configs:
+  bad:
+    - devices: all
+      mig-enabled: false
+      mig-devices:
+        "1g.5gb": 7
+`,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.contents), 0644))
+
+			spec, err := ParseSpec(path)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedSpec, spec)
+		})
+	}
+}
@@ -0,0 +1,476 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mig
+
+import (
+	"fmt"
+	"sort"
+
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvlib/device"
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
+	"k8s.io/klog/v2"
+)
+
+type manager struct {
+	nvmllib   nvml.Interface
+	devicelib device.Interface
+}
+
+var _ Interface = &manager{}
+
+// migDeviceRequest is a request for a number of MIG devices with the same profile.
+type migDeviceRequest struct {
+	profile device.MigProfileInfo
+	count   int
+}
+
+// gpuInstanceLayout describes a GPU instance and the compute instances created in it.
+type gpuInstanceLayout struct {
+	profile          int
+	placement        nvml.GpuInstancePlacement
+	computeInstances []computeInstanceProfile
+}
+
+// computeInstanceProfile identifies the profile of a compute instance within a GPU instance.
+type computeInstanceProfile struct {
+	profile    int
+	engProfile int
+}
+
+// RestoreError is returned by Apply if the MIG devices of a config could not be created
+// and the MIG devices that existed before could not be restored either. The MIG devices
+// of the GPU are then in an unknown state.
+type RestoreError struct {
+	Index      int
+	ApplyErr   error
+	RestoreErr error
+}
+
+func (e *RestoreError) Error() string {
+	return fmt.Sprintf("error creating MIG devices on GPU %d: %v; error restoring previous MIG devices: %v", e.Index, e.ApplyErr, e.RestoreErr)
+}
+
+// New creates a new instance of the 'mig' interface
+func New(opts ...Option) Interface {
+	m := &manager{}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.nvmllib == nil {
+		m.nvmllib = nvml.New()
+	}
+	if m.devicelib == nil {
+		m.devicelib = device.New(device.WithNvml(m.nvmllib))
+	}
+	return m
+}
+
+// Apply applies the specified MIG config to the devices on the node.
+// For each selected device, MIG mode is enabled or disabled as required. If
+// MIG mode is enabled, the placement of the MIG devices of the config is
+// computed first, so that a config that does not fit leaves the device
+// unchanged. All existing GPU and compute instances are then destroyed and
+// the MIG devices of the config are created in their place. If creating them
+// fails, the previous GPU and compute instances are restored.
+func (m *manager) Apply(config []MigConfigSpec) error {
+	ret := m.nvmllib.Init()
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("failed to initialize NVML: %v", ret)
+	}
+	defer func() {
+		ret := m.nvmllib.Shutdown()
+		if ret != nvml.SUCCESS {
+			klog.Infof("Error shutting down NVML: %v", ret)
+		}
+	}()
+
+	count, ret := m.nvmllib.DeviceGetCount()
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("error getting device count: %v", ret)
+	}
+
+	for i := 0; i < count; i++ {
+		spec, err := selectSpec(config, i)
+		if err != nil {
+			return err
+		}
+		if spec == nil {
+			klog.Infof("No MIG config for GPU %d; leaving it unchanged", i)
+			continue
+		}
+
+		dev, ret := m.nvmllib.DeviceGetHandleByIndex(i)
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("error getting device handle for GPU %d: %v", i, ret)
+		}
+
+		err = setMigMode(i, dev, spec.MigEnabled)
+		if err != nil {
+			return err
+		}
+		if !spec.MigEnabled {
+			continue
+		}
+
+		requests, err := m.resolveMigDevices(i, dev, spec.MigDevices)
+		if err != nil {
+			return err
+		}
+		layout, err := planMigDevices(dev, requests)
+		if err != nil {
+			return fmt.Errorf("error placing MIG devices on GPU %d: %v", i, err)
+		}
+		previous, err := getMigDevices(dev)
+		if err != nil {
+			return fmt.Errorf("error getting MIG devices on GPU %d: %v", i, err)
+		}
+		err = replaceMigDevices(i, dev, previous, layout)
+		if err != nil {
+			return err
+		}
+		klog.Infof("Applied MIG config to GPU %d: %v", i, spec.MigDevices)
+	}
+
+	return nil
+}
+
+// selectSpec returns the spec that selects the device with the specified index.
+func selectSpec(config []MigConfigSpec, index int) (*MigConfigSpec, error) {
+	var selected *MigConfigSpec
+	for i := range config {
+		if !config[i].Devices.Selects(index) {
+			continue
+		}
+		if selected != nil {
+			return nil, fmt.Errorf("GPU %d is selected by more than one MIG config entry", index)
+		}
+		selected = &config[i]
+	}
+	return selected, nil
+}
+
+// setMigMode enables or disables MIG mode on a device.
+func setMigMode(index int, dev nvml.Device, enabled bool) error {
+	mode := nvml.DEVICE_MIG_DISABLE
+	if enabled {
+		mode = nvml.DEVICE_MIG_ENABLE
+	}
+
+	current, _, ret := dev.GetMigMode()
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		if enabled {
+			return fmt.Errorf("MIG is not supported on GPU %d", index)
+		}
+		return nil
+	}
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("error getting MIG mode of GPU %d: %v", index, ret)
+	}
+	if current == mode {
+		return nil
+	}
+
+	klog.Infof("Setting MIG mode of GPU %d to %v", index, mode)
+	_, ret = dev.SetMigMode(mode)
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("error setting MIG mode of GPU %d: %v", index, ret)
+	}
+
+	current, _, ret = dev.GetMigMode()
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("error getting MIG mode of GPU %d: %v", index, ret)
+	}
+	if current != mode {
+		return fmt.Errorf("MIG mode change of GPU %d is pending a GPU reset", index)
+	}
+	return nil
+}
+
+// resolveMigDevices resolves the profiles of the requested MIG devices against the
+// profiles supported by the device. The requests are sorted from the largest to the
+// smallest profile so that the largest GPU and compute instances are placed first.
+func (m *manager) resolveMigDevices(index int, dev nvml.Device, migDevices map[string]int) ([]migDeviceRequest, error) {
+	d, err := m.devicelib.NewDevice(dev)
+	if err != nil {
+		return nil, fmt.Errorf("error creating device wrapper for GPU %d: %v", index, err)
+	}
+	profiles, err := d.GetMigProfiles()
+	if err != nil {
+		return nil, fmt.Errorf("error getting MIG profiles of GPU %d: %v", index, err)
+	}
+
+	var requests []migDeviceRequest
+	for name, count := range migDevices {
+		if count == 0 {
+			continue
+		}
+		var profile device.MigProfile
+		for _, p := range profiles {
+			if p.Matches(name) {
+				profile = p
+				break
+			}
+		}
+		if profile == nil {
+			return nil, fmt.Errorf("MIG profile %v is not supported on GPU %d", name, index)
+		}
+		requests = append(requests, migDeviceRequest{profile: profile.GetInfo(), count: count})
+	}
+
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].profile.G != requests[j].profile.G {
+			return requests[i].profile.G > requests[j].profile.G
+		}
+		if requests[i].profile.C != requests[j].profile.C {
+			return requests[i].profile.C > requests[j].profile.C
+		}
+		return requests[i].profile.String() < requests[j].profile.String()
+	})
+
+	return requests, nil
+}
+
+// destroyMigDevices destroys all compute instances and GPU instances on a device.
+func destroyMigDevices(dev nvml.Device) error {
+	for p := 0; p < nvml.GPU_INSTANCE_PROFILE_COUNT; p++ {
+		info, ret := dev.GetGpuInstanceProfileInfo(p)
+		if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_INVALID_ARGUMENT {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("error getting GPU instance profile info: %v", ret)
+		}
+
+		gis, ret := dev.GetGpuInstances(&info)
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("error getting GPU instances: %v", ret)
+		}
+		for _, gi := range gis {
+			err := destroyComputeInstances(gi)
+			if err != nil {
+				return err
+			}
+			ret := gi.Destroy()
+			if ret != nvml.SUCCESS {
+				return fmt.Errorf("error destroying GPU instance: %v", ret)
+			}
+		}
+	}
+	return nil
+}
+
+// destroyComputeInstances destroys all compute instances in a GPU instance.
+func destroyComputeInstances(gi nvml.GpuInstance) error {
+	for p := 0; p < nvml.COMPUTE_INSTANCE_PROFILE_COUNT; p++ {
+		for e := 0; e < nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_COUNT; e++ {
+			info, ret := gi.GetComputeInstanceProfileInfo(p, e)
+			if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_INVALID_ARGUMENT {
+				continue
+			}
+			if ret != nvml.SUCCESS {
+				return fmt.Errorf("error getting compute instance profile info: %v", ret)
+			}
+
+			cis, ret := gi.GetComputeInstances(&info)
+			if ret != nvml.SUCCESS {
+				return fmt.Errorf("error getting compute instances: %v", ret)
+			}
+			for _, ci := range cis {
+				ret := ci.Destroy()
+				if ret != nvml.SUCCESS {
+					return fmt.Errorf("error destroying compute instance: %v", ret)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// planMigDevices computes the GPU and compute instances to create for the requested MIG devices
+// without changing the device. The compute instances of each GPU instance profile are packed
+// into as few GPU instances as possible, so that MIG devices such as 1c.3g.20gb share a GPU
+// instance. Each GPU instance is placed at the first possible placement that does not overlap
+// with the GPU instances placed before it.
+func planMigDevices(dev nvml.Device, requests []migDeviceRequest) ([]gpuInstanceLayout, error) {
+	type gpuInstance struct {
+		layout gpuInstanceLayout
+		free   int
+	}
+	var gis []*gpuInstance
+	for _, r := range requests {
+		for i := 0; i < r.count; i++ {
+			ci := computeInstanceProfile{profile: r.profile.CIProfileID, engProfile: r.profile.CIEngProfileID}
+			var parent *gpuInstance
+			for _, gi := range gis {
+				if gi.layout.profile == r.profile.GIProfileID && gi.free >= r.profile.C {
+					parent = gi
+					break
+				}
+			}
+			if parent == nil {
+				parent = &gpuInstance{layout: gpuInstanceLayout{profile: r.profile.GIProfileID}, free: r.profile.G}
+				gis = append(gis, parent)
+			}
+			parent.layout.computeInstances = append(parent.layout.computeInstances, ci)
+			parent.free -= r.profile.C
+		}
+	}
+
+	var used []nvml.GpuInstancePlacement
+	overlaps := func(p nvml.GpuInstancePlacement) bool {
+		for _, u := range used {
+			if p.Start < u.Start+u.Size && u.Start < p.Start+p.Size {
+				return true
+			}
+		}
+		return false
+	}
+
+	var layout []gpuInstanceLayout
+	for _, gi := range gis {
+		giInfo, ret := dev.GetGpuInstanceProfileInfo(gi.layout.profile)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("error getting GPU instance profile info for profile %d: %v", gi.layout.profile, ret)
+		}
+		placements, ret := dev.GetGpuInstancePossiblePlacements(&giInfo)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("error getting possible placements for profile %d: %v", gi.layout.profile, ret)
+		}
+
+		var placement *nvml.GpuInstancePlacement
+		for j := range placements {
+			if !overlaps(placements[j]) {
+				placement = &placements[j]
+				break
+			}
+		}
+		if placement == nil {
+			return nil, fmt.Errorf("no room left for GPU instance %d of profile %d", len(layout)+1, gi.layout.profile)
+		}
+		used = append(used, *placement)
+
+		gi.layout.placement = *placement
+		layout = append(layout, gi.layout)
+	}
+	return layout, nil
+}
+
+// getMigDevices returns the layout of the existing GPU and compute instances on a device.
+func getMigDevices(dev nvml.Device) ([]gpuInstanceLayout, error) {
+	var layout []gpuInstanceLayout
+	for p := 0; p < nvml.GPU_INSTANCE_PROFILE_COUNT; p++ {
+		info, ret := dev.GetGpuInstanceProfileInfo(p)
+		if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_INVALID_ARGUMENT {
+			continue
+		}
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("error getting GPU instance profile info: %v", ret)
+		}
+
+		gis, ret := dev.GetGpuInstances(&info)
+		if ret != nvml.SUCCESS {
+			return nil, fmt.Errorf("error getting GPU instances: %v", ret)
+		}
+		for _, gi := range gis {
+			giInfo, ret := gi.GetInfo()
+			if ret != nvml.SUCCESS {
+				return nil, fmt.Errorf("error getting GPU instance info: %v", ret)
+			}
+			cis, err := getComputeInstances(gi)
+			if err != nil {
+				return nil, err
+			}
+			layout = append(layout, gpuInstanceLayout{profile: p, placement: giInfo.Placement, computeInstances: cis})
+		}
+	}
+	return layout, nil
+}
+
+// getComputeInstances returns the profiles of the existing compute instances in a GPU instance.
+func getComputeInstances(gi nvml.GpuInstance) ([]computeInstanceProfile, error) {
+	var profiles []computeInstanceProfile
+	for p := 0; p < nvml.COMPUTE_INSTANCE_PROFILE_COUNT; p++ {
+		for e := 0; e < nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_COUNT; e++ {
+			info, ret := gi.GetComputeInstanceProfileInfo(p, e)
+			if ret == nvml.ERROR_NOT_SUPPORTED || ret == nvml.ERROR_INVALID_ARGUMENT {
+				continue
+			}
+			if ret != nvml.SUCCESS {
+				return nil, fmt.Errorf("error getting compute instance profile info: %v", ret)
+			}
+
+			cis, ret := gi.GetComputeInstances(&info)
+			if ret != nvml.SUCCESS {
+				return nil, fmt.Errorf("error getting compute instances: %v", ret)
+			}
+			for range cis {
+				profiles = append(profiles, computeInstanceProfile{profile: p, engProfile: e})
+			}
+		}
+	}
+	return profiles, nil
+}
+
+// replaceMigDevices replaces the existing MIG devices of a device with the specified layout.
+// If the new layout cannot be created, the previous layout is restored.
+func replaceMigDevices(index int, dev nvml.Device, previous []gpuInstanceLayout, layout []gpuInstanceLayout) error {
+	err := destroyMigDevices(dev)
+	if err != nil {
+		return fmt.Errorf("error destroying MIG devices on GPU %d: %v", index, err)
+	}
+	err = createMigDevices(dev, layout)
+	if err == nil {
+		return nil
+	}
+
+	klog.Errorf("Error creating MIG devices on GPU %d: %v; restoring previous MIG devices", index, err)
+	restoreErr := destroyMigDevices(dev)
+	if restoreErr == nil {
+		restoreErr = createMigDevices(dev, previous)
+	}
+	if restoreErr != nil {
+		return &RestoreError{Index: index, ApplyErr: err, RestoreErr: restoreErr}
+	}
+	return fmt.Errorf("error creating MIG devices on GPU %d: %v; previous MIG devices were restored", index, err)
+}
+
+// createMigDevices creates the GPU and compute instances of a layout.
+func createMigDevices(dev nvml.Device, layout []gpuInstanceLayout) error {
+	for _, l := range layout {
+		giInfo, ret := dev.GetGpuInstanceProfileInfo(l.profile)
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("error getting GPU instance profile info for profile %d: %v", l.profile, ret)
+		}
+		placement := l.placement
+		gi, ret := dev.CreateGpuInstanceWithPlacement(&giInfo, &placement)
+		if ret != nvml.SUCCESS {
+			return fmt.Errorf("error creating GPU instance of profile %d at %d: %v", l.profile, placement.Start, ret)
+		}
+
+		for _, ci := range l.computeInstances {
+			ciInfo, ret := gi.GetComputeInstanceProfileInfo(ci.profile, ci.engProfile)
+			if ret != nvml.SUCCESS {
+				return fmt.Errorf("error getting compute instance profile info for profile %d: %v", ci.profile, ret)
+			}
+			_, ret = gi.CreateComputeInstance(&ciInfo)
+			if ret != nvml.SUCCESS {
+				return fmt.Errorf("error creating compute instance of profile %d: %v", ci.profile, ret)
+			}
+		}
+	}
+	return nil
+}
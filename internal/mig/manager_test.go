@@ -0,0 +1,420 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvlib/device"
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
+)
+
+// mockGPU is a mock A100-40GB that records the GPU instances created on it.
+type mockGPU struct {
+	migMode   int
+	instances []*mockGpuInstance
+	// creates counts the attempts to create a GPU instance; the attempts in failCreates fail.
+	creates     int
+	failCreates map[int]bool
+}
+
+type mockGpuInstance struct {
+	profile   int
+	placement nvml.GpuInstancePlacement
+	// computes holds the number of compute instances per compute instance profile.
+	computes  map[int]int
+	destroyed bool
+}
+
+var mockGIProfiles = map[int]struct {
+	slices     int
+	memoryMB   uint64
+	placements []nvml.GpuInstancePlacement
+}{
+	nvml.GPU_INSTANCE_PROFILE_1_SLICE: {
+		slices:   1,
+		memoryMB: 4864,
+		placements: []nvml.GpuInstancePlacement{
+			{Start: 0, Size: 1}, {Start: 1, Size: 1}, {Start: 2, Size: 1}, {Start: 3, Size: 1},
+			{Start: 4, Size: 1}, {Start: 5, Size: 1}, {Start: 6, Size: 1},
+		},
+	},
+	nvml.GPU_INSTANCE_PROFILE_3_SLICE: {
+		slices:     3,
+		memoryMB:   19968,
+		placements: []nvml.GpuInstancePlacement{{Start: 0, Size: 4}, {Start: 4, Size: 4}},
+	},
+}
+
+var mockCISlices = map[int]int{
+	nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE: 1,
+	nvml.COMPUTE_INSTANCE_PROFILE_2_SLICE: 2,
+	nvml.COMPUTE_INSTANCE_PROFILE_3_SLICE: 3,
+}
+
+func (g *mockGPU) newGpuInstance(gi *mockGpuInstance) nvml.GpuInstance {
+	return &nvml.GpuInstanceMock{
+		GetInfoFunc: func() (nvml.GpuInstanceInfo, nvml.Return) {
+			return nvml.GpuInstanceInfo{ProfileId: uint32(gi.profile), Placement: gi.placement}, nvml.SUCCESS
+		},
+		GetComputeInstanceProfileInfoFunc: func(profile int, engProfile int) (nvml.ComputeInstanceProfileInfo, nvml.Return) {
+			slices, ok := mockCISlices[profile]
+			if !ok || slices > mockGIProfiles[gi.profile].slices || engProfile != nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_SHARED {
+				return nvml.ComputeInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+			}
+			return nvml.ComputeInstanceProfileInfo{Id: uint32(profile), SliceCount: uint32(slices)}, nvml.SUCCESS
+		},
+		CreateComputeInstanceFunc: func(info *nvml.ComputeInstanceProfileInfo) (nvml.ComputeInstance, nvml.Return) {
+			used := int(info.SliceCount)
+			for p, n := range gi.computes {
+				used += n * mockCISlices[p]
+			}
+			if used > mockGIProfiles[gi.profile].slices {
+				return nil, nvml.ERROR_INSUFFICIENT_RESOURCES
+			}
+			gi.computes[int(info.Id)]++
+			return &nvml.ComputeInstanceMock{}, nvml.SUCCESS
+		},
+		GetComputeInstancesFunc: func(info *nvml.ComputeInstanceProfileInfo) ([]nvml.ComputeInstance, nvml.Return) {
+			var cis []nvml.ComputeInstance
+			for i := 0; i < gi.computes[int(info.Id)]; i++ {
+				cis = append(cis, &nvml.ComputeInstanceMock{
+					DestroyFunc: func() nvml.Return {
+						gi.computes[int(info.Id)]--
+						return nvml.SUCCESS
+					},
+				})
+			}
+			return cis, nvml.SUCCESS
+		},
+		DestroyFunc: func() nvml.Return {
+			for _, n := range gi.computes {
+				if n != 0 {
+					return nvml.ERROR_IN_USE
+				}
+			}
+			gi.destroyed = true
+			return nvml.SUCCESS
+		},
+	}
+}
+
+func (g *mockGPU) device() nvml.Device {
+	return &nvml.DeviceMock{
+		GetMigModeFunc: func() (int, int, nvml.Return) {
+			return g.migMode, g.migMode, nvml.SUCCESS
+		},
+		SetMigModeFunc: func(mode int) (nvml.Return, nvml.Return) {
+			g.migMode = mode
+			return nvml.SUCCESS, nvml.SUCCESS
+		},
+		GetMemoryInfoFunc: func() (nvml.Memory, nvml.Return) {
+			return nvml.Memory{Total: 40960 << 20}, nvml.SUCCESS
+		},
+		GetGpuInstanceProfileInfoFunc: func(profile int) (nvml.GpuInstanceProfileInfo, nvml.Return) {
+			p, ok := mockGIProfiles[profile]
+			if !ok {
+				return nvml.GpuInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+			}
+			return nvml.GpuInstanceProfileInfo{Id: uint32(profile), MemorySizeMB: p.memoryMB}, nvml.SUCCESS
+		},
+		GetGpuInstancePossiblePlacementsFunc: func(info *nvml.GpuInstanceProfileInfo) ([]nvml.GpuInstancePlacement, nvml.Return) {
+			return mockGIProfiles[int(info.Id)].placements, nvml.SUCCESS
+		},
+		CreateGpuInstanceWithPlacementFunc: func(info *nvml.GpuInstanceProfileInfo, placement *nvml.GpuInstancePlacement) (nvml.GpuInstance, nvml.Return) {
+			g.creates++
+			if g.failCreates[g.creates] {
+				return nil, nvml.ERROR_UNKNOWN
+			}
+			gi := &mockGpuInstance{profile: int(info.Id), placement: *placement, computes: make(map[int]int)}
+			g.instances = append(g.instances, gi)
+			return g.newGpuInstance(gi), nvml.SUCCESS
+		},
+		GetGpuInstancesFunc: func(info *nvml.GpuInstanceProfileInfo) ([]nvml.GpuInstance, nvml.Return) {
+			var gis []nvml.GpuInstance
+			for _, gi := range g.instances {
+				if gi.profile == int(info.Id) && !gi.destroyed {
+					gis = append(gis, g.newGpuInstance(gi))
+				}
+			}
+			return gis, nvml.SUCCESS
+		},
+	}
+}
+
+// live returns the profiles of the GPU instances that have not been destroyed by their placement.
+func (g *mockGPU) live() map[uint32]int {
+	live := make(map[uint32]int)
+	for _, gi := range g.instances {
+		if !gi.destroyed {
+			live[gi.placement.Start] = gi.profile
+		}
+	}
+	return live
+}
+
+// liveComputes returns the number of compute instances per profile in the GPU instances that
+// have not been destroyed by their placement.
+func (g *mockGPU) liveComputes() map[uint32]map[int]int {
+	live := make(map[uint32]map[int]int)
+	for _, gi := range g.instances {
+		if gi.destroyed {
+			continue
+		}
+		computes := make(map[int]int)
+		for p, n := range gi.computes {
+			computes[p] = n
+		}
+		live[gi.placement.Start] = computes
+	}
+	return live
+}
+
+func newTestManager(gpus ...*mockGPU) Interface {
+	nvmllib := &nvml.InterfaceMock{
+		InitFunc: func() nvml.Return {
+			return nvml.SUCCESS
+		},
+		ShutdownFunc: func() nvml.Return {
+			return nvml.SUCCESS
+		},
+		DeviceGetCountFunc: func() (int, nvml.Return) {
+			return len(gpus), nvml.SUCCESS
+		},
+		DeviceGetHandleByIndexFunc: func(i int) (nvml.Device, nvml.Return) {
+			return gpus[i].device(), nvml.SUCCESS
+		},
+	}
+	return New(
+		WithNvml(nvmllib),
+		WithDeviceLib(device.New(device.WithNvml(nvmllib), device.WithVerifySymbols(false))),
+	)
+}
+
+func TestApply(t *testing.T) {
+	testCases := []struct {
+		description   string
+		config        []MigConfigSpec
+		expectedError bool
+		expectedMode  []int
+		expectedLive  []map[uint32]int
+	}{
+		{
+			description: "all disabled",
+			config: []MigConfigSpec{
+				{Devices: DeviceSelector{All: true}},
+			},
+			expectedMode: []int{nvml.DEVICE_MIG_DISABLE, nvml.DEVICE_MIG_DISABLE},
+			expectedLive: []map[uint32]int{{}, {}},
+		},
+		{
+			description: "mixed layout on all devices",
+			config: []MigConfigSpec{
+				{
+					Devices:    DeviceSelector{All: true},
+					MigEnabled: true,
+					MigDevices: map[string]int{"1g.5gb": 3, "3g.20gb": 1},
+				},
+			},
+			expectedMode: []int{nvml.DEVICE_MIG_ENABLE, nvml.DEVICE_MIG_ENABLE},
+			expectedLive: []map[uint32]int{
+				{0: nvml.GPU_INSTANCE_PROFILE_3_SLICE, 4: nvml.GPU_INSTANCE_PROFILE_1_SLICE, 5: nvml.GPU_INSTANCE_PROFILE_1_SLICE, 6: nvml.GPU_INSTANCE_PROFILE_1_SLICE},
+				{0: nvml.GPU_INSTANCE_PROFILE_3_SLICE, 4: nvml.GPU_INSTANCE_PROFILE_1_SLICE, 5: nvml.GPU_INSTANCE_PROFILE_1_SLICE, 6: nvml.GPU_INSTANCE_PROFILE_1_SLICE},
+			},
+		},
+		{
+			description: "per-device layouts",
+			config: []MigConfigSpec{
+				{
+					Devices:    DeviceSelector{Indices: []int{0}},
+					MigEnabled: true,
+					MigDevices: map[string]int{"3g.20gb": 2},
+				},
+				{
+					Devices: DeviceSelector{Indices: []int{1}},
+				},
+			},
+			expectedMode: []int{nvml.DEVICE_MIG_ENABLE, nvml.DEVICE_MIG_DISABLE},
+			expectedLive: []map[uint32]int{
+				{0: nvml.GPU_INSTANCE_PROFILE_3_SLICE, 4: nvml.GPU_INSTANCE_PROFILE_3_SLICE},
+				{},
+			},
+		},
+		{
+			description: "unselected device is unchanged",
+			config: []MigConfigSpec{
+				{
+					Devices:    DeviceSelector{Indices: []int{1}},
+					MigEnabled: true,
+					MigDevices: map[string]int{"1g.5gb": 7},
+				},
+			},
+			expectedMode: []int{nvml.DEVICE_MIG_DISABLE, nvml.DEVICE_MIG_ENABLE},
+			expectedLive: []map[uint32]int{
+				{},
+				{0: 0, 1: 0, 2: 0, 3: 0, 4: 0, 5: 0, 6: 0},
+			},
+		},
+		{
+			description: "layout does not fit",
+			config: []MigConfigSpec{
+				{
+					Devices:    DeviceSelector{All: true},
+					MigEnabled: true,
+					MigDevices: map[string]int{"1g.5gb": 4, "3g.20gb": 1},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			description: "unsupported profile",
+			config: []MigConfigSpec{
+				{
+					Devices:    DeviceSelector{All: true},
+					MigEnabled: true,
+					MigDevices: map[string]int{"7g.40gb": 1},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			description: "device selected twice",
+			config: []MigConfigSpec{
+				{Devices: DeviceSelector{All: true}},
+				{Devices: DeviceSelector{Indices: []int{0}}},
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			// Both GPUs start with MIG disabled and no MIG devices.
+			gpus := []*mockGPU{{}, {}}
+
+			err := newTestManager(gpus...).Apply(tc.config)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			for i, gpu := range gpus {
+				require.Equal(t, tc.expectedMode[i], gpu.migMode, "GPU %d", i)
+				require.Equal(t, tc.expectedLive[i], gpu.live(), "GPU %d", i)
+			}
+		})
+	}
+}
+
+func TestApplyReplacesExistingMigDevices(t *testing.T) {
+	gpu := &mockGPU{migMode: nvml.DEVICE_MIG_ENABLE}
+	m := newTestManager(gpu)
+
+	err := m.Apply([]MigConfigSpec{{Devices: DeviceSelector{All: true}, MigEnabled: true, MigDevices: map[string]int{"1g.5gb": 7}}})
+	require.NoError(t, err)
+	require.Len(t, gpu.live(), 7)
+
+	err = m.Apply([]MigConfigSpec{{Devices: DeviceSelector{All: true}, MigEnabled: true, MigDevices: map[string]int{"3g.20gb": 2}}})
+	require.NoError(t, err)
+	require.Equal(t, map[uint32]int{0: nvml.GPU_INSTANCE_PROFILE_3_SLICE, 4: nvml.GPU_INSTANCE_PROFILE_3_SLICE}, gpu.live())
+	require.Equal(t, map[uint32]map[int]int{
+		0: {nvml.COMPUTE_INSTANCE_PROFILE_3_SLICE: 1},
+		4: {nvml.COMPUTE_INSTANCE_PROFILE_3_SLICE: 1},
+	}, gpu.liveComputes())
+	for _, gi := range gpu.instances {
+		if gi.destroyed {
+			require.Zero(t, gi.computes[nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE])
+		}
+	}
+}
+
+func TestApplyGroupsComputeInstances(t *testing.T) {
+	testCases := []struct {
+		description  string
+		migDevices   map[string]int
+		expectedLive map[uint32]map[int]int
+	}{
+		{
+			description: "compute instances of one profile share a GPU instance",
+			migDevices:  map[string]int{"1c.3g.20gb": 3},
+			expectedLive: map[uint32]map[int]int{
+				0: {nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE: 3},
+			},
+		},
+		{
+			description: "compute instances of different profiles share a GPU instance",
+			migDevices:  map[string]int{"1c.3g.20gb": 1, "2c.3g.20gb": 1, "3g.20gb": 1},
+			expectedLive: map[uint32]map[int]int{
+				0: {nvml.COMPUTE_INSTANCE_PROFILE_3_SLICE: 1},
+				4: {nvml.COMPUTE_INSTANCE_PROFILE_2_SLICE: 1, nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE: 1},
+			},
+		},
+		{
+			description: "compute instances that do not fit use another GPU instance",
+			migDevices:  map[string]int{"1c.3g.20gb": 4},
+			expectedLive: map[uint32]map[int]int{
+				0: {nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE: 3},
+				4: {nvml.COMPUTE_INSTANCE_PROFILE_1_SLICE: 1},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			gpu := &mockGPU{}
+			err := newTestManager(gpu).Apply([]MigConfigSpec{{Devices: DeviceSelector{All: true}, MigEnabled: true, MigDevices: tc.migDevices}})
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedLive, gpu.liveComputes())
+		})
+	}
+}
+
+func TestApplyKeepsExistingMigDevicesIfLayoutDoesNotFit(t *testing.T) {
+	gpu := &mockGPU{migMode: nvml.DEVICE_MIG_ENABLE}
+	m := newTestManager(gpu)
+
+	err := m.Apply([]MigConfigSpec{{Devices: DeviceSelector{All: true}, MigEnabled: true, MigDevices: map[string]int{"1g.5gb": 7}}})
+	require.NoError(t, err)
+
+	err = m.Apply([]MigConfigSpec{{Devices: DeviceSelector{All: true}, MigEnabled: true, MigDevices: map[string]int{"3g.20gb": 3}}})
+	require.Error(t, err)
+	require.Len(t, gpu.instances, 7)
+	require.Len(t, gpu.live(), 7)
+}
+
+func TestApplyRestoresPreviousMigDevices(t *testing.T) {
+	gpu := &mockGPU{migMode: nvml.DEVICE_MIG_ENABLE}
+	m := newTestManager(gpu)
+
+	err := m.Apply([]MigConfigSpec{{Devices: DeviceSelector{All: true}, MigEnabled: true, MigDevices: map[string]int{"1c.3g.20gb": 2, "1g.5gb": 3}}})
+	require.NoError(t, err)
+	previous := gpu.liveComputes()
+
+	// Creating the second GPU instance of the new layout fails.
+	gpu.failCreates = map[int]bool{gpu.creates + 2: true}
+	err = m.Apply([]MigConfigSpec{{Devices: DeviceSelector{All: true}, MigEnabled: true, MigDevices: map[string]int{"3g.20gb": 2}}})
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "error restoring")
+	require.Equal(t, previous, gpu.liveComputes())
+
+	// Restoring the previous layout fails as well.
+	gpu.failCreates = map[int]bool{gpu.creates + 2: true, gpu.creates + 3: true}
+	err = m.Apply([]MigConfigSpec{{Devices: DeviceSelector{All: true}, MigEnabled: true, MigDevices: map[string]int{"1g.5gb": 2}}})
+	require.IsType(t, &RestoreError{}, err)
+}
@@ -6,6 +6,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strings"
 
 	"k8s.io/klog/v2"
 )
@@ -84,3 +85,8 @@ func GetMigCapabilityDevicePaths() (map[string]string, error) {
 	}
 	return capsDevicePaths, nil
 }
+
+// IsMigCapabilityDevicePath returns whether the specified path is the device node of a MIG capability.
+func IsMigCapabilityDevicePath(path string) bool {
+	return strings.HasPrefix(path, nvcapsDevicePath+"/")
+}
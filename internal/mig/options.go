@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mig
+
+import (
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvlib/device"
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
+)
+
+// Option defines a function for passing options to the New() call
+type Option func(*manager)
+
+// WithNvml provides an Option to set the NVML library used by the manager
+func WithNvml(nvmllib nvml.Interface) Option {
+	return func(m *manager) {
+		m.nvmllib = nvmllib
+	}
+}
+
+// WithDeviceLib provides an Option to set the device library used to resolve MIG profiles
+func WithDeviceLib(devicelib device.Interface) Option {
+	return func(m *manager) {
+		m.devicelib = devicelib
+	}
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package mps
+
+import (
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// Interface provides the API to the 'mps' package
+type Interface interface {
+	// Start starts an MPS control daemon for each shared device and monitors them until Stop is called.
+	Start() error
+	// Stop stops monitoring the MPS control daemons, which are left running for the next Start.
+	Stop() error
+	// UpdateAllocateResponse adds the environment variables and mounts required to connect to the
+	// MPS control daemons of the specified devices to an allocate response.
+	UpdateAllocateResponse(response *pluginapi.ContainerAllocateResponse, ids []string) error
+}
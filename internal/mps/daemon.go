@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package mps
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	// ContainerPipeDirectory is the path at which the pipe directory of an MPS control daemon
+	// is mounted in a container. This is the default pipe directory of CUDA applications.
+	ContainerPipeDirectory = "/tmp/nvidia-mps"
+	// ContainerShmDirectory is the path at which the shared memory of an MPS control daemon
+	// is mounted in a container.
+	ContainerShmDirectory = "/dev/shm"
+)
+
+// Daemon represents the MPS control daemon for a single GPU.
+// The compute and memory of the GPU are split evenly between its replicas.
+type Daemon struct {
+	uuid        string
+	root        string
+	controlPath string
+
+	activeThreadPercentage int
+	// pinnedMemoryLimit is the memory available to each replica in MiB.
+	pinnedMemoryLimit uint64
+}
+
+// newDaemon creates a Daemon for the specified device shared between the specified number of replicas.
+func newDaemon(controlPath string, root string, device *rm.Device, replicas int) *Daemon {
+	activeThreadPercentage := 100 / replicas
+	if activeThreadPercentage < 1 {
+		activeThreadPercentage = 1
+	}
+	return &Daemon{
+		uuid:                   device.GetUUID(),
+		root:                   root,
+		controlPath:            controlPath,
+		activeThreadPercentage: activeThreadPercentage,
+		pinnedMemoryLimit:      device.TotalMemory / uint64(replicas) / (1 << 20),
+	}
+}
+
+// Start starts the MPS control daemon and configures the default limits of its clients.
+// If the daemon is already running, e.g. since it was started before the plugin was
+// restarted, it is adopted and only its default limits are updated.
+func (d *Daemon) Start() error {
+	if d.pinnedMemoryLimit == 0 {
+		return fmt.Errorf("unable to determine the memory limit of the replicas of device %v", d.uuid)
+	}
+
+	for _, dir := range []string{d.pipeDir(), d.logDir(), d.shmDir()} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			return fmt.Errorf("error creating directory %v: %v", dir, err)
+		}
+	}
+
+	if d.isRunning() {
+		klog.Infof("Using running MPS control daemon for device %v", d.uuid)
+	} else {
+		klog.Infof("Starting MPS control daemon for device %v", d.uuid)
+		cmd := exec.Command(d.controlPath, "-d")
+		cmd.Env = d.env()
+		output, err := runWithShmDir(cmd, d.shmDir())
+		if err != nil {
+			return fmt.Errorf("error starting MPS control daemon for device %v: %v: %s", d.uuid, err, output)
+		}
+	}
+
+	_, err := d.control("set_default_active_thread_percentage %d", d.activeThreadPercentage)
+	if err != nil {
+		return err
+	}
+	_, err = d.control("set_default_device_pinned_mem_limit 0 %dM", d.pinnedMemoryLimit)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Stop stops the MPS control daemon and the MPS server it manages.
+func (d *Daemon) Stop() error {
+	klog.Infof("Stopping MPS control daemon for device %v", d.uuid)
+	_, err := d.control("quit")
+	return err
+}
+
+// isRunning checks whether an MPS control daemon for the device is responding to commands.
+func (d *Daemon) isRunning() bool {
+	_, err := d.control("get_default_active_thread_percentage")
+	return err == nil
+}
+
+// AssertHealthy checks that the MPS control daemon is responding to commands.
+func (d *Daemon) AssertHealthy() error {
+	output, err := d.control("get_default_active_thread_percentage")
+	if err != nil {
+		return err
+	}
+	percentage, err := strconv.ParseFloat(strings.TrimSpace(output), 64)
+	if err != nil {
+		return fmt.Errorf("unexpected response from MPS control daemon for device %v: %q", d.uuid, output)
+	}
+	if int(percentage) != d.activeThreadPercentage {
+		return fmt.Errorf("unexpected active thread percentage for device %v: %v", d.uuid, percentage)
+	}
+	return nil
+}
+
+// Envs returns the environment variables for a container that is allocated the specified number of replicas of the device.
+func (d *Daemon) Envs(replicas int) map[string]string {
+	activeThreadPercentage := replicas * d.activeThreadPercentage
+	if activeThreadPercentage > 100 {
+		activeThreadPercentage = 100
+	}
+	return map[string]string{
+		"CUDA_MPS_PIPE_DIRECTORY":           ContainerPipeDirectory,
+		"CUDA_MPS_ACTIVE_THREAD_PERCENTAGE": strconv.Itoa(activeThreadPercentage),
+		// A container is only allocated a single device, which is always visible as device 0.
+		"CUDA_MPS_PINNED_DEVICE_MEM_LIMIT": fmt.Sprintf("0=%dM", uint64(replicas)*d.pinnedMemoryLimit),
+	}
+}
+
+// Mounts returns the mounts for a container that is allocated a replica of the device.
+// Only the pipe and shared memory directories of the daemon for the device are mounted.
+func (d *Daemon) Mounts() []*pluginapi.Mount {
+	return []*pluginapi.Mount{
+		{
+			HostPath:      d.pipeDir(),
+			ContainerPath: ContainerPipeDirectory,
+		},
+		{
+			HostPath:      d.shmDir(),
+			ContainerPath: ContainerShmDirectory,
+		},
+	}
+}
+
+// control sends a command to the MPS control daemon and returns its response.
+func (d *Daemon) control(format string, args ...interface{}) (string, error) {
+	command := fmt.Sprintf(format, args...)
+
+	cmd := exec.Command(d.controlPath)
+	cmd.Env = d.env()
+	cmd.Stdin = strings.NewReader(command + "\n")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("error sending '%v' to MPS control daemon for device %v: %v: %s", command, d.uuid, err, output)
+	}
+	return string(output), nil
+}
+
+// env returns the environment of the MPS control daemon and the commands sent to it.
+func (d *Daemon) env() []string {
+	return append(os.Environ(),
+		"CUDA_VISIBLE_DEVICES="+d.uuid,
+		"CUDA_MPS_PIPE_DIRECTORY="+d.pipeDir(),
+		"CUDA_MPS_LOG_DIRECTORY="+d.logDir(),
+	)
+}
+
+func (d *Daemon) pipeDir() string {
+	return filepath.Join(d.root, d.uuid, "pipe")
+}
+
+func (d *Daemon) logDir() string {
+	return filepath.Join(d.root, d.uuid, "log")
+}
+
+// shmDir returns the directory that is mounted at /dev/shm for the daemon and its clients.
+func (d *Daemon) shmDir() string {
+	return filepath.Join(d.root, d.uuid, "shm")
+}
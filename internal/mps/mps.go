@@ -0,0 +1,277 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package mps
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	defaultControlPath  = "nvidia-cuda-mps-control"
+	healthCheckInterval = 30 * time.Second
+)
+
+// manager manages the MPS control daemons for the replicated devices of a resource.
+type manager struct {
+	enabled     bool
+	root        string
+	controlPath string
+	devices     rm.Devices
+
+	daemons  map[string]*Daemon
+	interval time.Duration
+
+	sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ Interface = &manager{}
+
+// daemons tracks the MPS control daemons used by the managers of this process.
+// Stopping a manager leaves its daemons running, so that the MPS servers of running
+// workloads survive restarts of the plugin, and the daemons are adopted by the next
+// manager for the same device. Daemons are only stopped by StopUnusedDaemons and
+// StopDaemons.
+var daemons = struct {
+	sync.Mutex
+	running map[string]*Daemon
+	users   map[string]int
+}{
+	running: make(map[string]*Daemon),
+	users:   make(map[string]int),
+}
+
+// acquire records that a manager uses the specified daemon.
+func acquire(d *Daemon) {
+	daemons.Lock()
+	defer daemons.Unlock()
+	daemons.running[d.pipeDir()] = d
+	daemons.users[d.pipeDir()]++
+}
+
+// release records that a manager no longer uses the specified daemon.
+func release(d *Daemon) {
+	daemons.Lock()
+	defer daemons.Unlock()
+	if daemons.users[d.pipeDir()] > 0 {
+		daemons.users[d.pipeDir()]--
+	}
+}
+
+// StopUnusedDaemons stops the MPS control daemons that are no longer used by a
+// running manager, e.g. since MPS sharing was removed from the config of their device.
+func StopUnusedDaemons() error {
+	return stopDaemons(false)
+}
+
+// StopDaemons stops all MPS control daemons started by the managers of this process.
+// This is to be called when the process is shutting down.
+func StopDaemons() error {
+	return stopDaemons(true)
+}
+
+func stopDaemons(all bool) error {
+	daemons.Lock()
+	defer daemons.Unlock()
+
+	var keys []string
+	for key := range daemons.running {
+		if all || daemons.users[key] == 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		if err := daemons.running[key].Stop(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(daemons.running, key)
+		delete(daemons.users, key)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error stopping MPS control daemons: %v", errs)
+	}
+	return nil
+}
+
+// New creates a manager for the MPS control daemons of the specified devices.
+// A daemon is started for each device that has replicas.
+func New(opts ...Option) Interface {
+	m := &manager{
+		controlPath: defaultControlPath,
+		interval:    healthCheckInterval,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if !m.enabled {
+		return &null{}
+	}
+
+	if m.root == "" {
+		m.root = spec.DefaultMPSRoot
+	}
+
+	replicas := make(map[string]int)
+	for _, d := range m.devices {
+		if rm.AnnotatedID(d.ID).HasAnnotations() {
+			replicas[d.GetUUID()]++
+		}
+	}
+
+	m.daemons = make(map[string]*Daemon)
+	for _, d := range m.devices {
+		uuid := d.GetUUID()
+		if replicas[uuid] == 0 || m.daemons[uuid] != nil {
+			continue
+		}
+		m.daemons[uuid] = newDaemon(m.controlPath, m.root, d, replicas[uuid])
+	}
+
+	return m
+}
+
+// Start starts or adopts the MPS control daemons and monitors them until Stop is called.
+// A daemon that stops responding is restarted.
+func (m *manager) Start() error {
+	m.Lock()
+	defer m.Unlock()
+
+	var started []*Daemon
+	for _, d := range m.sortedDaemons() {
+		err := d.Start()
+		if err != nil {
+			for _, s := range started {
+				release(s)
+			}
+			return err
+		}
+		acquire(d)
+		started = append(started, d)
+	}
+
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go m.monitor(m.stop, m.done)
+
+	return nil
+}
+
+// Stop stops monitoring the MPS control daemons.
+// The daemons are left running; see StopUnusedDaemons and StopDaemons.
+func (m *manager) Stop() error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.stop == nil {
+		return nil
+	}
+	close(m.stop)
+	<-m.done
+	m.stop = nil
+	m.done = nil
+
+	for _, d := range m.sortedDaemons() {
+		release(d)
+	}
+	return nil
+}
+
+// UpdateAllocateResponse adds the environment variables and mounts required to connect
+// to the MPS control daemon of the replicated device in ids to the response. The limits
+// of the container are scaled by the number of replicas of the device in ids.
+func (m *manager) UpdateAllocateResponse(response *pluginapi.ContainerAllocateResponse, ids []string) error {
+	replicas := make(map[string]int)
+	for _, id := range ids {
+		if rm.AnnotatedID(id).HasAnnotations() {
+			replicas[rm.AnnotatedID(id).GetID()]++
+		}
+	}
+	if len(replicas) == 0 {
+		return nil
+	}
+	if len(replicas) > 1 {
+		return fmt.Errorf("replicas of %d devices requested, but an MPS client can only use a single device", len(replicas))
+	}
+
+	for uuid, count := range replicas {
+		d, exists := m.daemons[uuid]
+		if !exists {
+			return fmt.Errorf("no MPS control daemon for device %v", uuid)
+		}
+		if response.Envs == nil {
+			response.Envs = make(map[string]string)
+		}
+		for k, v := range d.Envs(count) {
+			response.Envs[k] = v
+		}
+		response.Mounts = append(response.Mounts, d.Mounts()...)
+	}
+	return nil
+}
+
+func (m *manager) monitor(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		for _, d := range m.sortedDaemons() {
+			err := d.AssertHealthy()
+			if err == nil {
+				continue
+			}
+			klog.Warningf("MPS control daemon for device %v is not healthy: %v; restarting", d.uuid, err)
+			if err := d.Stop(); err != nil {
+				klog.Warningf("Failed to stop MPS control daemon: %v", err)
+			}
+			if err := d.Start(); err != nil {
+				klog.Errorf("Failed to restart MPS control daemon: %v", err)
+			}
+		}
+	}
+}
+
+func (m *manager) sortedDaemons() []*Daemon {
+	var daemons []*Daemon
+	for _, d := range m.daemons {
+		daemons = append(daemons, d)
+	}
+	sort.Slice(daemons, func(i, j int) bool {
+		return daemons[i].uuid < daemons[j].uuid
+	})
+	return daemons
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mps
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	"github.com/stretchr/testify/require"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// fakeControl is a stand-in for nvidia-cuda-mps-control that logs the commands it receives.
+// Commands fail unless the daemon for the device was started and has not quit.
+const fakeControl = `#!/bin/sh
+running="$(dirname "$0")/running-$CUDA_VISIBLE_DEVICES"
+if [ "$1" = "-d" ]; then
+	echo "$CUDA_VISIBLE_DEVICES start" >> "$(dirname "$0")/commands"
+	touch "$running"
+	exit 0
+fi
+read command
+if [ ! -e "$running" ]; then
+	echo "Cannot find MPS control daemon process"
+	exit 1
+fi
+echo "$CUDA_VISIBLE_DEVICES $command" >> "$(dirname "$0")/commands"
+if [ "$command" = "get_default_active_thread_percentage" ]; then
+	echo "50.0"
+fi
+if [ "$command" = "quit" ]; then
+	rm "$running"
+fi
+`
+
+func newTestDevice(id string, totalMemory uint64) *rm.Device {
+	d := &rm.Device{TotalMemory: totalMemory}
+	d.ID = id
+	d.Health = pluginapi.Healthy
+	return d
+}
+
+func TestManager(t *testing.T) {
+	bin := t.TempDir()
+	controlPath := filepath.Join(bin, "nvidia-cuda-mps-control")
+	require.NoError(t, os.WriteFile(controlPath, []byte(fakeControl), 0755))
+	root := t.TempDir()
+
+	// Creating a mount namespace requires CAP_SYS_ADMIN, so the daemons are started directly.
+	var shmDirs []string
+	defer func(run func(*exec.Cmd, string) ([]byte, error)) { runWithShmDir = run }(runWithShmDir)
+	runWithShmDir = func(cmd *exec.Cmd, dir string) ([]byte, error) {
+		shmDirs = append(shmDirs, dir)
+		return cmd.CombinedOutput()
+	}
+
+	devices := rm.Devices{}
+	for _, d := range []*rm.Device{
+		newTestDevice("GPU-0::0", 16<<30),
+		newTestDevice("GPU-0::1", 16<<30),
+		newTestDevice("GPU-1", 16<<30),
+	} {
+		devices[d.ID] = d
+	}
+
+	m := New(
+		WithEnabled(true),
+		WithRoot(root),
+		WithDevices(devices),
+		WithControlPath(controlPath),
+	)
+
+	require.NoError(t, m.Start())
+	require.DirExists(t, filepath.Join(root, "GPU-0", "pipe"))
+	require.DirExists(t, filepath.Join(root, "GPU-0", "shm"))
+	require.Equal(t, []string{filepath.Join(root, "GPU-0", "shm")}, shmDirs)
+	require.NoError(t, m.(*manager).daemons["GPU-0"].AssertHealthy())
+
+	response := &pluginapi.ContainerAllocateResponse{}
+	require.NoError(t, m.UpdateAllocateResponse(response, []string{"GPU-0::1"}))
+	require.Equal(t, map[string]string{
+		"CUDA_MPS_PIPE_DIRECTORY":           ContainerPipeDirectory,
+		"CUDA_MPS_ACTIVE_THREAD_PERCENTAGE": "50",
+		"CUDA_MPS_PINNED_DEVICE_MEM_LIMIT":  "0=8192M",
+	}, response.Envs)
+	require.Equal(t, []*pluginapi.Mount{
+		{HostPath: filepath.Join(root, "GPU-0", "pipe"), ContainerPath: ContainerPipeDirectory},
+		{HostPath: filepath.Join(root, "GPU-0", "shm"), ContainerPath: ContainerShmDirectory},
+	}, response.Mounts)
+
+	// The limits are scaled by the number of replicas allocated.
+	response = &pluginapi.ContainerAllocateResponse{}
+	require.NoError(t, m.UpdateAllocateResponse(response, []string{"GPU-0::0", "GPU-0::1"}))
+	require.Equal(t, "100", response.Envs["CUDA_MPS_ACTIVE_THREAD_PERCENTAGE"])
+	require.Equal(t, "0=16384M", response.Envs["CUDA_MPS_PINNED_DEVICE_MEM_LIMIT"])
+
+	// Replicas of more than one device cannot be allocated to a single client.
+	require.Error(t, m.UpdateAllocateResponse(&pluginapi.ContainerAllocateResponse{}, []string{"GPU-0::0", "GPU-2::0"}))
+
+	// Devices that are not replicated do not use MPS.
+	response = &pluginapi.ContainerAllocateResponse{}
+	require.NoError(t, m.UpdateAllocateResponse(response, []string{"GPU-1"}))
+	require.Empty(t, response.Envs)
+	require.Empty(t, response.Mounts)
+
+	require.Error(t, m.UpdateAllocateResponse(response, []string{"GPU-2::0"}))
+
+	// Stopping the manager leaves the daemon running for the next manager to adopt.
+	require.NoError(t, m.Stop())
+
+	restarted := New(
+		WithEnabled(true),
+		WithRoot(root),
+		WithDevices(devices),
+		WithControlPath(controlPath),
+	)
+	require.NoError(t, restarted.Start())
+	require.NoError(t, StopUnusedDaemons())
+	require.NoError(t, restarted.Stop())
+
+	// The daemon is stopped once it is no longer used.
+	require.NoError(t, StopUnusedDaemons())
+	require.NoError(t, StopDaemons())
+
+	commands, err := os.ReadFile(filepath.Join(bin, "commands"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"GPU-0 start",
+		"GPU-0 set_default_active_thread_percentage 50",
+		"GPU-0 set_default_device_pinned_mem_limit 0 8192M",
+		"GPU-0 get_default_active_thread_percentage",
+		"GPU-0 get_default_active_thread_percentage",
+		"GPU-0 set_default_active_thread_percentage 50",
+		"GPU-0 set_default_device_pinned_mem_limit 0 8192M",
+		"GPU-0 quit",
+	}, strings.Split(strings.TrimSpace(string(commands)), "\n"))
+}
+
+func TestNewDisabled(t *testing.T) {
+	m := New(WithEnabled(false))
+	require.IsType(t, &null{}, m)
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mps
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// runWithShmDir runs a command in a new mount namespace in which the specified directory is mounted at
+// /dev/shm and returns its combined output. The MPS control daemon and the MPS server started by it
+// inherit this namespace, so that their shared memory is only visible to the clients of the daemon,
+// which are given the same directory as /dev/shm. This requires CAP_SYS_ADMIN.
+var runWithShmDir = func(cmd *exec.Cmd, dir string) ([]byte, error) {
+	type result struct {
+		output []byte
+		err    error
+	}
+	results := make(chan result)
+	go func() {
+		// The mount namespace is changed for the current thread only. The thread is not
+		// unlocked, so that it is terminated with the goroutine instead of being reused.
+		runtime.LockOSThread()
+		output, err := func() ([]byte, error) {
+			if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+				return nil, fmt.Errorf("error creating mount namespace: %v", err)
+			}
+			// Keep the mounts of the new namespace from propagating to the namespace of the plugin.
+			if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_SLAVE, ""); err != nil {
+				return nil, fmt.Errorf("error changing mount propagation: %v", err)
+			}
+			if err := unix.Mount(dir, ContainerShmDirectory, "", unix.MS_BIND, ""); err != nil {
+				return nil, fmt.Errorf("error mounting %v at %v: %v", dir, ContainerShmDirectory, err)
+			}
+			return cmd.CombinedOutput()
+		}()
+		results <- result{output, err}
+	}()
+	r := <-results
+	return r.output, r.err
+}
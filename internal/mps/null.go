@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package mps
+
+import (
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+type null struct{}
+
+var _ Interface = &null{}
+
+// NewNullManager returns an instance of the 'mps' interface that can
+// be used when devices are not shared with MPS.
+func NewNullManager() Interface {
+	return &null{}
+}
+
+// Start is a no-op for the null manager.
+func (n *null) Start() error {
+	return nil
+}
+
+// Stop is a no-op for the null manager.
+func (n *null) Stop() error {
+	return nil
+}
+
+// UpdateAllocateResponse is a no-op for the null manager.
+func (n *null) UpdateAllocateResponse(response *pluginapi.ContainerAllocateResponse, ids []string) error {
+	return nil
+}
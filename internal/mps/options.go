@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package mps
+
+import (
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+)
+
+// Option defines a function for passing options to the New() call
+type Option func(*manager)
+
+// WithEnabled provides an Option to set whether devices are shared with MPS
+func WithEnabled(enabled bool) Option {
+	return func(m *manager) {
+		m.enabled = enabled
+	}
+}
+
+// WithRoot provides an Option to set the host path under which the MPS pipe and log directories are created
+func WithRoot(root string) Option {
+	return func(m *manager) {
+		m.root = root
+	}
+}
+
+// WithDevices provides an Option to set the (replicated) devices for which MPS control daemons are started
+func WithDevices(devices rm.Devices) Option {
+	return func(m *manager) {
+		m.devices = devices
+	}
+}
+
+// WithControlPath provides an Option to set the path to the nvidia-cuda-mps-control executable
+func WithControlPath(path string) Option {
+	return func(m *manager) {
+		m.controlPath = path
+	}
+}
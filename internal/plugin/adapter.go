@@ -0,0 +1,93 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"fmt"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// devicePlugin defines the logic of a plugin independently of the version of
+// the kubelet device plugin API it is served through. A kubeletAdapter exposes
+// a devicePlugin to the kubelet.
+type devicePlugin interface {
+	resourceName() spec.ResourceName
+	devicePluginOptions() *pluginapi.DevicePluginOptions
+	listAndWatch(send func([]*pluginapi.Device) error) error
+	getPreferredAllocation(requests []preferredAllocationRequest) ([][]string, error)
+	allocate(requests [][]string) ([]*containerAllocation, error)
+	preStartContainer(ids []string) error
+	getCDIDeviceAnnotations(id string, devices []string) (map[string]string, error)
+	kubeletForwardsCDIDevices() bool
+}
+
+var _ devicePlugin = (*NvidiaDevicePlugin)(nil)
+
+// preferredAllocationRequest holds the devices a preferred allocation is requested from for a container.
+type preferredAllocationRequest struct {
+	available   []string
+	mustInclude []string
+	size        int
+}
+
+// containerAllocation holds the result of allocating devices to a container.
+// The CDI devices to inject into the container are held separately from the
+// response, since how they are passed to the kubelet depends on the adapter.
+type containerAllocation struct {
+	response *pluginapi.ContainerAllocateResponse
+	// annotatedCDIDevices are the CDI devices to pass as annotations (cdi-annotations).
+	annotatedCDIDevices []string
+	// criCDIDevices are the CDI devices to pass in the CDIDevices field of the response (cdi-cri).
+	criCDIDevices []string
+}
+
+// kubeletAdapter serves a devicePlugin through a version of the kubelet device plugin API.
+type kubeletAdapter interface {
+	// name returns a description of the API served by the adapter.
+	name() string
+	// supported returns whether the adapter can be used with the kubelet.
+	supported() bool
+	// registerService registers the device plugin service with the gRPC server of the plugin.
+	registerService(server *grpc.Server)
+	// cdiDevicesSupported returns whether the adapter passes CDI devices in the CDIDevices field of the response.
+	cdiDevicesSupported() bool
+	// registerWithKubelet registers the plugin served at the specified endpoint with the kubelet.
+	registerWithKubelet(conn *grpc.ClientConn, endpoint string) error
+	// containerAllocateResponse converts a containerAllocation to the response returned to the kubelet.
+	containerAllocateResponse(responseID string, allocation *containerAllocation) (*pluginapi.ContainerAllocateResponse, error)
+}
+
+// kubeletAdapters holds the constructors of the available adapters in order of preference.
+// Each constructor is passed the version of the kubelet, which is empty if it is unknown.
+var kubeletAdapters = []func(plugin devicePlugin, kubeletVersion string) kubeletAdapter{
+	newCDIDevicesAdapter,
+	newV1beta1Adapter,
+}
+
+// newKubeletAdapter returns the most preferred adapter that is supported by the kubelet.
+func newKubeletAdapter(plugin devicePlugin, kubeletVersion string) (kubeletAdapter, error) {
+	for _, newAdapter := range kubeletAdapters {
+		adapter := newAdapter(plugin, kubeletVersion)
+		if adapter.supported() {
+			return adapter, nil
+		}
+	}
+	return nil, fmt.Errorf("no supported kubelet device plugin API found")
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// cdiDevicesMinKubeletMinorVersion is the minor version of the first Kubernetes 1.x release in which the
+// kubelet forwards the CDIDevices field of the response to the container runtime by default. The field was
+// added in 1.28 behind the DevicePluginCDIDevices feature gate, which is enabled by default from 1.29.
+const cdiDevicesMinKubeletMinorVersion = 29
+
+// cdiDevicesAdapter serves a devicePlugin through the v1beta1 kubelet device plugin API, passing the CDI
+// devices for the cdi-cri strategy in the CDIDevices field of the response. These are injected by the
+// container runtime (e.g. containerd or CRI-O) without relying on annotations.
+type cdiDevicesAdapter struct {
+	*v1beta1Adapter
+	kubeletVersion string
+}
+
+var _ pluginapi.DevicePluginServer = (*cdiDevicesAdapter)(nil)
+
+func newCDIDevicesAdapter(plugin devicePlugin, kubeletVersion string) kubeletAdapter {
+	return &cdiDevicesAdapter{
+		v1beta1Adapter: &v1beta1Adapter{plugin: plugin},
+		kubeletVersion: kubeletVersion,
+	}
+}
+
+func (a *cdiDevicesAdapter) name() string {
+	return fmt.Sprintf("device plugin API %s with CDI devices", pluginapi.Version)
+}
+
+// supported returns whether the kubelet forwards the CDIDevices field of the response.
+// Unless the plugin is configured to assume that it does, this is not the case if the
+// version of the kubelet is unknown.
+func (a *cdiDevicesAdapter) supported() bool {
+	if a.plugin.kubeletForwardsCDIDevices() {
+		return true
+	}
+	var major, minor int
+	_, err := fmt.Sscanf(strings.TrimPrefix(a.kubeletVersion, "v"), "%d.%d", &major, &minor)
+	if err != nil {
+		return false
+	}
+	return major > 1 || (major == 1 && minor >= cdiDevicesMinKubeletMinorVersion)
+}
+
+// cdiDevicesSupported returns true since the CDI devices for the cdi-cri strategy are passed in the CDIDevices field.
+func (a *cdiDevicesAdapter) cdiDevicesSupported() bool {
+	return true
+}
+
+func (a *cdiDevicesAdapter) registerService(server *grpc.Server) {
+	pluginapi.RegisterDevicePluginServer(server, a)
+}
+
+// containerAllocateResponse adds the CDI devices for the cdi-cri strategy to the CDIDevices field of the
+// response of the containerAllocation. The CDI devices for the cdi-annotations strategy are passed as
+// annotations as for the v1beta1Adapter.
+func (a *cdiDevicesAdapter) containerAllocateResponse(responseID string, allocation *containerAllocation) (*pluginapi.ContainerAllocateResponse, error) {
+	annotated := &containerAllocation{
+		response:            allocation.response,
+		annotatedCDIDevices: allocation.annotatedCDIDevices,
+	}
+	response, err := a.v1beta1Adapter.containerAllocateResponse(responseID, annotated)
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range allocation.criCDIDevices {
+		response.CDIDevices = append(response.CDIDevices, &pluginapi.CDIDevice{Name: device})
+	}
+	return response, nil
+}
+
+// Allocate which return list of devices.
+func (a *cdiDevicesAdapter) Allocate(ctx context.Context, reqs *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
+	return allocate(a.plugin, reqs, a.containerAllocateResponse)
+}
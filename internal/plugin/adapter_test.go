@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/cdi"
+	"github.com/NVIDIA/k8s-device-plugin/internal/mps"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	"github.com/stretchr/testify/require"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// unsupportedAdapter is an adapter that is never supported by the kubelet.
+type unsupportedAdapter struct {
+	kubeletAdapter
+}
+
+func (a *unsupportedAdapter) supported() bool {
+	return false
+}
+
+func TestNewKubeletAdapter(t *testing.T) {
+	trueValue := true
+	testCases := []struct {
+		description       string
+		kubeletVersion    string
+		kubeletCDIDevices *bool
+		expected          kubeletAdapter
+	}{
+		{
+			description:    "kubelet with CDI devices",
+			kubeletVersion: "v1.29.0",
+			expected:       &cdiDevicesAdapter{},
+		},
+		{
+			description:    "kubelet with CDI devices and a distribution suffix",
+			kubeletVersion: "v1.30.2+k3s1",
+			expected:       &cdiDevicesAdapter{},
+		},
+		{
+			description:    "kubelet without CDI devices by default falls back to v1beta1",
+			kubeletVersion: "v1.28.4",
+			expected:       &v1beta1Adapter{},
+		},
+		{
+			description:    "unknown kubelet version falls back to v1beta1",
+			kubeletVersion: "",
+			expected:       &v1beta1Adapter{},
+		},
+		{
+			description:    "invalid kubelet version falls back to v1beta1",
+			kubeletVersion: "latest",
+			expected:       &v1beta1Adapter{},
+		},
+		{
+			description:       "kubelet with the CDI devices feature gate",
+			kubeletVersion:    "v1.28.4",
+			kubeletCDIDevices: &trueValue,
+			expected:          &cdiDevicesAdapter{},
+		},
+		{
+			description:       "unknown kubelet version with CDI devices",
+			kubeletVersion:    "",
+			kubeletCDIDevices: &trueValue,
+			expected:          &cdiDevicesAdapter{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			plugin := &NvidiaDevicePlugin{
+				config: &spec.Config{
+					Flags: spec.Flags{
+						CommandLineFlags: spec.CommandLineFlags{
+							Plugin: &spec.PluginCommandLineFlags{KubeletCDIDevices: tc.kubeletCDIDevices},
+						},
+					},
+				},
+			}
+			adapter, err := newKubeletAdapter(plugin, tc.kubeletVersion)
+			require.NoError(t, err)
+			require.IsType(t, tc.expected, adapter)
+		})
+	}
+}
+
+func TestNewKubeletAdapterUnsupported(t *testing.T) {
+	defer func(adapters []func(devicePlugin, string) kubeletAdapter) {
+		kubeletAdapters = adapters
+	}(kubeletAdapters)
+
+	newUnsupportedAdapter := func(devicePlugin, string) kubeletAdapter {
+		return &unsupportedAdapter{}
+	}
+
+	kubeletAdapters = []func(devicePlugin, string) kubeletAdapter{newUnsupportedAdapter}
+	_, err := newKubeletAdapter(&NvidiaDevicePlugin{}, "v1.29.0")
+	require.Error(t, err)
+}
+
+func TestV1beta1AdapterAllocate(t *testing.T) {
+	d := newTestDevice(string(rm.NewAnnotatedID("GPU-0", 0)), -1)
+	d.Index = "0"
+	devices := rm.Devices{d.ID: d}
+
+	falseValue := false
+	deviceIDStrategy := spec.DeviceIDStrategyUUID
+	deviceListStrategies, _ := spec.NewDeviceListStrategies([]string{"envvar", "cdi-annotations"})
+	plugin := &NvidiaDevicePlugin{
+		rm: &testResourceManager{resource: "nvidia.com/gpu", devices: devices},
+		config: &spec.Config{
+			Flags: spec.Flags{
+				CommandLineFlags: spec.CommandLineFlags{
+					GDSEnabled:   &falseValue,
+					MOFEDEnabled: &falseValue,
+					Plugin: &spec.PluginCommandLineFlags{
+						PassDeviceSpecs:  &falseValue,
+						DeviceIDStrategy: &deviceIDStrategy,
+					},
+				},
+			},
+		},
+		cdiHandler: &cdi.InterfaceMock{
+			QualifiedNameFunc: func(c string, s string) string {
+				return "nvidia.com/" + c + "=" + s
+			},
+		},
+		cdiEnabled:           true,
+		cdiAnnotationPrefix:  spec.DefaultCDIAnnotationPrefix,
+		deviceListEnvvar:     "NVIDIA_VISIBLE_DEVICES",
+		deviceListStrategies: deviceListStrategies,
+		mpsManager:           mps.NewNullManager(),
+	}
+	adapter := newV1beta1Adapter(plugin, "").(*v1beta1Adapter)
+
+	response, err := adapter.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+			{DevicesIDs: []string{d.ID}},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, response.ContainerResponses, 1)
+
+	r := response.ContainerResponses[0]
+	require.Equal(t, map[string]string{"NVIDIA_VISIBLE_DEVICES": "GPU-0"}, r.Envs)
+	require.Len(t, r.Annotations, 1)
+	for k, v := range r.Annotations {
+		require.Contains(t, k, spec.DefaultCDIAnnotationPrefix+"nvidia-device-plugin_")
+		require.Equal(t, "nvidia.com/gpu=GPU-0", v)
+	}
+
+	_, err = adapter.Allocate(context.Background(), &pluginapi.AllocateRequest{
+		ContainerRequests: []*pluginapi.ContainerAllocateRequest{
+			{DevicesIDs: []string{"GPU-1::0"}},
+		},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// v1beta1Adapter serves a devicePlugin through the v1beta1 kubelet device plugin API.
+// CDI devices are passed to the container runtime as annotations, since it is
+// used with kubelets that do not forward the CDIDevices field of the response.
+type v1beta1Adapter struct {
+	plugin devicePlugin
+}
+
+var _ pluginapi.DevicePluginServer = (*v1beta1Adapter)(nil)
+
+func newV1beta1Adapter(plugin devicePlugin, _ string) kubeletAdapter {
+	return &v1beta1Adapter{plugin: plugin}
+}
+
+func (a *v1beta1Adapter) name() string {
+	return fmt.Sprintf("device plugin API %s with CDI annotations", pluginapi.Version)
+}
+
+// supported returns true since all kubelet versions supported by the plugin serve the v1beta1 API.
+func (a *v1beta1Adapter) supported() bool {
+	return true
+}
+
+// cdiDevicesSupported returns false since the CDIDevices field is not used.
+func (a *v1beta1Adapter) cdiDevicesSupported() bool {
+	return false
+}
+
+func (a *v1beta1Adapter) registerService(server *grpc.Server) {
+	pluginapi.RegisterDevicePluginServer(server, a)
+}
+
+func (a *v1beta1Adapter) registerWithKubelet(conn *grpc.ClientConn, endpoint string) error {
+	client := pluginapi.NewRegistrationClient(conn)
+	reqt := &pluginapi.RegisterRequest{
+		Version:      pluginapi.Version,
+		Endpoint:     endpoint,
+		ResourceName: string(a.plugin.resourceName()),
+		Options:      a.plugin.devicePluginOptions(),
+	}
+
+	_, err := client.Register(context.Background(), reqt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// containerAllocateResponse adds the annotations required to trigger CDI injection in the
+// container engine or nvidia-container-runtime to the response of the containerAllocation.
+// Since the CDIDevices field is not used, the CDI devices for the cdi-cri
+// strategy are also passed as annotations.
+func (a *v1beta1Adapter) containerAllocateResponse(responseID string, allocation *containerAllocation) (*pluginapi.ContainerAllocateResponse, error) {
+	response := allocation.response
+	devices := allocation.annotatedCDIDevices
+	if len(devices) == 0 {
+		devices = allocation.criCDIDevices
+	}
+	if len(devices) == 0 {
+		return response, nil
+	}
+
+	annotations, err := a.plugin.getCDIDeviceAnnotations(responseID, devices)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get allocate response for CDI: %v", err)
+	}
+	if response.Annotations == nil {
+		response.Annotations = make(map[string]string)
+	}
+	for k, v := range annotations {
+		response.Annotations[k] = v
+	}
+	return response, nil
+}
+
+// GetDevicePluginOptions returns the values of the optional settings for this plugin
+func (a *v1beta1Adapter) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
+	return a.plugin.devicePluginOptions(), nil
+}
+
+// ListAndWatch lists devices and update that list according to the health status
+func (a *v1beta1Adapter) ListAndWatch(e *pluginapi.Empty, s pluginapi.DevicePlugin_ListAndWatchServer) error {
+	return a.plugin.listAndWatch(func(devices []*pluginapi.Device) error {
+		return s.Send(&pluginapi.ListAndWatchResponse{Devices: devices})
+	})
+}
+
+// GetPreferredAllocation returns the preferred allocation from the set of devices specified in the request
+func (a *v1beta1Adapter) GetPreferredAllocation(ctx context.Context, r *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
+	var requests []preferredAllocationRequest
+	for _, req := range r.ContainerRequests {
+		requests = append(requests, preferredAllocationRequest{
+			available:   req.AvailableDeviceIDs,
+			mustInclude: req.MustIncludeDeviceIDs,
+			size:        int(req.AllocationSize),
+		})
+	}
+
+	allocations, err := a.plugin.getPreferredAllocation(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &pluginapi.PreferredAllocationResponse{}
+	for _, devices := range allocations {
+		resp := &pluginapi.ContainerPreferredAllocationResponse{
+			DeviceIDs: devices,
+		}
+		response.ContainerResponses = append(response.ContainerResponses, resp)
+	}
+	return response, nil
+}
+
+// Allocate which return list of devices.
+func (a *v1beta1Adapter) Allocate(ctx context.Context, reqs *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
+	return allocate(a.plugin, reqs, a.containerAllocateResponse)
+}
+
+// allocate allocates the devices of the requests with the plugin and converts the resulting
+// containerAllocations to the responses returned to the kubelet.
+func allocate(plugin devicePlugin, reqs *pluginapi.AllocateRequest, containerAllocateResponse func(string, *containerAllocation) (*pluginapi.ContainerAllocateResponse, error)) (*pluginapi.AllocateResponse, error) {
+	var requests [][]string
+	for _, req := range reqs.ContainerRequests {
+		requests = append(requests, req.DevicesIDs)
+	}
+
+	allocations, err := plugin.allocate(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := pluginapi.AllocateResponse{}
+	for _, allocation := range allocations {
+		response, err := containerAllocateResponse(uuid.New().String(), allocation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get allocate response: %v", err)
+		}
+		responses.ContainerResponses = append(responses.ContainerResponses, response)
+	}
+	return &responses, nil
+}
+
+// PreStartContainer runs the pre-start checks of the plugin, if enabled.
+func (a *v1beta1Adapter) PreStartContainer(ctx context.Context, r *pluginapi.PreStartContainerRequest) (*pluginapi.PreStartContainerResponse, error) {
+	err := a.plugin.preStartContainer(r.DevicesIDs)
+	if err != nil {
+		return nil, err
+	}
+	return &pluginapi.PreStartContainerResponse{}, nil
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+)
+
+// Environment variables used by communication libraries to select the network devices to use.
+const (
+	ncclIBHCAEnvvar     = "NCCL_IB_HCA"
+	ucxNetDevicesEnvvar = "UCX_NET_DEVICES"
+)
+
+const sysfsRoot = "/sys"
+
+// rdmaDevice represents an RDMA device (HCA) and its ports.
+type rdmaDevice struct {
+	name  string
+	ports []string
+}
+
+// getAffinityEnvs returns the environment variables that restrict NCCL and UCX to the RDMA devices that
+// are attached to the NUMA nodes of the specified devices. Network controllers without an RDMA device
+// are not included. No environment variables are returned if the NUMA nodes of the devices are unknown
+// or if no RDMA devices are attached to them.
+func getAffinityEnvs(sysfs string, devices rm.Devices) (map[string]string, error) {
+	nodes := devices.GetNUMANodes()
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+
+	hcas, err := getLocalRDMADevices(sysfs, nodes)
+	if err != nil {
+		return nil, err
+	}
+	if len(hcas) == 0 {
+		return nil, nil
+	}
+
+	var names, ports []string
+	for _, hca := range hcas {
+		names = append(names, hca.name)
+		for _, port := range hca.ports {
+			ports = append(ports, hca.name+":"+port)
+		}
+	}
+
+	// The '=' prefix ensures that NCCL matches the names exactly.
+	envs := map[string]string{
+		ncclIBHCAEnvvar: "=" + strings.Join(names, ","),
+	}
+	if len(ports) > 0 {
+		envs[ucxNetDevicesEnvvar] = strings.Join(ports, ",")
+	}
+	return envs, nil
+}
+
+// getLocalRDMADevices returns the RDMA devices under /sys/class/infiniband that are attached to any of the
+// specified NUMA nodes, sorted by name. RDMA devices are listed rather than network interfaces, since the
+// interfaces of the host are not visible from the network namespace of the plugin.
+func getLocalRDMADevices(sysfs string, nodes []int) ([]rdmaDevice, error) {
+	local := make(map[int]bool)
+	for _, node := range nodes {
+		local[node] = true
+	}
+
+	root := filepath.Join(sysfs, "class/infiniband")
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing RDMA devices: %v", err)
+	}
+
+	var hcas []rdmaDevice
+	for _, e := range entries {
+		b, err := os.ReadFile(filepath.Join(root, e.Name(), "device/numa_node"))
+		if err != nil {
+			continue
+		}
+		node, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err != nil || !local[node] {
+			continue
+		}
+		hca := rdmaDevice{name: e.Name()}
+		ports, err := os.ReadDir(filepath.Join(root, e.Name(), "ports"))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error listing ports of RDMA device %v: %v", e.Name(), err)
+		}
+		for _, p := range ports {
+			hca.ports = append(hca.ports, p.Name())
+		}
+		sort.Strings(hca.ports)
+		hcas = append(hcas, hca)
+	}
+	sort.Slice(hcas, func(i, j int) bool {
+		return hcas[i].name < hcas[j].name
+	})
+
+	return hcas, nil
+}
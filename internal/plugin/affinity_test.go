@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	"github.com/stretchr/testify/require"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func writeSysfsFile(t *testing.T, path string, contents string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(contents+"\n"), 0644))
+}
+
+// newTestSysfs creates a sysfs tree with two RDMA devices on NUMA node 0 and one on NUMA node 1.
+// The Ethernet function on NUMA node 0 is not an RDMA device and has no entry under class/infiniband.
+func newTestSysfs(t *testing.T) string {
+	sysfs := t.TempDir()
+
+	rdmaDevices := []struct {
+		name  string
+		node  string
+		ports []string
+	}{
+		{"mlx5_0", "0", []string{"1"}},
+		{"mlx5_1", "0", []string{"1", "2"}},
+		{"mlx5_2", "1", []string{"1"}},
+	}
+	for _, d := range rdmaDevices {
+		writeSysfsFile(t, filepath.Join(sysfs, "class/infiniband", d.name, "device/numa_node"), d.node)
+		for _, p := range d.ports {
+			writeSysfsFile(t, filepath.Join(sysfs, "class/infiniband", d.name, "ports", p, "state"), "4: ACTIVE")
+		}
+	}
+	writeSysfsFile(t, filepath.Join(sysfs, "bus/pci/devices/0000:0c:00.1/class"), "0x020000")
+	writeSysfsFile(t, filepath.Join(sysfs, "bus/pci/devices/0000:0c:00.1/numa_node"), "0")
+
+	return sysfs
+}
+
+func newTestDevice(id string, numa int) *rm.Device {
+	d := &rm.Device{}
+	d.ID = id
+	if numa >= 0 {
+		d.Topology = &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: int64(numa)}}}
+	}
+	return d
+}
+
+func TestGetAffinityEnvs(t *testing.T) {
+	sysfs := newTestSysfs(t)
+
+	testCases := []struct {
+		description  string
+		devices      []*rm.Device
+		expectedEnvs map[string]string
+	}{
+		{
+			description: "single NUMA node",
+			devices:     []*rm.Device{newTestDevice("GPU-0", 0)},
+			expectedEnvs: map[string]string{
+				ncclIBHCAEnvvar:     "=mlx5_0,mlx5_1",
+				ucxNetDevicesEnvvar: "mlx5_0:1,mlx5_1:1,mlx5_1:2",
+			},
+		},
+		{
+			description: "multiple NUMA nodes",
+			devices:     []*rm.Device{newTestDevice("GPU-0", 0), newTestDevice("GPU-1", 1)},
+			expectedEnvs: map[string]string{
+				ncclIBHCAEnvvar:     "=mlx5_0,mlx5_1,mlx5_2",
+				ucxNetDevicesEnvvar: "mlx5_0:1,mlx5_1:1,mlx5_1:2,mlx5_2:1",
+			},
+		},
+		{
+			description: "no RDMA devices on NUMA node",
+			devices:     []*rm.Device{newTestDevice("GPU-0", 2)},
+		},
+		{
+			description: "unknown NUMA node",
+			devices:     []*rm.Device{newTestDevice("GPU-0", -1)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			devices := make(rm.Devices)
+			for _, d := range tc.devices {
+				devices[d.ID] = d
+			}
+			envs, err := getAffinityEnvs(sysfs, devices)
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedEnvs, envs)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"sort"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+)
+
+// DeviceAllocation describes a single device advertised by a plugin and the
+// container it is currently allocated to, if any.
+type DeviceAllocation struct {
+	Resource  string           `json:"resource"`
+	ID        string           `json:"id"`
+	UUID      string           `json:"uuid"`
+	Index     string           `json:"index"`
+	Health    string           `json:"health"`
+	MIG       *rm.MigPlacement `json:"mig,omitempty"`
+	Namespace string           `json:"namespace,omitempty"`
+	Pod       string           `json:"pod,omitempty"`
+	Container string           `json:"container,omitempty"`
+}
+
+// GetDeviceAllocations returns the devices advertised by the plugin, including
+// the replicas of shared devices, joined with the specified allocations.
+// MIG devices whose placement could not be determined carry the error in their placement.
+func (plugin *NvidiaDevicePlugin) GetDeviceAllocations(allocations podresources.Allocations) []DeviceAllocation {
+	resource := string(plugin.rm.Resource())
+
+	placements := plugin.rm.GetMigPlacements()
+
+	allocated := make(map[string]podresources.Allocation)
+	for _, a := range allocations {
+		if a.Resource != resource {
+			continue
+		}
+		for _, id := range a.DeviceIDs {
+			allocated[id] = a
+		}
+	}
+
+	var deviceAllocations []DeviceAllocation
+	for id, d := range plugin.rm.Devices() {
+		da := DeviceAllocation{
+			Resource: resource,
+			ID:       id,
+			UUID:     d.GetUUID(),
+			Index:    d.Index,
+			Health:   d.Health,
+		}
+		if placement, exists := placements[id]; exists {
+			da.MIG = &placement
+		}
+		if a, exists := allocated[id]; exists {
+			da.Namespace = a.Namespace
+			da.Pod = a.Pod
+			da.Container = a.Container
+		}
+		deviceAllocations = append(deviceAllocations, da)
+	}
+	sort.Slice(deviceAllocations, func(i, j int) bool {
+		if deviceAllocations[i].Index != deviceAllocations[j].Index {
+			return rm.LessIndex(deviceAllocations[i].Index, deviceAllocations[j].Index)
+		}
+		return deviceAllocations[i].ID < deviceAllocations[j].ID
+	})
+
+	return deviceAllocations
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"testing"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	"github.com/stretchr/testify/require"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestGetDeviceAllocations(t *testing.T) {
+	newDevice := func(id string, index string, health string) *rm.Device {
+		d := newTestDevice(id, -1)
+		d.Index = index
+		d.Health = health
+		return d
+	}
+
+	devices := make(rm.Devices)
+	for _, d := range []*rm.Device{
+		newDevice(string(rm.NewAnnotatedID("MIG-1", 0)), "0:2", pluginapi.Healthy),
+		newDevice(string(rm.NewAnnotatedID("MIG-1", 1)), "0:2", pluginapi.Healthy),
+		newDevice(string(rm.NewAnnotatedID("MIG-0", 0)), "0:10", pluginapi.Unhealthy),
+	} {
+		devices[d.ID] = d
+	}
+	placements := map[string]rm.MigPlacement{
+		"MIG-0::0": {Error: "failed to get GPU Instance ID: ERROR_UNKNOWN"},
+		"MIG-1::0": {Parent: "GPU-0", GI: 2, CI: 0},
+		"MIG-1::1": {Parent: "GPU-0", GI: 2, CI: 0},
+	}
+
+	plugin := NvidiaDevicePlugin{
+		rm: &testResourceManager{resource: "nvidia.com/mig-1g.5gb", devices: devices, placements: placements},
+	}
+
+	allocations := podresources.Allocations{
+		{Namespace: "default", Pod: "pod-a", Container: "ctr", Resource: "nvidia.com/mig-1g.5gb", DeviceIDs: []string{"MIG-1::1"}},
+		{Namespace: "default", Pod: "pod-b", Container: "ctr", Resource: "nvidia.com/gpu", DeviceIDs: []string{"MIG-1::0"}},
+	}
+
+	deviceAllocations := plugin.GetDeviceAllocations(allocations)
+
+	// Devices are sorted numerically by index.
+	expected := []DeviceAllocation{
+		{
+			Resource: "nvidia.com/mig-1g.5gb",
+			ID:       "MIG-1::0",
+			UUID:     "MIG-1",
+			Index:    "0:2",
+			Health:   pluginapi.Healthy,
+			MIG:      &rm.MigPlacement{Parent: "GPU-0", GI: 2, CI: 0},
+		},
+		{
+			Resource:  "nvidia.com/mig-1g.5gb",
+			ID:        "MIG-1::1",
+			UUID:      "MIG-1",
+			Index:     "0:2",
+			Health:    pluginapi.Healthy,
+			MIG:       &rm.MigPlacement{Parent: "GPU-0", GI: 2, CI: 0},
+			Namespace: "default",
+			Pod:       "pod-a",
+			Container: "ctr",
+		},
+		{
+			Resource: "nvidia.com/mig-1g.5gb",
+			ID:       "MIG-0::0",
+			UUID:     "MIG-0",
+			Index:    "0:10",
+			Health:   pluginapi.Unhealthy,
+			MIG:      &rm.MigPlacement{Error: "failed to get GPU Instance ID: ERROR_UNKNOWN"},
+		},
+	}
+	require.Equal(t, expected, deviceAllocations)
+}
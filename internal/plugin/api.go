@@ -16,11 +16,27 @@
 
 package plugin
 
-import "github.com/NVIDIA/k8s-device-plugin/internal/rm"
+import (
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+)
 
 // Interface defines the API for the plugin package
 type Interface interface {
 	Devices() rm.Devices
 	Start() error
 	Stop() error
+	Status() Status
+	Describe() (*Description, error)
+	GetDeviceAllocations(podresources.Allocations) []DeviceAllocation
+}
+
+// Status describes the state of a plugin.
+// HealthCheckError is set if the health checks of the plugin stopped with an error.
+type Status struct {
+	Resource         string `json:"resource"`
+	Serving          bool   `json:"serving"`
+	Registered       bool   `json:"registered"`
+	HealthChecking   bool   `json:"healthChecking"`
+	HealthCheckError string `json:"healthCheckError,omitempty"`
 }
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	"github.com/google/uuid"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// Description describes the devices advertised by a plugin and the response
+// it returns to the kubelet for a sample allocation request.
+type Description struct {
+	Resource       string                               `json:"resource"`
+	Devices        []DeviceDescription                  `json:"devices"`
+	SampleRequest  []string                             `json:"sampleRequest,omitempty"`
+	SampleResponse *pluginapi.ContainerAllocateResponse `json:"sampleResponse,omitempty"`
+}
+
+// DeviceDescription describes a single device advertised by a plugin.
+// The replicas of a shared device are described together.
+type DeviceDescription struct {
+	ID         string   `json:"id"`
+	Index      string   `json:"index"`
+	NUMANode   *int     `json:"numaNode,omitempty"`
+	Replicas   []string `json:"replicas,omitempty"`
+	Paths      []string `json:"paths"`
+	CDIDevices []string `json:"cdiDevices,omitempty"`
+}
+
+// Describe returns a description of the devices of the plugin without starting it.
+// The sample allocation request is for the first device advertised by the plugin.
+func (plugin *NvidiaDevicePlugin) Describe() (*Description, error) {
+	devices := plugin.rm.Devices()
+	ids := devices.GetIDs()
+	sort.Strings(ids)
+
+	description := &Description{
+		Resource: string(plugin.rm.Resource()),
+	}
+
+	byUUID := make(map[string]*DeviceDescription)
+	for _, id := range ids {
+		d := devices[id]
+		uuid := d.GetUUID()
+		if dd, exists := byUUID[uuid]; exists {
+			dd.Replicas = append(dd.Replicas, id)
+			continue
+		}
+
+		dd := &DeviceDescription{
+			ID:    uuid,
+			Index: d.Index,
+			Paths: d.Paths,
+		}
+		if numaNode, exists := d.GetNUMANode(); exists {
+			dd.NUMANode = &numaNode
+		}
+		if id != uuid {
+			dd.Replicas = []string{id}
+		}
+		if plugin.cdiEnabled {
+			for _, deviceID := range plugin.deviceIDsFromAnnotatedDeviceIDs([]string{id}) {
+				dd.CDIDevices = append(dd.CDIDevices, plugin.cdiHandler.QualifiedName("gpu", deviceID))
+			}
+		}
+		byUUID[uuid] = dd
+	}
+
+	for _, dd := range byUUID {
+		description.Devices = append(description.Devices, *dd)
+	}
+	sort.Slice(description.Devices, func(i, j int) bool {
+		if description.Devices[i].Index != description.Devices[j].Index {
+			return rm.LessIndex(description.Devices[i].Index, description.Devices[j].Index)
+		}
+		return description.Devices[i].ID < description.Devices[j].ID
+	})
+
+	if len(ids) == 0 {
+		return description, nil
+	}
+
+	adapter, err := newKubeletAdapter(plugin, plugin.getKubeletVersion())
+	if err != nil {
+		return nil, err
+	}
+
+	description.SampleRequest = ids[:1]
+	allocations, err := plugin.allocate([][]string{description.SampleRequest})
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate sample request %v: %v", description.SampleRequest, err)
+	}
+	response, err := adapter.containerAllocateResponse(uuid.New().String(), allocations[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response for sample request %v: %v", description.SampleRequest, err)
+	}
+	description.SampleResponse = response
+
+	return description, nil
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"testing"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/cdi"
+	"github.com/NVIDIA/k8s-device-plugin/internal/mps"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	"github.com/stretchr/testify/require"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// testResourceManager is a ResourceManager for a fixed set of devices.
+type testResourceManager struct {
+	rm.ResourceManager
+	resource   spec.ResourceName
+	devices    rm.Devices
+	placements map[string]rm.MigPlacement
+}
+
+func (r *testResourceManager) Resource() spec.ResourceName {
+	return r.resource
+}
+
+func (r *testResourceManager) Devices() rm.Devices {
+	return r.devices
+}
+
+func (r *testResourceManager) GetDevicePaths(ids []string) []string {
+	return r.devices.Subset(ids).GetPaths()
+}
+
+func (r *testResourceManager) GetMigPlacements() map[string]rm.MigPlacement {
+	return r.placements
+}
+
+func TestDescribe(t *testing.T) {
+	newDevice := func(id string, index string, numa int) *rm.Device {
+		d := newTestDevice(id, numa)
+		d.Index = index
+		d.Paths = []string{"/dev/nvidia" + index}
+		return d
+	}
+
+	devices := make(rm.Devices)
+	for _, d := range []*rm.Device{
+		newDevice(string(rm.NewAnnotatedID("GPU-1", 0)), "2", 1),
+		newDevice(string(rm.NewAnnotatedID("GPU-1", 1)), "2", 1),
+		newDevice(string(rm.NewAnnotatedID("GPU-0", 0)), "10", -1),
+		newDevice(string(rm.NewAnnotatedID("GPU-0", 1)), "10", -1),
+	} {
+		devices[d.ID] = d
+	}
+
+	falseValue := false
+	deviceIDStrategy := spec.DeviceIDStrategyUUID
+	deviceListStrategies, _ := spec.NewDeviceListStrategies([]string{"envvar"})
+	plugin := NvidiaDevicePlugin{
+		rm: &testResourceManager{resource: "nvidia.com/gpu", devices: devices},
+		config: &spec.Config{
+			Flags: spec.Flags{
+				CommandLineFlags: spec.CommandLineFlags{
+					GDSEnabled:   &falseValue,
+					MOFEDEnabled: &falseValue,
+					Plugin: &spec.PluginCommandLineFlags{
+						PassDeviceSpecs:  &falseValue,
+						DeviceIDStrategy: &deviceIDStrategy,
+					},
+				},
+			},
+		},
+		cdiHandler: &cdi.InterfaceMock{
+			QualifiedNameFunc: func(c string, s string) string {
+				return "nvidia.com/" + c + "=" + s
+			},
+		},
+		cdiEnabled:           true,
+		deviceListEnvvar:     "NVIDIA_VISIBLE_DEVICES",
+		deviceListStrategies: deviceListStrategies,
+		mpsManager:           mps.NewNullManager(),
+	}
+
+	numaNode := 1
+	description, err := plugin.Describe()
+	require.NoError(t, err)
+	require.Equal(t, "nvidia.com/gpu", description.Resource)
+	// Devices are sorted numerically by index.
+	require.Equal(t, []DeviceDescription{
+		{
+			ID:         "GPU-1",
+			Index:      "2",
+			NUMANode:   &numaNode,
+			Replicas:   []string{"GPU-1::0", "GPU-1::1"},
+			Paths:      []string{"/dev/nvidia2"},
+			CDIDevices: []string{"nvidia.com/gpu=GPU-1"},
+		},
+		{
+			ID:         "GPU-0",
+			Index:      "10",
+			Replicas:   []string{"GPU-0::0", "GPU-0::1"},
+			Paths:      []string{"/dev/nvidia10"},
+			CDIDevices: []string{"nvidia.com/gpu=GPU-0"},
+		},
+	}, description.Devices)
+	require.Equal(t, []string{"GPU-0::0"}, description.SampleRequest)
+	require.Equal(t, &pluginapi.ContainerAllocateResponse{
+		Envs: map[string]string{"NVIDIA_VISIBLE_DEVICES": "GPU-0"},
+	}, description.SampleResponse)
+}
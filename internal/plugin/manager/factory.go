@@ -25,6 +25,9 @@ import (
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
 	"github.com/NVIDIA/k8s-device-plugin/internal/cdi"
+	"github.com/NVIDIA/k8s-device-plugin/internal/plugin"
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+	"github.com/NVIDIA/k8s-device-plugin/internal/reporter"
 )
 
 type manager struct {
@@ -32,10 +35,13 @@ type manager struct {
 	failOnInitError bool
 	nvmllib         nvml.Interface
 
-	cdiHandler cdi.Interface
-	cdiEnabled bool
-	config     *spec.Config
-	infolib    info.Interface
+	cdiHandler     cdi.Interface
+	cdiEnabled     bool
+	config         *spec.Config
+	infolib        info.Interface
+	healthReporter reporter.Interface
+	kubeletVersion plugin.KubeletVersionFunc
+	podResources   podresources.Interface
 }
 
 // New creates a new plugin manager with the supplied options.
@@ -56,6 +62,9 @@ func New(opts ...Option) (Interface, error) {
 	if m.cdiHandler == nil {
 		m.cdiHandler = cdi.NewNullHandler()
 	}
+	if m.healthReporter == nil {
+		m.healthReporter = reporter.NewNullReporter()
+	}
 
 	mode, err := m.resolveMode()
 	if err != nil {
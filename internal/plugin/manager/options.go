@@ -19,6 +19,9 @@ package manager
 import (
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
 	"github.com/NVIDIA/k8s-device-plugin/internal/cdi"
+	"github.com/NVIDIA/k8s-device-plugin/internal/plugin"
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+	"github.com/NVIDIA/k8s-device-plugin/internal/reporter"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
 )
 
@@ -66,3 +69,24 @@ func WithConfig(config *spec.Config) Option {
 		m.config = config
 	}
 }
+
+// WithHealthReporter sets the reporter used to report the health of devices outside of the plugin
+func WithHealthReporter(healthReporter reporter.Interface) Option {
+	return func(m *manager) {
+		m.healthReporter = healthReporter
+	}
+}
+
+// WithKubeletVersion sets the function used by the plugins to get the version of the kubelet
+func WithKubeletVersion(kubeletVersion plugin.KubeletVersionFunc) Option {
+	return func(m *manager) {
+		m.kubeletVersion = kubeletVersion
+	}
+}
+
+// WithPodResources sets the source of the devices allocated by the kubelet for the manager
+func WithPodResources(podResources podresources.Interface) Option {
+	return func(m *manager) {
+		m.podResources = podResources
+	}
+}
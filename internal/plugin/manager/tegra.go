@@ -27,14 +27,14 @@ type tegramanager manager
 
 // GetPlugins returns the plugins associated with the NVML resources available on the node
 func (m *tegramanager) GetPlugins() ([]plugin.Interface, error) {
-	rms, err := rm.NewTegraResourceManagers(m.config)
+	rms, err := rm.NewTegraResourceManagers(m.config, m.podResources)
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct NVML resource managers: %v", err)
 	}
 
 	var plugins []plugin.Interface
 	for _, r := range rms {
-		plugins = append(plugins, plugin.NewNvidiaDevicePlugin(m.config, r, m.cdiHandler, m.cdiEnabled))
+		plugins = append(plugins, plugin.NewNvidiaDevicePlugin(m.config, r, m.cdiHandler, m.cdiEnabled, m.healthReporter, m.kubeletVersion))
 	}
 	return plugins, nil
 }
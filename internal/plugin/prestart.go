@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/NVIDIA/k8s-device-plugin/internal/metrics"
+	"github.com/NVIDIA/k8s-device-plugin/internal/mig"
+
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// preStartContainer checks that the specified devices can still be used before the container they are allocated to is started.
+// The checks are only run if enabled, in which case the kubelet fails to start the container if they fail.
+func (plugin *NvidiaDevicePlugin) preStartContainer(ids []string) error {
+	if !plugin.preStartChecksEnabled() {
+		return nil
+	}
+
+	resource := string(plugin.rm.Resource())
+	check, err := plugin.preStartCheck(ids)
+	if err != nil {
+		metrics.PreStartCheckFailures.WithLabelValues(resource, check).Inc()
+		klog.Warningf("Pre-start checks failed for '%s' devices %v: %v", resource, ids, err)
+		return fmt.Errorf("pre-start checks failed for '%s': %v", resource, err)
+	}
+
+	return nil
+}
+
+func (plugin *NvidiaDevicePlugin) preStartChecksEnabled() bool {
+	return plugin.config.Flags.Plugin.PreStartChecks != nil && *plugin.config.Flags.Plugin.PreStartChecks
+}
+
+// preStartCheck checks that the specified devices are healthy, that their
+// device nodes exist under the driver root, and that the MIG capabilities of
+// MIG devices still exist. The check that failed is returned with the error.
+func (plugin *NvidiaDevicePlugin) preStartCheck(ids []string) (string, error) {
+	devices := plugin.rm.Devices()
+	for _, id := range ids {
+		d, exists := devices[id]
+		if !exists {
+			return metrics.PreStartCheckUnknownDevice, fmt.Errorf("unknown device: %v", id)
+		}
+		if d.Health != pluginapi.Healthy {
+			return metrics.PreStartCheckUnhealthyDevice, fmt.Errorf("device %v is unhealthy", id)
+		}
+	}
+
+	paths := plugin.rm.GetDevicePaths(ids)
+
+	err := checkDeviceNodes(plugin.driverRoot(), paths)
+	if err != nil {
+		return metrics.PreStartCheckDeviceNode, err
+	}
+
+	if !devices.Subset(ids).ContainsMigDevices() {
+		return "", nil
+	}
+	capDevicePaths, err := mig.GetMigCapabilityDevicePaths()
+	if err != nil {
+		return metrics.PreStartCheckMigCapability, fmt.Errorf("error getting MIG capability device paths: %v", err)
+	}
+	err = checkMigCapabilities(capDevicePaths, paths)
+	if err != nil {
+		return metrics.PreStartCheckMigCapability, err
+	}
+
+	return "", nil
+}
+
+// driverRoot returns the path at which the driver root is mounted in the plugin container.
+func (plugin *NvidiaDevicePlugin) driverRoot() string {
+	if plugin.config.Flags.Plugin.ContainerDriverRoot == nil {
+		return "/"
+	}
+	return *plugin.config.Flags.Plugin.ContainerDriverRoot
+}
+
+// checkDeviceNodes checks that the specified device nodes exist under the driver root.
+// Device nodes that are optional for containers are not checked.
+func checkDeviceNodes(driverRoot string, paths []string) error {
+	for _, p := range paths {
+		if optionalDeviceNodes[p] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(driverRoot, p)); err != nil {
+			return fmt.Errorf("missing device node %v: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// checkMigCapabilities checks that the MIG capability of each of the specified
+// MIG capability device nodes still exists. The capDevicePaths map the
+// capability files to their device nodes.
+func checkMigCapabilities(capDevicePaths map[string]string, paths []string) error {
+	capPaths := make(map[string]string)
+	for capPath, devicePath := range capDevicePaths {
+		capPaths[devicePath] = capPath
+	}
+
+	for _, p := range paths {
+		if !mig.IsMigCapabilityDevicePath(p) {
+			continue
+		}
+		capPath, exists := capPaths[p]
+		if !exists {
+			return fmt.Errorf("no MIG capability found for device node %v", p)
+		}
+		if _, err := os.Stat(capPath); err != nil {
+			return fmt.Errorf("missing MIG capability %v: %v", capPath, err)
+		}
+	}
+	return nil
+}
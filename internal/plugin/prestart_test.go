@@ -0,0 +1,164 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	"github.com/stretchr/testify/require"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func TestPreStartContainer(t *testing.T) {
+	driverRoot := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(driverRoot, "dev"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(driverRoot, "dev", "nvidia0"), nil, 0644))
+
+	newDevice := func(id string, path string, health string) *rm.Device {
+		d := newTestDevice(id, -1)
+		d.Index = "0"
+		d.Paths = []string{path}
+		d.Health = health
+		return d
+	}
+
+	devices := make(rm.Devices)
+	for _, d := range []*rm.Device{
+		newDevice("GPU-0", "/dev/nvidia0", pluginapi.Healthy),
+		newDevice("GPU-1", "/dev/nvidia1", pluginapi.Healthy),
+		newDevice("GPU-2", "/dev/nvidia0", pluginapi.Unhealthy),
+	} {
+		devices[d.ID] = d
+	}
+
+	testCases := []struct {
+		description   string
+		enabled       bool
+		ids           []string
+		expectedError bool
+	}{
+		{
+			description: "disabled",
+			ids:         []string{"GPU-2"},
+		},
+		{
+			description: "healthy device",
+			enabled:     true,
+			ids:         []string{"GPU-0"},
+		},
+		{
+			description:   "unknown device",
+			enabled:       true,
+			ids:           []string{"GPU-3"},
+			expectedError: true,
+		},
+		{
+			description:   "unhealthy device",
+			enabled:       true,
+			ids:           []string{"GPU-0", "GPU-2"},
+			expectedError: true,
+		},
+		{
+			description:   "missing device node",
+			enabled:       true,
+			ids:           []string{"GPU-1"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			enabled := tc.enabled
+			plugin := NvidiaDevicePlugin{
+				rm: &testResourceManager{resource: "nvidia.com/gpu", devices: devices},
+				config: &spec.Config{
+					Flags: spec.Flags{
+						CommandLineFlags: spec.CommandLineFlags{
+							Plugin: &spec.PluginCommandLineFlags{
+								ContainerDriverRoot: &driverRoot,
+								PreStartChecks:      &enabled,
+							},
+						},
+					},
+				},
+			}
+
+			adapter := newV1beta1Adapter(&plugin, "").(*v1beta1Adapter)
+
+			options, err := adapter.GetDevicePluginOptions(context.Background(), &pluginapi.Empty{})
+			require.NoError(t, err)
+			require.Equal(t, tc.enabled, options.PreStartRequired)
+
+			_, err = adapter.PreStartContainer(context.Background(), &pluginapi.PreStartContainerRequest{DevicesIDs: tc.ids})
+			if tc.expectedError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCheckMigCapabilities(t *testing.T) {
+	capsRoot := t.TempDir()
+	giCap := filepath.Join(capsRoot, "gpu0", "mig", "gi1", "access")
+	ciCap := filepath.Join(capsRoot, "gpu0", "mig", "gi1", "ci0", "access")
+	require.NoError(t, os.MkdirAll(filepath.Dir(ciCap), 0755))
+	require.NoError(t, os.WriteFile(giCap, nil, 0644))
+
+	capDevicePaths := map[string]string{
+		giCap: "/dev/nvidia-caps/nvidia-cap12",
+		ciCap: "/dev/nvidia-caps/nvidia-cap13",
+	}
+
+	testCases := []struct {
+		description   string
+		paths         []string
+		expectedError bool
+	}{
+		{
+			description: "capability exists",
+			paths:       []string{"/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap12"},
+		},
+		{
+			description:   "capability file is missing",
+			paths:         []string{"/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap13"},
+			expectedError: true,
+		},
+		{
+			description:   "capability no longer exists",
+			paths:         []string{"/dev/nvidia0", "/dev/nvidia-caps/nvidia-cap14"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			err := checkMigCapabilities(capDevicePaths, tc.paths)
+			if tc.expectedError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+
+	"k8s.io/klog/v2"
+)
+
+// GetUnchangedPlugins returns the running plugins that can be kept in place of the new plugins, by resource name.
+// A running plugin is kept if it is serving, the settings that apply to its resource are the same in the config
+// it was started with and the new config, and the devices of its resource are unchanged.
+func GetUnchangedPlugins(running []Interface, runningConfig *spec.Config, plugins []Interface, config *spec.Config) map[string]Interface {
+	if len(running) == 0 || runningConfig == nil {
+		return nil
+	}
+
+	serving := make(map[string]Interface)
+	oldDevices := make(rm.DeviceMap)
+	for _, p := range running {
+		status := p.Status()
+		if !status.Serving {
+			continue
+		}
+		serving[status.Resource] = p
+		oldDevices[spec.ResourceName(status.Resource)] = p.Devices()
+	}
+
+	newDevices := make(rm.DeviceMap)
+	for _, p := range plugins {
+		if len(p.Devices()) == 0 {
+			continue
+		}
+		newDevices[spec.ResourceName(p.Status().Resource)] = p.Devices()
+	}
+
+	added, removed, changed := oldDevices.Diff(newDevices)
+	klog.Infof("Resources added: %v, removed: %v, changed: %v", added, removed, changed)
+
+	unchanged := make(map[string]Interface)
+	for resource, p := range serving {
+		name := spec.ResourceName(resource)
+		if _, exists := newDevices[name]; !exists {
+			continue
+		}
+		if containsResource(changed, name) {
+			continue
+		}
+		if !runningConfig.EqualForResource(config, name) {
+			klog.Infof("Config for resource %v changed", name)
+			continue
+		}
+		unchanged[resource] = p
+	}
+	return unchanged
+}
+
+func containsResource(names []spec.ResourceName, name spec.ResourceName) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
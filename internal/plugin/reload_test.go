@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"testing"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	"github.com/stretchr/testify/require"
+)
+
+// testPlugin is a plugin for a fixed resource and set of devices.
+type testPlugin struct {
+	Interface
+	resource string
+	serving  bool
+	devices  rm.Devices
+}
+
+func (p *testPlugin) Devices() rm.Devices {
+	return p.devices
+}
+
+func (p *testPlugin) Status() Status {
+	return Status{Resource: p.resource, Serving: p.serving}
+}
+
+func TestGetUnchangedPlugins(t *testing.T) {
+	newDevices := func(ids ...string) rm.Devices {
+		devices := make(rm.Devices)
+		for _, id := range ids {
+			devices[id] = newTestDevice(id, -1)
+		}
+		return devices
+	}
+	newConfig := func(migStrategy string, replicas int) *spec.Config {
+		name, err := spec.NewResourceName("nvidia.com/gpu")
+		require.NoError(t, err)
+		return &spec.Config{
+			Flags: spec.Flags{CommandLineFlags: spec.CommandLineFlags{MigStrategy: &migStrategy}},
+			Sharing: spec.Sharing{
+				TimeSlicing: spec.TimeSlicing{
+					Resources: []spec.ReplicatedResource{
+						{Name: name, Devices: spec.ReplicatedDevices{All: true}, Replicas: replicas},
+					},
+				},
+			},
+		}
+	}
+
+	gpus := &testPlugin{resource: "nvidia.com/gpu", serving: true, devices: newDevices("GPU-0::0", "GPU-0::1")}
+	migs := &testPlugin{resource: "nvidia.com/mig-1g.5gb", serving: true, devices: newDevices("MIG-0", "MIG-1")}
+
+	testCases := []struct {
+		description   string
+		running       []Interface
+		runningConfig *spec.Config
+		plugins       []Interface
+		config        *spec.Config
+		expected      map[string]Interface
+	}{
+		{
+			description:   "unchanged config keeps all plugins",
+			running:       []Interface{gpus, migs},
+			runningConfig: newConfig("mixed", 2),
+			plugins: []Interface{
+				&testPlugin{resource: "nvidia.com/gpu", devices: newDevices("GPU-0::0", "GPU-0::1")},
+				&testPlugin{resource: "nvidia.com/mig-1g.5gb", devices: newDevices("MIG-0", "MIG-1")},
+			},
+			config:   newConfig("mixed", 2),
+			expected: map[string]Interface{"nvidia.com/gpu": gpus, "nvidia.com/mig-1g.5gb": migs},
+		},
+		{
+			description:   "changed replicas only restart the shared resource",
+			running:       []Interface{gpus, migs},
+			runningConfig: newConfig("mixed", 2),
+			plugins: []Interface{
+				&testPlugin{resource: "nvidia.com/gpu", devices: newDevices("GPU-0::0", "GPU-0::1", "GPU-0::2", "GPU-0::3")},
+				&testPlugin{resource: "nvidia.com/mig-1g.5gb", devices: newDevices("MIG-0", "MIG-1")},
+			},
+			config:   newConfig("mixed", 4),
+			expected: map[string]Interface{"nvidia.com/mig-1g.5gb": migs},
+		},
+		{
+			description:   "changed flags restart all plugins",
+			running:       []Interface{gpus, migs},
+			runningConfig: newConfig("mixed", 2),
+			plugins: []Interface{
+				&testPlugin{resource: "nvidia.com/gpu", devices: newDevices("GPU-0::0", "GPU-0::1")},
+				&testPlugin{resource: "nvidia.com/mig-1g.5gb", devices: newDevices("MIG-0", "MIG-1")},
+			},
+			config:   newConfig("single", 2),
+			expected: map[string]Interface{},
+		},
+		{
+			description: "plugins that are not serving are restarted",
+			running: []Interface{
+				gpus,
+				&testPlugin{resource: "nvidia.com/mig-1g.5gb", devices: newDevices("MIG-0", "MIG-1")},
+			},
+			runningConfig: newConfig("mixed", 2),
+			plugins: []Interface{
+				&testPlugin{resource: "nvidia.com/gpu", devices: newDevices("GPU-0::0", "GPU-0::1")},
+				&testPlugin{resource: "nvidia.com/mig-1g.5gb", devices: newDevices("MIG-0", "MIG-1")},
+			},
+			config:   newConfig("mixed", 2),
+			expected: map[string]Interface{"nvidia.com/gpu": gpus},
+		},
+		{
+			description: "no running plugins",
+			plugins: []Interface{
+				&testPlugin{resource: "nvidia.com/gpu", devices: newDevices("GPU-0::0", "GPU-0::1")},
+			},
+			config: newConfig("mixed", 2),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			unchanged := GetUnchangedPlugins(tc.running, tc.runningConfig, tc.plugins, tc.config)
+			require.Equal(t, tc.expected, unchanged)
+		})
+	}
+}
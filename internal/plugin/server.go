@@ -23,15 +23,18 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
 	"github.com/NVIDIA/k8s-device-plugin/internal/cdi"
+	"github.com/NVIDIA/k8s-device-plugin/internal/metrics"
+	"github.com/NVIDIA/k8s-device-plugin/internal/mps"
+	"github.com/NVIDIA/k8s-device-plugin/internal/reporter"
 	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
 	cdiapi "github.com/container-orchestrated-devices/container-device-interface/pkg/cdi"
+	"github.com/prometheus/client_golang/prometheus"
 
-	"github.com/google/uuid"
-	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 
 	"k8s.io/klog/v2"
@@ -44,6 +47,14 @@ const (
 	deviceListAsVolumeMountsContainerPathRoot = "/var/run/nvidia-container-devices"
 )
 
+// optionalDeviceNodes are the device nodes that are only passed to containers if they exist
+var optionalDeviceNodes = map[string]bool{
+	"/dev/nvidiactl":        true,
+	"/dev/nvidia-uvm":       true,
+	"/dev/nvidia-uvm-tools": true,
+	"/dev/nvidia-modeset":   true,
+}
+
 // NvidiaDevicePlugin implements the Kubernetes device plugin API
 type NvidiaDevicePlugin struct {
 	rm                   rm.ResourceManager
@@ -56,17 +67,35 @@ type NvidiaDevicePlugin struct {
 	cdiEnabled          bool
 	cdiAnnotationPrefix string
 
-	server *grpc.Server
-	health chan *rm.Device
-	stop   chan interface{}
+	healthReporter reporter.Interface
+	kubeletVersion KubeletVersionFunc
+	mpsManager     mps.Interface
+
+	adapter kubeletAdapter
+	server  *grpc.Server
+	health  chan *rm.HealthEvent
+	stop    chan interface{}
+
+	statusLock sync.Mutex
+	status     Status
 }
 
 // NewNvidiaDevicePlugin returns an initialized NvidiaDevicePlugin
-func NewNvidiaDevicePlugin(config *spec.Config, resourceManager rm.ResourceManager, cdiHandler cdi.Interface, cdiEnabled bool) *NvidiaDevicePlugin {
+func NewNvidiaDevicePlugin(config *spec.Config, resourceManager rm.ResourceManager, cdiHandler cdi.Interface, cdiEnabled bool, healthReporter reporter.Interface, kubeletVersion KubeletVersionFunc) *NvidiaDevicePlugin {
 	_, name := resourceManager.Resource().Split()
 
 	deviceListStrategies, _ := spec.NewDeviceListStrategies(*config.Flags.Plugin.DeviceListStrategy)
 
+	var mpsRoot string
+	if config.Flags.Plugin.MPSRoot != nil {
+		mpsRoot = *config.Flags.Plugin.MPSRoot
+	}
+	mpsManager := mps.New(
+		mps.WithEnabled(config.Sharing.UsesMPS()),
+		mps.WithRoot(mpsRoot),
+		mps.WithDevices(resourceManager.Devices()),
+	)
+
 	return &NvidiaDevicePlugin{
 		rm:                   resourceManager,
 		config:               config,
@@ -76,26 +105,74 @@ func NewNvidiaDevicePlugin(config *spec.Config, resourceManager rm.ResourceManag
 		cdiHandler:           cdiHandler,
 		cdiEnabled:           cdiEnabled,
 		cdiAnnotationPrefix:  *config.Flags.Plugin.CDIAnnotationPrefix,
+		healthReporter:       healthReporter,
+		kubeletVersion:       kubeletVersion,
+		mpsManager:           mpsManager,
 
 		// These will be reinitialized every
 		// time the plugin server is restarted.
-		server: nil,
-		health: nil,
-		stop:   nil,
+		adapter: nil,
+		server:  nil,
+		health:  nil,
+		stop:    nil,
 	}
 }
 
 func (plugin *NvidiaDevicePlugin) initialize() {
 	plugin.server = grpc.NewServer([]grpc.ServerOption{}...)
-	plugin.health = make(chan *rm.Device)
+	plugin.health = make(chan *rm.HealthEvent)
 	plugin.stop = make(chan interface{})
 }
 
 func (plugin *NvidiaDevicePlugin) cleanup() {
 	close(plugin.stop)
+	plugin.adapter = nil
 	plugin.server = nil
 	plugin.health = nil
 	plugin.stop = nil
+	plugin.updateStatus(func(s *Status) {
+		*s = Status{}
+	})
+}
+
+// Status returns the current status of the plugin.
+func (plugin *NvidiaDevicePlugin) Status() Status {
+	plugin.statusLock.Lock()
+	defer plugin.statusLock.Unlock()
+	status := plugin.status
+	status.Resource = string(plugin.rm.Resource())
+	return status
+}
+
+func (plugin *NvidiaDevicePlugin) updateStatus(update func(*Status)) {
+	plugin.statusLock.Lock()
+	defer plugin.statusLock.Unlock()
+	update(&plugin.status)
+}
+
+// KubeletVersionFunc returns the version of the kubelet that the plugins are registered with.
+type KubeletVersionFunc func() (string, error)
+
+// getKubeletVersion returns the version of the kubelet, or an empty string if it is unknown.
+func (plugin *NvidiaDevicePlugin) getKubeletVersion() string {
+	if plugin.kubeletVersion == nil {
+		return ""
+	}
+	version, err := plugin.kubeletVersion()
+	if err != nil {
+		klog.Warningf("Unable to get the kubelet version for '%s': %v", plugin.rm.Resource(), err)
+		return ""
+	}
+	return version
+}
+
+// kubeletForwardsCDIDevices returns whether the plugin is configured to assume that the kubelet
+// forwards the CDIDevices field of the response, regardless of its version.
+func (plugin *NvidiaDevicePlugin) kubeletForwardsCDIDevices() bool {
+	if plugin.config == nil || plugin.config.Flags.Plugin == nil || plugin.config.Flags.Plugin.KubeletCDIDevices == nil {
+		return false
+	}
+	return *plugin.config.Flags.Plugin.KubeletCDIDevices
 }
 
 // Devices returns the full set of devices associated with the plugin.
@@ -108,9 +185,34 @@ func (plugin *NvidiaDevicePlugin) Devices() rm.Devices {
 func (plugin *NvidiaDevicePlugin) Start() error {
 	plugin.initialize()
 
-	err := plugin.Serve()
+	kubeletVersion := plugin.getKubeletVersion()
+	adapter, err := newKubeletAdapter(plugin, kubeletVersion)
+	if err != nil {
+		klog.Infof("Could not select kubelet API for '%s': %s", plugin.rm.Resource(), err)
+		plugin.cleanup()
+		return err
+	}
+	klog.Infof("Using %s for '%s'", adapter.name(), plugin.rm.Resource())
+	if plugin.deviceListStrategies.Includes(spec.DeviceListStrategyCDICRI) && !adapter.cdiDevicesSupported() {
+		if kubeletVersion == "" {
+			klog.Warningf("The %s strategy was selected but the kubelet version is unknown; passing CDI devices for '%s' as annotations. Set --node-name (with permission to get the node) or --kubelet-cdi-devices to pass them in the CDIDevices field", spec.DeviceListStrategyCDICRI, plugin.rm.Resource())
+		} else {
+			klog.Warningf("The %s strategy is not supported by the %s with kubelet %s; passing CDI devices for '%s' as annotations. Set --kubelet-cdi-devices if the DevicePluginCDIDevices feature gate is enabled", spec.DeviceListStrategyCDICRI, adapter.name(), kubeletVersion, plugin.rm.Resource())
+		}
+	}
+	plugin.adapter = adapter
+
+	err = plugin.mpsManager.Start()
+	if err != nil {
+		klog.Infof("Could not start MPS control daemons for '%s': %s", plugin.rm.Resource(), err)
+		plugin.cleanup()
+		return err
+	}
+
+	err = plugin.Serve()
 	if err != nil {
 		klog.Infof("Could not start device plugin for '%s': %s", plugin.rm.Resource(), err)
+		plugin.mpsManager.Stop()
 		plugin.cleanup()
 		return err
 	}
@@ -123,13 +225,30 @@ func (plugin *NvidiaDevicePlugin) Start() error {
 		return err
 	}
 	klog.Infof("Registered device plugin for '%s' with Kubelet", plugin.rm.Resource())
-
-	go func() {
-		err := plugin.rm.CheckHealth(plugin.stop, plugin.health)
+	plugin.updateDeviceMetrics()
+	plugin.healthReporter.ReportHealth(plugin.rm.Resource(), plugin.rm.Devices(), nil)
+
+	plugin.updateStatus(func(s *Status) {
+		s.Registered = true
+		s.HealthChecking = true
+	})
+	go func(stop <-chan interface{}) {
+		err := plugin.rm.CheckHealth(stop, plugin.health)
 		if err != nil {
 			klog.Infof("Failed to start health check: %v; continuing with health checks disabled", err)
 		}
-	}()
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		plugin.updateStatus(func(s *Status) {
+			s.HealthChecking = false
+			if err != nil {
+				s.HealthCheckError = err.Error()
+			}
+		})
+	}(plugin.stop)
 
 	return nil
 }
@@ -141,6 +260,11 @@ func (plugin *NvidiaDevicePlugin) Stop() error {
 	}
 	klog.Infof("Stopping to serve '%s' on %s", plugin.rm.Resource(), plugin.socket)
 	plugin.server.Stop()
+	plugin.deleteDeviceMetrics()
+	plugin.healthReporter.RemoveResource(plugin.rm.Resource())
+	if err := plugin.mpsManager.Stop(); err != nil {
+		klog.Warningf("Failed to stop MPS control daemons for '%s': %v", plugin.rm.Resource(), err)
+	}
 	if err := os.Remove(plugin.socket); err != nil && !os.IsNotExist(err) {
 		return err
 	}
@@ -156,14 +280,20 @@ func (plugin *NvidiaDevicePlugin) Serve() error {
 		return err
 	}
 
-	pluginapi.RegisterDevicePluginServer(plugin.server, plugin)
+	plugin.adapter.registerService(plugin.server)
 
 	go func() {
 		lastCrashTime := time.Now()
 		restartCount := 0
 		for {
 			klog.Infof("Starting GRPC server for '%s'", plugin.rm.Resource())
+			plugin.updateStatus(func(s *Status) {
+				s.Serving = true
+			})
 			err := plugin.server.Serve(sock)
+			plugin.updateStatus(func(s *Status) {
+				s.Serving = false
+			})
 			if err == nil {
 				break
 			}
@@ -206,103 +336,114 @@ func (plugin *NvidiaDevicePlugin) Register() error {
 	}
 	defer conn.Close()
 
-	client := pluginapi.NewRegistrationClient(conn)
-	reqt := &pluginapi.RegisterRequest{
-		Version:      pluginapi.Version,
-		Endpoint:     path.Base(plugin.socket),
-		ResourceName: string(plugin.rm.Resource()),
-		Options: &pluginapi.DevicePluginOptions{
-			GetPreferredAllocationAvailable: true,
-		},
-	}
+	return plugin.adapter.registerWithKubelet(conn, path.Base(plugin.socket))
+}
 
-	_, err = client.Register(context.Background(), reqt)
-	if err != nil {
-		return err
-	}
-	return nil
+// resourceName returns the name of the resource served by the plugin.
+func (plugin *NvidiaDevicePlugin) resourceName() spec.ResourceName {
+	return plugin.rm.Resource()
 }
 
-// GetDevicePluginOptions returns the values of the optional settings for this plugin
-func (plugin *NvidiaDevicePlugin) GetDevicePluginOptions(context.Context, *pluginapi.Empty) (*pluginapi.DevicePluginOptions, error) {
-	options := &pluginapi.DevicePluginOptions{
+// devicePluginOptions returns the values of the optional settings for this plugin
+func (plugin *NvidiaDevicePlugin) devicePluginOptions() *pluginapi.DevicePluginOptions {
+	return &pluginapi.DevicePluginOptions{
 		GetPreferredAllocationAvailable: true,
+		PreStartRequired:                plugin.preStartChecksEnabled(),
 	}
-	return options, nil
 }
 
-// ListAndWatch lists devices and update that list according to the health status
-func (plugin *NvidiaDevicePlugin) ListAndWatch(e *pluginapi.Empty, s pluginapi.DevicePlugin_ListAndWatchServer) error {
-	s.Send(&pluginapi.ListAndWatchResponse{Devices: plugin.apiDevices()})
+// listAndWatch sends the list of devices and sends it again whenever the health of a device changes.
+func (plugin *NvidiaDevicePlugin) listAndWatch(send func([]*pluginapi.Device) error) error {
+	send(plugin.apiDevices())
 
 	for {
 		select {
 		case <-plugin.stop:
 			return nil
-		case d := <-plugin.health:
-			// FIXME: there is no way to recover from the Unhealthy state.
-			d.Health = pluginapi.Unhealthy
-			klog.Infof("'%s' device marked unhealthy: %s", plugin.rm.Resource(), d.ID)
-			s.Send(&pluginapi.ListAndWatchResponse{Devices: plugin.apiDevices()})
+		case e := <-plugin.health:
+			d := e.Device
+			if d.Health == e.Health {
+				continue
+			}
+			d.Health = e.Health
+			if d.Health == pluginapi.Healthy {
+				klog.Infof("'%s' device marked healthy: %s", plugin.rm.Resource(), d.ID)
+			} else {
+				klog.Infof("'%s' device marked unhealthy: %s", plugin.rm.Resource(), d.ID)
+			}
+			plugin.updateDeviceMetrics()
+			plugin.healthReporter.ReportHealth(plugin.rm.Resource(), plugin.rm.Devices(), e)
+			send(plugin.apiDevices())
 		}
 	}
 }
 
-// GetPreferredAllocation returns the preferred allocation from the set of devices specified in the request
-func (plugin *NvidiaDevicePlugin) GetPreferredAllocation(ctx context.Context, r *pluginapi.PreferredAllocationRequest) (*pluginapi.PreferredAllocationResponse, error) {
-	response := &pluginapi.PreferredAllocationResponse{}
-	for _, req := range r.ContainerRequests {
-		devices, err := plugin.rm.GetPreferredAllocation(req.AvailableDeviceIDs, req.MustIncludeDeviceIDs, int(req.AllocationSize))
+// getPreferredAllocation returns the preferred allocation from the set of devices specified in each container request
+func (plugin *NvidiaDevicePlugin) getPreferredAllocation(requests []preferredAllocationRequest) ([][]string, error) {
+	resource := string(plugin.rm.Resource())
+	metrics.PreferredAllocationRequests.WithLabelValues(resource).Inc()
+	defer prometheus.NewTimer(metrics.PreferredAllocationDuration.WithLabelValues(resource)).ObserveDuration()
+
+	var allocations [][]string
+	for _, req := range requests {
+		devices, err := plugin.rm.GetPreferredAllocation(req.available, req.mustInclude, req.size)
 		if err != nil {
 			return nil, fmt.Errorf("error getting list of preferred allocation devices: %v", err)
 		}
-
-		resp := &pluginapi.ContainerPreferredAllocationResponse{
-			DeviceIDs: devices,
-		}
-
-		response.ContainerResponses = append(response.ContainerResponses, resp)
+		allocations = append(allocations, devices)
 	}
-	return response, nil
+	return allocations, nil
 }
 
-// Allocate which return list of devices.
-func (plugin *NvidiaDevicePlugin) Allocate(ctx context.Context, reqs *pluginapi.AllocateRequest) (*pluginapi.AllocateResponse, error) {
-	responses := pluginapi.AllocateResponse{}
-	for _, req := range reqs.ContainerRequests {
+// allocate returns the allocation of the devices specified in each container request.
+func (plugin *NvidiaDevicePlugin) allocate(requests [][]string) ([]*containerAllocation, error) {
+	resource := string(plugin.rm.Resource())
+	metrics.AllocateRequests.WithLabelValues(resource).Inc()
+	defer prometheus.NewTimer(metrics.AllocateDuration.WithLabelValues(resource)).ObserveDuration()
+
+	var allocations []*containerAllocation
+	for _, ids := range requests {
 		// If the devices being allocated are replicas, then (conditionally)
 		// error out if more than one resource is being allocated.
-		if plugin.config.Sharing.TimeSlicing.FailRequestsGreaterThanOne && rm.AnnotatedIDs(req.DevicesIDs).AnyHasAnnotations() {
-			if len(req.DevicesIDs) > 1 {
-				return nil, fmt.Errorf("request for '%v: %v' too large: maximum request size for shared resources is 1", plugin.rm.Resource(), len(req.DevicesIDs))
+		if plugin.config.Sharing.FailRequestsGreaterThanOne() && rm.AnnotatedIDs(ids).AnyHasAnnotations() {
+			if len(ids) > 1 {
+				metrics.AllocationFailures.WithLabelValues(resource, metrics.AllocationFailureRequestTooLarge).Inc()
+				return nil, fmt.Errorf("request for '%v: %v' too large: maximum request size for shared resources is 1", plugin.rm.Resource(), len(ids))
 			}
 		}
 
-		for _, id := range req.DevicesIDs {
+		// Memory units can only be allocated from a single device, since the memory
+		// limit of the container applies to a single device.
+		if plugin.config.Sharing.Memory != nil && rm.MemoryUnitIDs(ids).AnyIsMemoryUnit() {
+			if count := len(rm.MemoryUnitIDs(ids).CountByID()); count > 1 {
+				metrics.AllocationFailures.WithLabelValues(resource, metrics.AllocationFailureRequestTooLarge).Inc()
+				return nil, fmt.Errorf("request for '%v: %v' spans %d devices: memory units must be allocated from a single device", plugin.rm.Resource(), len(ids), count)
+			}
+		}
+
+		for _, id := range ids {
 			if !plugin.rm.Devices().Contains(id) {
+				metrics.AllocationFailures.WithLabelValues(resource, metrics.AllocationFailureUnknownDevice).Inc()
 				return nil, fmt.Errorf("invalid allocation request for '%s': unknown device: %s", plugin.rm.Resource(), id)
 			}
 		}
 
-		response, err := plugin.getAllocateResponse(req.DevicesIDs)
+		allocation, err := plugin.getContainerAllocation(ids)
 		if err != nil {
+			metrics.AllocationFailures.WithLabelValues(resource, metrics.AllocationFailureResponseError).Inc()
 			return nil, fmt.Errorf("failed to get allocate response: %v", err)
 		}
-		responses.ContainerResponses = append(responses.ContainerResponses, response)
+		allocations = append(allocations, allocation)
 	}
 
-	return &responses, nil
+	return allocations, nil
 }
 
-func (plugin *NvidiaDevicePlugin) getAllocateResponse(requestIds []string) (*pluginapi.ContainerAllocateResponse, error) {
+// getContainerAllocation returns the allocation of the specified devices to a container.
+func (plugin *NvidiaDevicePlugin) getContainerAllocation(requestIds []string) (*containerAllocation, error) {
 	deviceIDs := plugin.deviceIDsFromAnnotatedDeviceIDs(requestIds)
 
-	responseID := uuid.New().String()
-	response, err := plugin.getAllocateResponseForCDI(responseID, deviceIDs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get allocate response for CDI: %v", err)
-	}
-
+	response := pluginapi.ContainerAllocateResponse{}
 	if plugin.deviceListStrategies.Includes(spec.DeviceListStrategyEnvvar) {
 		response.Envs = plugin.apiEnvs(plugin.deviceListEnvvar, deviceIDs)
 	}
@@ -318,20 +459,63 @@ func (plugin *NvidiaDevicePlugin) getAllocateResponse(requestIds []string) (*plu
 	}
 	if *plugin.config.Flags.MOFEDEnabled {
 		response.Envs["NVIDIA_MOFED"] = "enabled"
+		// Restrict NCCL to the RDMA devices that share a PCIe switch with the allocated
+		// devices. The '=' prefix ensures that the names are matched exactly.
+		if names := plugin.rm.Devices().Subset(requestIds).GetRDMADevices(); len(names) > 0 {
+			response.Envs[ncclIBHCAEnvvar] = "=" + strings.Join(names, ",")
+		}
+	}
+	if plugin.config.Flags.Plugin.AffinityEnvvars != nil && *plugin.config.Flags.Plugin.AffinityEnvvars {
+		envs, err := getAffinityEnvs(sysfsRoot, plugin.rm.Devices().Subset(requestIds))
+		if err != nil {
+			klog.Warningf("Failed to get the affinity of devices %v: %v", requestIds, err)
+		}
+		if response.Envs == nil && len(envs) > 0 {
+			response.Envs = make(map[string]string)
+		}
+		for k, v := range envs {
+			// Envvars that are already set, such as the RDMA devices paired with the devices
+			// through a PCIe switch, take precedence.
+			if _, exists := response.Envs[k]; exists {
+				continue
+			}
+			response.Envs[k] = v
+		}
+	}
+	if err := plugin.mpsManager.UpdateAllocateResponse(&response, requestIds); err != nil {
+		return nil, fmt.Errorf("failed to add MPS settings: %v", err)
+	}
+	if memory := plugin.config.Sharing.Memory; memory != nil && !memory.UsesMPS() && rm.MemoryUnitIDs(requestIds).AnyIsMemoryUnit() {
+		if response.Envs == nil {
+			response.Envs = make(map[string]string)
+		}
+		response.Envs[memory.Envvar] = fmt.Sprintf("%d", len(requestIds)*rm.MemoryUnitSize/(1<<20))
 	}
 
-	return &response, nil
+	allocation := &containerAllocation{
+		response:            &response,
+		annotatedCDIDevices: plugin.getCDIDevicesForAllocation(spec.DeviceListStrategyCDIAnnotations, deviceIDs),
+		criCDIDevices:       plugin.getCDIDevicesForAllocation(spec.DeviceListStrategyCDICRI, deviceIDs),
+	}
+	return allocation, nil
 }
 
-// getAllocateResponseForCDI returns the allocate response for the specified device IDs.
-// This response contains the annotations required to trigger CDI injection in the container engine or nvidia-container-runtime.
-func (plugin *NvidiaDevicePlugin) getAllocateResponseForCDI(responseID string, deviceIDs []string) (pluginapi.ContainerAllocateResponse, error) {
-	response := pluginapi.ContainerAllocateResponse{}
-
+// getCDIDevicesForAllocation returns the qualified names of the CDI devices to
+// inject into a container for the specified device IDs. These are only returned
+// if CDI is enabled and the specified CDI device list strategy is selected.
+func (plugin *NvidiaDevicePlugin) getCDIDevicesForAllocation(strategy string, deviceIDs []string) []string {
 	if !plugin.cdiEnabled {
-		return response, nil
+		return nil
 	}
+	if !plugin.deviceListStrategies.Includes(strategy) {
+		return nil
+	}
+	return plugin.cdiDevices(deviceIDs)
+}
 
+// cdiDevices returns the qualified names of the CDI devices for the specified device IDs,
+// including the GDS and MOFED devices if these are enabled.
+func (plugin *NvidiaDevicePlugin) cdiDevices(deviceIDs []string) []string {
 	var devices []string
 	for _, id := range deviceIDs {
 		devices = append(devices, plugin.cdiHandler.QualifiedName("gpu", id))
@@ -343,20 +527,7 @@ func (plugin *NvidiaDevicePlugin) getAllocateResponseForCDI(responseID string, d
 	if *plugin.config.Flags.MOFEDEnabled {
 		devices = append(devices, plugin.cdiHandler.QualifiedName("mofed", "all"))
 	}
-
-	if len(devices) == 0 {
-		return response, nil
-	}
-
-	if plugin.deviceListStrategies.Includes(spec.DeviceListStrategyCDIAnnotations) {
-		annotations, err := plugin.getCDIDeviceAnnotations(responseID, devices)
-		if err != nil {
-			return response, err
-		}
-		response.Annotations = annotations
-	}
-
-	return response, nil
+	return devices
 }
 
 func (plugin *NvidiaDevicePlugin) getCDIDeviceAnnotations(id string, devices []string) (map[string]string, error) {
@@ -379,11 +550,6 @@ func (plugin *NvidiaDevicePlugin) getCDIDeviceAnnotations(id string, devices []s
 	return updatedAnnotations, nil
 }
 
-// PreStartContainer is unimplemented for this plugin
-func (plugin *NvidiaDevicePlugin) PreStartContainer(context.Context, *pluginapi.PreStartContainerRequest) (*pluginapi.PreStartContainerResponse, error) {
-	return &pluginapi.PreStartContainerResponse{}, nil
-}
-
 // dial establishes the gRPC communication with the registered device plugin.
 func (plugin *NvidiaDevicePlugin) dial(unixSocketPath string, timeout time.Duration) (*grpc.ClientConn, error) {
 	c, err := grpc.Dial(unixSocketPath, grpc.WithInsecure(), grpc.WithBlock(),
@@ -400,6 +566,8 @@ func (plugin *NvidiaDevicePlugin) dial(unixSocketPath string, timeout time.Durat
 	return c, nil
 }
 
+// deviceIDsFromAnnotatedDeviceIDs returns the (unique) IDs of the devices that the annotated
+// IDs (e.g. replicas or memory units) belong to according to the device ID strategy.
 func (plugin *NvidiaDevicePlugin) deviceIDsFromAnnotatedDeviceIDs(ids []string) []string {
 	var deviceIDs []string
 	if *plugin.config.Flags.Plugin.DeviceIDStrategy == spec.DeviceIDStrategyUUID {
@@ -408,7 +576,42 @@ func (plugin *NvidiaDevicePlugin) deviceIDsFromAnnotatedDeviceIDs(ids []string)
 	if *plugin.config.Flags.Plugin.DeviceIDStrategy == spec.DeviceIDStrategyIndex {
 		deviceIDs = plugin.rm.Devices().Subset(ids).GetIndices()
 	}
-	return deviceIDs
+
+	var unique []string
+	seen := make(map[string]bool)
+	for _, id := range deviceIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+	return unique
+}
+
+// updateDeviceMetrics updates the device counts exported for the resource of the plugin.
+func (plugin *NvidiaDevicePlugin) updateDeviceMetrics() {
+	resource := string(plugin.rm.Resource())
+	devices := plugin.rm.Devices()
+
+	healthy := 0
+	for _, d := range devices {
+		if d.Health == pluginapi.Healthy {
+			healthy++
+		}
+	}
+
+	metrics.DevicesAdvertised.WithLabelValues(resource).Set(float64(len(devices)))
+	metrics.DevicesHealthy.WithLabelValues(resource).Set(float64(healthy))
+	metrics.DevicesUnhealthy.WithLabelValues(resource).Set(float64(len(devices) - healthy))
+}
+
+// deleteDeviceMetrics removes the device counts exported for the resource of the plugin.
+func (plugin *NvidiaDevicePlugin) deleteDeviceMetrics() {
+	resource := string(plugin.rm.Resource())
+	metrics.DevicesAdvertised.DeleteLabelValues(resource)
+	metrics.DevicesHealthy.DeleteLabelValues(resource)
+	metrics.DevicesUnhealthy.DeleteLabelValues(resource)
 }
 
 func (plugin *NvidiaDevicePlugin) apiDevices() []*pluginapi.Device {
@@ -436,18 +639,11 @@ func (plugin *NvidiaDevicePlugin) apiMounts(deviceIDs []string) []*pluginapi.Mou
 }
 
 func (plugin *NvidiaDevicePlugin) apiDeviceSpecs(driverRoot string, ids []string) []*pluginapi.DeviceSpec {
-	optional := map[string]bool{
-		"/dev/nvidiactl":        true,
-		"/dev/nvidia-uvm":       true,
-		"/dev/nvidia-uvm-tools": true,
-		"/dev/nvidia-modeset":   true,
-	}
-
 	paths := plugin.rm.GetDevicePaths(ids)
 
 	var specs []*pluginapi.DeviceSpec
 	for _, p := range paths {
-		if optional[p] {
+		if optionalDeviceNodes[p] {
 			if _, err := os.Stat(p); err != nil {
 				continue
 			}
@@ -135,6 +135,57 @@ func TestCDIAllocateResponse(t *testing.T) {
 				},
 			},
 		},
+		{
+			description:          "cdi-cri with CDI disabled has empty response",
+			deviceIds:            []string{"gpu0"},
+			deviceListStrategies: []string{"cdi-cri"},
+			CDIPrefix:            "cdi.k8s.io/",
+			CDIEnabled:           false,
+		},
+		{
+			description:          "cdi-cri devices are passed as CDI devices",
+			deviceIds:            []string{"gpu0", "gpu1"},
+			deviceListStrategies: []string{"cdi-cri"},
+			CDIPrefix:            "cdi.k8s.io/",
+			CDIEnabled:           true,
+			expectedResponse: pluginapi.ContainerAllocateResponse{
+				CDIDevices: []*pluginapi.CDIDevice{
+					{Name: "nvidia.com/gpu=gpu0"},
+					{Name: "nvidia.com/gpu=gpu1"},
+				},
+			},
+		},
+		{
+			description:          "cdi-cri includes gds and mofed devices",
+			deviceIds:            []string{"gpu0"},
+			deviceListStrategies: []string{"envvar", "cdi-cri"},
+			CDIPrefix:            "cdi.k8s.io/",
+			CDIEnabled:           true,
+			GDSEnabled:           true,
+			MOFEDEnabled:         true,
+			expectedResponse: pluginapi.ContainerAllocateResponse{
+				CDIDevices: []*pluginapi.CDIDevice{
+					{Name: "nvidia.com/gpu=gpu0"},
+					{Name: "nvidia.com/gds=all"},
+					{Name: "nvidia.com/mofed=all"},
+				},
+			},
+		},
+		{
+			description:          "cdi-annotations and cdi-cri can be combined",
+			deviceIds:            []string{"gpu0"},
+			deviceListStrategies: []string{"cdi-annotations", "cdi-cri"},
+			CDIPrefix:            "cdi.k8s.io/",
+			CDIEnabled:           true,
+			expectedResponse: pluginapi.ContainerAllocateResponse{
+				Annotations: map[string]string{
+					"cdi.k8s.io/nvidia-device-plugin_uuid": "nvidia.com/gpu=gpu0",
+				},
+				CDIDevices: []*pluginapi.CDIDevice{
+					{Name: "nvidia.com/gpu=gpu0"},
+				},
+			},
+		},
 	}
 
 	for _, tc := range testCases {
@@ -159,10 +210,16 @@ func TestCDIAllocateResponse(t *testing.T) {
 				cdiAnnotationPrefix:  tc.CDIPrefix,
 			}
 
-			response, err := plugin.getAllocateResponseForCDI("uuid", tc.deviceIds)
+			allocation := &containerAllocation{
+				response:            &pluginapi.ContainerAllocateResponse{},
+				annotatedCDIDevices: plugin.getCDIDevicesForAllocation(v1.DeviceListStrategyCDIAnnotations, tc.deviceIds),
+				criCDIDevices:       plugin.getCDIDevicesForAllocation(v1.DeviceListStrategyCDICRI, tc.deviceIds),
+			}
+
+			response, err := newCDIDevicesAdapter(&plugin, "v1.29.0").containerAllocateResponse("uuid", allocation)
 
 			require.Nil(t, err)
-			require.EqualValues(t, &tc.expectedResponse, &response)
+			require.EqualValues(t, &tc.expectedResponse, response)
 		})
 	}
 }
@@ -0,0 +1,58 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package podresources
+
+import (
+	"sort"
+	"strings"
+)
+
+// Interface provides the devices allocated to the containers on the node.
+type Interface interface {
+	GetAllocations() (Allocations, error)
+}
+
+// Allocation records the devices of a resource allocated to a container.
+type Allocation struct {
+	Namespace string   `json:"namespace"`
+	Pod       string   `json:"pod"`
+	Container string   `json:"container"`
+	Resource  string   `json:"resource"`
+	DeviceIDs []string `json:"deviceIDs"`
+}
+
+// Allocations is a list of Allocation.
+type Allocations []Allocation
+
+// GetDeviceIDs returns the IDs of all allocated devices.
+func (as Allocations) GetDeviceIDs() []string {
+	var ids []string
+	for _, a := range as {
+		ids = append(ids, a.DeviceIDs...)
+	}
+	return ids
+}
+
+// sort orders the allocations by namespace, pod, container, and resource.
+func (as Allocations) sort() {
+	key := func(a Allocation) string {
+		return strings.Join([]string{a.Namespace, a.Pod, a.Container, a.Resource}, "/")
+	}
+	sort.Slice(as, func(i, j int) bool {
+		return key(as[i]) < key(as[j])
+	})
+}
@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package podresources
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+const (
+	// DefaultSocket is the path of the PodResources socket of the kubelet.
+	DefaultSocket = "/var/lib/kubelet/pod-resources/kubelet.sock"
+
+	defaultTimeout = 10 * time.Second
+	maxMessageSize = 16 * 1024 * 1024
+)
+
+// kubeletClient queries the kubelet PodResources API for the devices allocated to containers.
+// Since the kubelet checkpoints its allocations, these survive restarts of the plugin.
+type kubeletClient struct {
+	sync.Mutex
+	socket         string
+	resourcePrefix string
+	timeout        time.Duration
+
+	client podresourcesapi.PodResourcesListerClient
+}
+
+var _ Interface = &kubeletClient{}
+
+// New creates a client for the PodResources API of the kubelet.
+// The connection to the kubelet is established on first use.
+func New(opts ...Option) Interface {
+	c := &kubeletClient{
+		socket:  DefaultSocket,
+		timeout: defaultTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// GetAllocations returns the devices of the matching resources allocated to each container on the node.
+func (c *kubeletClient) GetAllocations() (Allocations, error) {
+	client, err := c.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	response, err := client.List(ctx, &podresourcesapi.ListPodResourcesRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pod resources: %v", err)
+	}
+
+	var allocations Allocations
+	for _, pod := range response.GetPodResources() {
+		for _, container := range pod.GetContainers() {
+			for _, devices := range container.GetDevices() {
+				if !c.matches(devices.GetResourceName()) || len(devices.GetDeviceIds()) == 0 {
+					continue
+				}
+				allocations = append(allocations, Allocation{
+					Namespace: pod.GetNamespace(),
+					Pod:       pod.GetName(),
+					Container: container.GetName(),
+					Resource:  devices.GetResourceName(),
+					DeviceIDs: devices.GetDeviceIds(),
+				})
+			}
+		}
+	}
+	allocations.sort()
+
+	return allocations, nil
+}
+
+func (c *kubeletClient) matches(resource string) bool {
+	return c.resourcePrefix == "" || strings.HasPrefix(resource, c.resourcePrefix+"/")
+}
+
+func (c *kubeletClient) getClient() (podresourcesapi.PodResourcesListerClient, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	conn, err := grpc.Dial(c.socket,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", addr)
+		}),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(maxMessageSize)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %v: %v", c.socket, err)
+	}
+
+	c.client = podresourcesapi.NewPodResourcesListerClient(conn)
+	return c.client, nil
+}
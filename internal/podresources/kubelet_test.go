@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package podresources
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	podresourcesapi "k8s.io/kubelet/pkg/apis/podresources/v1"
+)
+
+// fakeServer is a PodResources server that lists a fixed set of pod resources.
+type fakeServer struct {
+	podresourcesapi.UnimplementedPodResourcesListerServer
+	podResources []*podresourcesapi.PodResources
+}
+
+func (s *fakeServer) List(context.Context, *podresourcesapi.ListPodResourcesRequest) (*podresourcesapi.ListPodResourcesResponse, error) {
+	return &podresourcesapi.ListPodResourcesResponse{PodResources: s.podResources}, nil
+}
+
+// startFakeServer serves the fake server on a socket in a temporary directory and returns the path to the socket.
+func startFakeServer(t *testing.T, s *fakeServer) string {
+	socket := filepath.Join(t.TempDir(), "kubelet.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	podresourcesapi.RegisterPodResourcesListerServer(server, s)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return socket
+}
+
+func TestGetAllocations(t *testing.T) {
+	s := &fakeServer{
+		podResources: []*podresourcesapi.PodResources{
+			{
+				Namespace: "default",
+				Name:      "training",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name: "worker",
+						Devices: []*podresourcesapi.ContainerDevices{
+							{ResourceName: "nvidia.com/gpu", DeviceIds: []string{"GPU-0", "GPU-1"}},
+							{ResourceName: "example.com/nic", DeviceIds: []string{"nic0"}},
+						},
+					},
+					{
+						Name: "sidecar",
+					},
+				},
+			},
+			{
+				Namespace: "default",
+				Name:      "inference",
+				Containers: []*podresourcesapi.ContainerResources{
+					{
+						Name: "server",
+						Devices: []*podresourcesapi.ContainerDevices{
+							{ResourceName: "nvidia.com/gpu.shared", DeviceIds: []string{"GPU-2::0"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	client := New(
+		WithSocket(startFakeServer(t, s)),
+		WithResourcePrefix("nvidia.com"),
+	)
+
+	allocations, err := client.GetAllocations()
+	require.NoError(t, err)
+	require.Equal(t, Allocations{
+		{Namespace: "default", Pod: "inference", Container: "server", Resource: "nvidia.com/gpu.shared", DeviceIDs: []string{"GPU-2::0"}},
+		{Namespace: "default", Pod: "training", Container: "worker", Resource: "nvidia.com/gpu", DeviceIDs: []string{"GPU-0", "GPU-1"}},
+	}, allocations)
+	require.Equal(t, []string{"GPU-2::0", "GPU-0", "GPU-1"}, allocations.GetDeviceIDs())
+
+	// Allocations are updated as pods come and go.
+	s.podResources = s.podResources[1:]
+	allocations, err = client.GetAllocations()
+	require.NoError(t, err)
+	require.Len(t, allocations, 1)
+}
+
+func TestGetAllocationsWithoutKubelet(t *testing.T) {
+	client := New(
+		WithSocket(filepath.Join(t.TempDir(), "kubelet.sock")),
+		WithTimeout(100*time.Millisecond),
+	)
+
+	_, err := client.GetAllocations()
+	require.Error(t, err)
+}
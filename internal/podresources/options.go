@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package podresources
+
+import "time"
+
+// Option defines a function for passing options to the New() call
+type Option func(*kubeletClient)
+
+// WithSocket provides an Option to set the path to the PodResources socket of the kubelet
+func WithSocket(socket string) Option {
+	return func(c *kubeletClient) {
+		c.socket = socket
+	}
+}
+
+// WithResourcePrefix provides an Option to set the prefix of the resources whose allocations are returned
+func WithResourcePrefix(prefix string) Option {
+	return func(c *kubeletClient) {
+		c.resourcePrefix = prefix
+	}
+}
+
+// WithTimeout provides an Option to set the timeout for requests to the kubelet
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *kubeletClient) {
+		c.timeout = timeout
+	}
+}
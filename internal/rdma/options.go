@@ -0,0 +1,27 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rdma
+
+// Option defines a function for passing options to the New() call
+type Option func(*topology)
+
+// WithSysfsRoot provides an Option to set the root of the sysfs filesystem that devices are discovered from
+func WithSysfsRoot(root string) Option {
+	return func(t *topology) {
+		t.sysfs = root
+	}
+}
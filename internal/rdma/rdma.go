@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rdma
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultSysfsRoot = "/sys"
+	mellanoxVendorID = "0x15b3"
+)
+
+// device represents an RDMA device and the PCIe path to it.
+type device struct {
+	name string
+	path []string
+}
+
+// topology holds the RDMA devices discovered on the node.
+type topology struct {
+	sysfs   string
+	devices []device
+}
+
+var _ Interface = &topology{}
+
+// New discovers the Mellanox RDMA devices under /sys/class/infiniband and returns an
+// instance of the 'rdma' interface that pairs them with other PCI devices (e.g. GPUs).
+func New(opts ...Option) (Interface, error) {
+	t := &topology{
+		sysfs: defaultSysfsRoot,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	root := filepath.Join(t.sysfs, "class/infiniband")
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		klog.Infof("No RDMA devices found in %v", root)
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing RDMA devices: %v", err)
+	}
+
+	for _, e := range entries {
+		vendor, err := os.ReadFile(filepath.Join(root, e.Name(), "device/vendor"))
+		if err != nil || strings.TrimSpace(string(vendor)) != mellanoxVendorID {
+			continue
+		}
+		path, err := t.resolvePCIPath(filepath.Join(root, e.Name(), "device"))
+		if err != nil {
+			return nil, fmt.Errorf("error resolving PCIe path of RDMA device %v: %v", e.Name(), err)
+		}
+		klog.Infof("Found RDMA device %v at %v", e.Name(), path[len(path)-1])
+		t.devices = append(t.devices, device{name: e.Name(), path: path})
+	}
+
+	return t, nil
+}
+
+// GetPairedDevices returns the sorted names of the RDMA devices that share a PCIe
+// switch with the PCI device with the specified bus ID.
+func (t *topology) GetPairedDevices(busID string) []string {
+	if busID == "" || len(t.devices) == 0 {
+		return nil
+	}
+
+	path, err := t.resolvePCIPath(filepath.Join(t.sysfs, "bus/pci/devices", busID))
+	if err != nil {
+		klog.Warningf("Failed to resolve PCIe path of device %v: %v", busID, err)
+		return nil
+	}
+
+	var paired []string
+	for _, d := range t.devices {
+		if sharePCIeSwitch(path, d.path) {
+			paired = append(paired, d.name)
+		}
+	}
+	sort.Strings(paired)
+	return paired
+}
+
+// resolvePCIPath resolves the sysfs link of a PCI device and returns the PCI
+// addresses of the bridges along the path to the device, followed by the address
+// of the device itself. The root complex (e.g. pci0000:00) is not included.
+func (t *topology) resolvePCIPath(link string) ([]string, error) {
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return nil, err
+	}
+
+	var path []string
+	for _, c := range strings.Split(resolved, string(filepath.Separator)) {
+		if strings.HasPrefix(c, "pci") {
+			path = nil
+			continue
+		}
+		path = append(path, c)
+	}
+	if len(path) == 0 {
+		return nil, fmt.Errorf("no PCI devices in path %v", resolved)
+	}
+	return path, nil
+}
+
+// sharePCIeSwitch checks whether two PCI devices are connected through a common
+// PCIe switch. This is the case if the bridges above them include at least a
+// common root port and the upstream port of a switch below it.
+func sharePCIeSwitch(a, b []string) bool {
+	a = a[:len(a)-1]
+	b = b[:len(b)-1]
+	common := 0
+	for common < len(a) && common < len(b) && a[common] == b[common] {
+		common++
+	}
+	return common >= 2
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rdma
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSysfs creates a sysfs tree with two PCIe switches below the same root
+// port. GPU 0000:07:00.0 shares the first switch with RDMA devices mlx5_0 and
+// mlx5_1, while GPU 0000:87:00.0 is below the second switch with no RDMA device.
+// An Ethernet controller from another vendor shares the second switch.
+func newTestSysfs(t *testing.T) string {
+	sysfs := t.TempDir()
+
+	pciDevices := []struct {
+		path   string
+		vendor string
+		rdma   string
+	}{
+		{path: "pci0000:00/0000:00:01.0/0000:01:00.0/0000:02:08.0/0000:07:00.0", vendor: "0x10de"},
+		{path: "pci0000:00/0000:00:01.0/0000:01:00.0/0000:02:10.0/0000:0c:00.0", vendor: mellanoxVendorID, rdma: "mlx5_0"},
+		{path: "pci0000:00/0000:00:01.0/0000:01:00.0/0000:02:10.0/0000:0c:00.1", vendor: mellanoxVendorID, rdma: "mlx5_1"},
+		{path: "pci0000:00/0000:00:02.0/0000:81:00.0/0000:82:08.0/0000:87:00.0", vendor: "0x10de"},
+		{path: "pci0000:00/0000:00:02.0/0000:81:00.0/0000:82:10.0/0000:8c:00.0", vendor: "0x8086", rdma: "irdma0"},
+	}
+	for _, d := range pciDevices {
+		dir := filepath.Join(sysfs, "devices", d.path)
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "vendor"), []byte(d.vendor+"\n"), 0644))
+
+		busID := filepath.Base(d.path)
+		require.NoError(t, os.MkdirAll(filepath.Join(sysfs, "bus/pci/devices"), 0755))
+		require.NoError(t, os.Symlink(dir, filepath.Join(sysfs, "bus/pci/devices", busID)))
+
+		if d.rdma != "" {
+			require.NoError(t, os.MkdirAll(filepath.Join(sysfs, "class/infiniband", d.rdma), 0755))
+			require.NoError(t, os.Symlink(dir, filepath.Join(sysfs, "class/infiniband", d.rdma, "device")))
+		}
+	}
+
+	return sysfs
+}
+
+func TestGetPairedDevices(t *testing.T) {
+	r, err := New(WithSysfsRoot(newTestSysfs(t)))
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"mlx5_0", "mlx5_1"}, r.GetPairedDevices("0000:07:00.0"))
+	require.Empty(t, r.GetPairedDevices("0000:87:00.0"))
+	require.Empty(t, r.GetPairedDevices("0000:ff:00.0"))
+	require.Empty(t, r.GetPairedDevices(""))
+}
+
+func TestNewWithoutRDMADevices(t *testing.T) {
+	r, err := New(WithSysfsRoot(t.TempDir()))
+	require.NoError(t, err)
+	require.Empty(t, r.GetPairedDevices("0000:07:00.0"))
+}
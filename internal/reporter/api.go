@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reporter
+
+import (
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+)
+
+// Interface defines the API for reporting the health of devices outside of the plugin.
+type Interface interface {
+	// ReportHealth reports the health transition described by event for a
+	// device of the specified resource. The devices are the full set of
+	// devices of the resource after the transition.
+	ReportHealth(resource spec.ResourceName, devices rm.Devices, event *rm.HealthEvent)
+	// RemoveResource removes the specified resource from the reported health.
+	RemoveResource(resource spec.ResourceName)
+}
@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+const (
+	// ConditionType is the type of the node condition that summarizes the health of the devices on the node.
+	ConditionType corev1.NodeConditionType = "NvidiaGPUHealthy"
+
+	// Reasons used for the events and the node condition.
+	ReasonDeviceUnhealthy     = "NvidiaGPUUnhealthy"
+	ReasonDeviceHealthy       = "NvidiaGPUHealthy"
+	ReasonAllDevicesHealthy   = "AllDevicesHealthy"
+	ReasonUnhealthyDevices    = "UnhealthyDevices"
+	ReasonNoDevicesAdvertised = "NoDevicesAdvertised"
+
+	// Annotations added to the events for consumption by tooling.
+	AnnotationUUID  = "nvidia.com/gpu.uuid"
+	AnnotationIndex = "nvidia.com/gpu.index"
+	AnnotationXid   = "nvidia.com/gpu.xid"
+
+	component      = "nvidia-device-plugin"
+	maxPending     = 100
+	requestTimeout = 10 * time.Second
+)
+
+// resourceHealth holds the number of devices and unhealthy devices for a resource.
+type resourceHealth struct {
+	total     int
+	unhealthy int
+}
+
+// kubernetesReporter reports the health of devices as Kubernetes Events and a node condition.
+type kubernetesReporter struct {
+	sync.Mutex
+	client   kubernetes.Interface
+	nodeName string
+
+	resources    map[spec.ResourceName]resourceHealth
+	deviceHealth map[string]string
+	condition    *corev1.NodeCondition
+
+	pending chan func()
+	now     func() time.Time
+}
+
+var _ Interface = &kubernetesReporter{}
+
+// New creates a reporter that posts Kubernetes Events on the node when devices change health and
+// maintains a node condition summarizing the health of the devices of each resource.
+// Requests to the API server are made in the background so as not to block the caller.
+func New(opts ...Option) (Interface, error) {
+	r := &kubernetesReporter{
+		resources:    make(map[spec.ResourceName]resourceHealth),
+		deviceHealth: make(map[string]string),
+		pending:      make(chan func(), maxPending),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.client == nil {
+		return nil, fmt.Errorf("no Kubernetes client specified")
+	}
+	if r.nodeName == "" {
+		return nil, fmt.Errorf("no node name specified")
+	}
+
+	go func() {
+		for request := range r.pending {
+			request()
+		}
+	}()
+
+	return r, nil
+}
+
+// ReportHealth posts an Event for the device in the specified HealthEvent and updates the node condition.
+// If event is nil, only the node condition is updated.
+func (r *kubernetesReporter) ReportHealth(resource spec.ResourceName, devices rm.Devices, event *rm.HealthEvent) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.resources[resource] = newResourceHealth(devices)
+
+	if event != nil {
+		// Shared devices are reported once per replica, so we only post an
+		// event if the health of the underlying device has changed.
+		key := fmt.Sprintf("%s/%s", resource, event.Device.GetUUID())
+		if r.deviceHealth[key] != event.Health {
+			r.deviceHealth[key] = event.Health
+			e := newDeviceEvent(r.nodeName, resource, event, r.now())
+			r.enqueue(func() { r.postEvent(e) })
+		}
+	}
+
+	r.updateCondition()
+}
+
+// RemoveResource removes the resource from the node condition.
+func (r *kubernetesReporter) RemoveResource(resource spec.ResourceName) {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.resources, resource)
+	for key := range r.deviceHealth {
+		if strings.HasPrefix(key, string(resource)+"/") {
+			delete(r.deviceHealth, key)
+		}
+	}
+
+	r.updateCondition()
+}
+
+// updateCondition patches the node condition if its status, reason, or message has changed.
+func (r *kubernetesReporter) updateCondition() {
+	condition := newCondition(r.resources, r.now())
+	if r.condition != nil {
+		if r.condition.Status == condition.Status && r.condition.Reason == condition.Reason && r.condition.Message == condition.Message {
+			return
+		}
+		if r.condition.Status == condition.Status {
+			condition.LastTransitionTime = r.condition.LastTransitionTime
+		}
+	}
+	r.condition = condition
+
+	c := *condition
+	r.enqueue(func() { r.patchCondition(&c) })
+}
+
+func (r *kubernetesReporter) enqueue(request func()) {
+	select {
+	case r.pending <- request:
+	default:
+		klog.Warningf("Too many pending requests to the API server; dropping health report for node %s", r.nodeName)
+	}
+}
+
+func (r *kubernetesReporter) postEvent(event *corev1.Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	_, err := r.client.CoreV1().Events(event.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	if err != nil {
+		klog.Warningf("Failed to post event for node %s: %v", r.nodeName, err)
+	}
+}
+
+func (r *kubernetesReporter) patchCondition(condition *corev1.NodeCondition) {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"conditions": []corev1.NodeCondition{*condition},
+		},
+	})
+	if err != nil {
+		klog.Warningf("Failed to construct patch for %s condition: %v", ConditionType, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	_, err = r.client.CoreV1().Nodes().PatchStatus(ctx, r.nodeName, patch)
+	if err != nil {
+		klog.Warningf("Failed to update %s condition for node %s: %v", ConditionType, r.nodeName, err)
+	}
+}
+
+func newResourceHealth(devices rm.Devices) resourceHealth {
+	h := resourceHealth{total: len(devices)}
+	for _, d := range devices {
+		if d.Health != pluginapi.Healthy {
+			h.unhealthy++
+		}
+	}
+	return h
+}
+
+// newDeviceEvent constructs an Event on the specified node for the device in the HealthEvent.
+func newDeviceEvent(nodeName string, resource spec.ResourceName, e *rm.HealthEvent, now time.Time) *corev1.Event {
+	eventType := corev1.EventTypeWarning
+	reason := ReasonDeviceUnhealthy
+	if e.Health == pluginapi.Healthy {
+		eventType = corev1.EventTypeNormal
+		reason = ReasonDeviceHealthy
+	}
+
+	uuid := e.Device.GetUUID()
+	annotations := map[string]string{
+		AnnotationUUID:  uuid,
+		AnnotationIndex: e.Device.Index,
+	}
+	if e.Xid != nil {
+		annotations[AnnotationXid] = strconv.FormatUint(*e.Xid, 10)
+	}
+
+	message := fmt.Sprintf("'%s' device %s (index %s) marked %s", resource, uuid, e.Device.Index, strings.ToLower(e.Health))
+	if e.Reason != "" {
+		message = fmt.Sprintf("%s: %s", message, e.Reason)
+	}
+
+	ref := nodeReference(nodeName)
+	timestamp := metav1.NewTime(now)
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: nodeName + ".",
+			Namespace:    eventNamespace(ref),
+			Annotations:  annotations,
+		},
+		InvolvedObject: *ref,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: component, Host: nodeName},
+		FirstTimestamp: timestamp,
+		LastTimestamp:  timestamp,
+		Count:          1,
+	}
+}
+
+// nodeReference returns the reference to the specified node that events are recorded against.
+// As is done by the kubelet, the node name is used as the UID and the namespace is left empty
+// since nodes are cluster-scoped. This is what 'kubectl describe node' searches for.
+func nodeReference(nodeName string) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind:      "Node",
+		Name:      nodeName,
+		UID:       types.UID(nodeName),
+		Namespace: "",
+	}
+}
+
+// eventNamespace returns the namespace in which an event for the referenced object is created.
+// Events for cluster-scoped objects are created in the default namespace, as is done by the
+// client-go event recorder.
+func eventNamespace(ref *corev1.ObjectReference) string {
+	if ref.Namespace == "" {
+		return metav1.NamespaceDefault
+	}
+	return ref.Namespace
+}
+
+// newCondition constructs the node condition summarizing the health of the specified resources.
+func newCondition(resources map[spec.ResourceName]resourceHealth, now time.Time) *corev1.NodeCondition {
+	var names []string
+	for name := range resources {
+		names = append(names, string(name))
+	}
+	sort.Strings(names)
+
+	status := corev1.ConditionTrue
+	reason := ReasonAllDevicesHealthy
+	var messages []string
+	for _, name := range names {
+		h := resources[spec.ResourceName(name)]
+		if h.unhealthy > 0 {
+			status = corev1.ConditionFalse
+			reason = ReasonUnhealthyDevices
+		}
+		messages = append(messages, fmt.Sprintf("%s: %d/%d healthy", name, h.total-h.unhealthy, h.total))
+	}
+	if len(messages) == 0 {
+		reason = ReasonNoDevicesAdvertised
+		messages = append(messages, "no devices are advertised")
+	}
+
+	timestamp := metav1.NewTime(now)
+	return &corev1.NodeCondition{
+		Type:               ConditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            strings.Join(messages, "; "),
+		LastHeartbeatTime:  timestamp,
+		LastTransitionTime: timestamp,
+	}
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reporter
+
+import (
+	"testing"
+	"time"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+func newTestDevice(id string, index string, health string) *rm.Device {
+	d := &rm.Device{Index: index}
+	d.ID = id
+	d.Health = health
+	return d
+}
+
+func TestNewCondition(t *testing.T) {
+	testCases := []struct {
+		description     string
+		resources       map[spec.ResourceName]resourceHealth
+		expectedStatus  corev1.ConditionStatus
+		expectedReason  string
+		expectedMessage string
+	}{
+		{
+			description:     "no resources",
+			resources:       map[spec.ResourceName]resourceHealth{},
+			expectedStatus:  corev1.ConditionTrue,
+			expectedReason:  ReasonNoDevicesAdvertised,
+			expectedMessage: "no devices are advertised",
+		},
+		{
+			description: "all devices healthy",
+			resources: map[spec.ResourceName]resourceHealth{
+				"nvidia.com/gpu": {total: 8},
+			},
+			expectedStatus:  corev1.ConditionTrue,
+			expectedReason:  ReasonAllDevicesHealthy,
+			expectedMessage: "nvidia.com/gpu: 8/8 healthy",
+		},
+		{
+			description: "one resource with unhealthy devices",
+			resources: map[spec.ResourceName]resourceHealth{
+				"nvidia.com/mig-1g.5gb": {total: 7},
+				"nvidia.com/gpu":        {total: 4, unhealthy: 1},
+			},
+			expectedStatus:  corev1.ConditionFalse,
+			expectedReason:  ReasonUnhealthyDevices,
+			expectedMessage: "nvidia.com/gpu: 3/4 healthy; nvidia.com/mig-1g.5gb: 7/7 healthy",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			c := newCondition(tc.resources, time.Now())
+			require.Equal(t, ConditionType, c.Type)
+			require.Equal(t, tc.expectedStatus, c.Status)
+			require.Equal(t, tc.expectedReason, c.Reason)
+			require.Equal(t, tc.expectedMessage, c.Message)
+		})
+	}
+}
+
+func TestNewDeviceEvent(t *testing.T) {
+	xid := uint64(79)
+	d := newTestDevice("GPU-0::1", "0", pluginapi.Unhealthy)
+
+	e := newDeviceEvent("node-a", "nvidia.com/gpu", &rm.HealthEvent{Device: d, Health: pluginapi.Unhealthy, Reason: "Xid 79", Xid: &xid}, time.Now())
+	require.Equal(t, corev1.EventTypeWarning, e.Type)
+	require.Equal(t, ReasonDeviceUnhealthy, e.Reason)
+	require.Equal(t, "'nvidia.com/gpu' device GPU-0 (index 0) marked unhealthy: Xid 79", e.Message)
+	require.Equal(t, "Node", e.InvolvedObject.Kind)
+	require.Equal(t, "node-a", e.InvolvedObject.Name)
+	require.Equal(t, map[string]string{AnnotationUUID: "GPU-0", AnnotationIndex: "0", AnnotationXid: "79"}, e.Annotations)
+
+	e = newDeviceEvent("node-a", "nvidia.com/gpu", &rm.HealthEvent{Device: d, Health: pluginapi.Healthy}, time.Now())
+	require.Equal(t, corev1.EventTypeNormal, e.Type)
+	require.Equal(t, ReasonDeviceHealthy, e.Reason)
+	require.Equal(t, "'nvidia.com/gpu' device GPU-0 (index 0) marked healthy", e.Message)
+	require.NotContains(t, e.Annotations, AnnotationXid)
+}
+
+// describeNodeEvents returns the events that 'kubectl describe node' shows for the specified node.
+// It searches all namespaces for events whose involved object matches the node reference used by
+// the kubelet.
+func describeNodeEvents(events []*corev1.Event, nodeName string) []*corev1.Event {
+	selector := fields.Set{
+		"involvedObject.kind":      "Node",
+		"involvedObject.name":      nodeName,
+		"involvedObject.namespace": "",
+		"involvedObject.uid":       nodeName,
+	}.AsSelector()
+
+	var matched []*corev1.Event
+	for _, e := range events {
+		attrs := fields.Set{
+			"involvedObject.kind":      e.InvolvedObject.Kind,
+			"involvedObject.name":      e.InvolvedObject.Name,
+			"involvedObject.namespace": e.InvolvedObject.Namespace,
+			"involvedObject.uid":       string(e.InvolvedObject.UID),
+		}
+		if selector.Matches(attrs) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+func TestDeviceEventDescribedOnNode(t *testing.T) {
+	d := newTestDevice("GPU-0", "0", pluginapi.Unhealthy)
+	health := &rm.HealthEvent{Device: d, Health: pluginapi.Unhealthy}
+
+	events := []*corev1.Event{
+		newDeviceEvent("node-a", "nvidia.com/gpu", health, time.Now()),
+		newDeviceEvent("node-b", "nvidia.com/gpu", health, time.Now()),
+	}
+
+	described := describeNodeEvents(events, "node-a")
+	require.Len(t, described, 1)
+	require.Equal(t, "node-a", described[0].Source.Host)
+
+	// Nodes are cluster-scoped, so the involved object has no namespace and the
+	// API server only accepts the event in the default namespace.
+	require.Empty(t, described[0].InvolvedObject.Namespace)
+	require.Equal(t, metav1.NamespaceDefault, described[0].Namespace)
+}
+
+func TestReportHealth(t *testing.T) {
+	r := &kubernetesReporter{
+		nodeName:     "node-a",
+		resources:    make(map[spec.ResourceName]resourceHealth),
+		deviceHealth: make(map[string]string),
+		pending:      make(chan func(), maxPending),
+		now:          time.Now,
+	}
+
+	replica0 := newTestDevice("GPU-0::0", "0", pluginapi.Healthy)
+	replica1 := newTestDevice("GPU-0::1", "0", pluginapi.Healthy)
+	devices := rm.Devices{replica0.ID: replica0, replica1.ID: replica1}
+
+	// Registering the resource only updates the condition.
+	r.ReportHealth("nvidia.com/gpu", devices, nil)
+	require.Len(t, r.pending, 1)
+	require.Equal(t, corev1.ConditionTrue, r.condition.Status)
+
+	// Reporting the same state again does not update the condition.
+	r.ReportHealth("nvidia.com/gpu", devices, nil)
+	require.Len(t, r.pending, 1)
+
+	// The first replica posts an event and updates the condition.
+	replica0.Health = pluginapi.Unhealthy
+	r.ReportHealth("nvidia.com/gpu", devices, &rm.HealthEvent{Device: replica0, Health: pluginapi.Unhealthy})
+	require.Len(t, r.pending, 3)
+	require.Equal(t, corev1.ConditionFalse, r.condition.Status)
+
+	// The second replica of the same device only updates the condition message.
+	replica1.Health = pluginapi.Unhealthy
+	r.ReportHealth("nvidia.com/gpu", devices, &rm.HealthEvent{Device: replica1, Health: pluginapi.Unhealthy})
+	require.Len(t, r.pending, 4)
+	require.Equal(t, "nvidia.com/gpu: 0/2 healthy", r.condition.Message)
+
+	// Removing the resource resets the condition.
+	r.RemoveResource("nvidia.com/gpu")
+	require.Len(t, r.pending, 5)
+	require.Equal(t, corev1.ConditionTrue, r.condition.Status)
+	require.Empty(t, r.deviceHealth)
+}
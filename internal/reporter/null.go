@@ -0,0 +1,37 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reporter
+
+import (
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rm"
+)
+
+type null struct{}
+
+var _ Interface = &null{}
+
+// NewNullReporter returns an instance of a reporter that does nothing.
+func NewNullReporter() Interface {
+	return &null{}
+}
+
+// ReportHealth is a no-op for the null reporter
+func (n *null) ReportHealth(spec.ResourceName, rm.Devices, *rm.HealthEvent) {}
+
+// RemoveResource is a no-op for the null reporter
+func (n *null) RemoveResource(spec.ResourceName) {}
@@ -19,26 +19,219 @@ package rm
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/NVIDIA/go-gpuallocator/gpuallocator"
-)
 
-var alignedAllocationPolicy = gpuallocator.NewBestEffortPolicy()
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"k8s.io/klog/v2"
+)
 
 // getPreferredAllocation runs an allocation algorithm over the inputs.
-// The algorithm chosen is based both on the incoming set of available devices and various config settings.
+// If the allocation can be satisfied by devices that share a PCIe switch with
+// an RDMA device, or by the devices of a single NUMA node, the algorithm is
+// first run over these subsets of the available devices (in that order).
 func (r *resourceManager) getPreferredAllocation(available, required []string, size int) ([]string, error) {
+	var subsets [][]string
+	if paired := r.rdmaPairedCandidates(available, required, size); paired != nil {
+		if candidates := r.numaAlignedCandidates(paired, required, size); candidates != nil {
+			subsets = append(subsets, candidates)
+		}
+		subsets = append(subsets, paired)
+	}
+	if candidates := r.numaAlignedCandidates(available, required, size); candidates != nil {
+		subsets = append(subsets, candidates)
+	}
+
+	for _, candidates := range subsets {
+		devices, err := r.getPreferredAllocationFrom(candidates, required, size)
+		if err == nil && len(devices) == size {
+			return devices, nil
+		}
+	}
+	return r.getPreferredAllocationFrom(available, required, size)
+}
+
+// getPreferredAllocationFrom runs an allocation algorithm over the inputs.
+// The algorithm chosen is based both on the incoming set of available devices and various config settings.
+func (r *resourceManager) getPreferredAllocationFrom(available, required []string, size int) ([]string, error) {
+	// If the available devices are units of memory, then pack them onto as few GPUs as possible.
+	if MemoryUnitIDs(available).AnyIsMemoryUnit() {
+		return r.packedAlloc(available, required, size)
+	}
+
 	// If all of the available devices are full GPUs without replicas, then
 	// calculate an aligned allocation across those devices.
 	if !r.Devices().ContainsMigDevices() && !AnnotatedIDs(available).AnyHasAnnotations() {
 		return r.alignedAlloc(available, required, size)
 	}
 
-	// Otherwise, distribute them evenly across all replicated GPUs
+	// Otherwise, allocate the replicas according to the configured replica policy.
+	switch r.replicaPolicy() {
+	case spec.ReplicaPolicyAligned:
+		// Topology information is only available for full GPUs.
+		if !r.Devices().ContainsMigDevices() {
+			return r.alignedReplicaAlloc(available, required, size)
+		}
+	case spec.ReplicaPolicyPacked:
+		return r.packedAlloc(available, required, size)
+	}
+
+	// By default, distribute them evenly across all replicated GPUs
 	return r.distributedAlloc(available, required, size)
 }
 
-// alignedAlloc shells out to the alignedAllocationPolicy that is set in
+// rdmaPairedCandidates returns the required devices and the available devices that share
+// a PCIe switch with an RDMA device. If there are not enough of them to satisfy the
+// allocation, or if they include all of the available devices, nil is returned.
+func (r *resourceManager) rdmaPairedCandidates(available, required []string, size int) []string {
+	isRequired := make(map[string]bool)
+	for _, id := range required {
+		isRequired[id] = true
+	}
+
+	var candidates []string
+	for _, id := range available {
+		d, exists := r.devices[id]
+		if !exists {
+			return nil
+		}
+		if len(d.RDMADevices) > 0 || isRequired[id] {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) < size || len(candidates) == len(available) {
+		return nil
+	}
+	return candidates
+}
+
+// numaAlignedCandidates returns the available devices on the NUMA node best suited
+// to satisfy the allocation on its own. This is the node of the required devices
+// if there are any, or otherwise the node with the fewest available devices that
+// still satisfy the allocation, so as to leave larger nodes available for later
+// requests. Replicas that are distributed across GPUs are instead taken from the
+// node of the GPU with the fewest replicas in use, so that successive allocations
+// remain balanced across the nodes. If the allocation does not fit on a single
+// node, or the NUMA node of any device is unknown, nil is returned.
+func (r *resourceManager) numaAlignedCandidates(available, required []string, size int) []string {
+	nodes := make(map[int][]string)
+	for _, id := range available {
+		d, exists := r.devices[id]
+		if !exists {
+			return nil
+		}
+		node, hasNuma := d.GetNUMANode()
+		if !hasNuma {
+			return nil
+		}
+		nodes[node] = append(nodes[node], id)
+	}
+	if len(nodes) < 2 {
+		return nil
+	}
+
+	requiredNodes := r.devices.Subset(required).GetNUMANodes()
+	if len(requiredNodes) > 1 {
+		return nil
+	}
+
+	// By default, nodes are ranked by their number of available devices.
+	rank := func(node int) int {
+		return len(nodes[node])
+	}
+	if r.distributesReplicas(available) {
+		used := r.usedReplicas(available, required)
+		rank = func(node int) int {
+			least := -1
+			for _, id := range nodes[node] {
+				if count := used[r.physicalDeviceOf(id)]; least == -1 || count < least {
+					least = count
+				}
+			}
+			return least
+		}
+	}
+
+	best := -1
+	for node, ids := range nodes {
+		if len(requiredNodes) == 1 && node != requiredNodes[0] {
+			continue
+		}
+		if len(ids) < size {
+			continue
+		}
+		if best == -1 || rank(node) < rank(best) || (rank(node) == rank(best) && node < best) {
+			best = node
+		}
+	}
+	if best == -1 {
+		return nil
+	}
+	return nodes[best]
+}
+
+// distributesReplicas returns whether the available devices are replicated or MIG
+// devices that are spread across their GPUs by the configured replica policy.
+func (r *resourceManager) distributesReplicas(available []string) bool {
+	if MemoryUnitIDs(available).AnyIsMemoryUnit() {
+		return false
+	}
+	if !r.Devices().ContainsMigDevices() && !AnnotatedIDs(available).AnyHasAnnotations() {
+		return false
+	}
+	return r.replicaPolicy() != spec.ReplicaPolicyPacked
+}
+
+// allocationPolicy returns the configured allocation policy.
+func (r *resourceManager) allocationPolicy() string {
+	if r.config.Flags.Plugin == nil || r.config.Flags.Plugin.AllocationPolicy == nil {
+		return spec.AllocationPolicyBestEffort
+	}
+	return *r.config.Flags.Plugin.AllocationPolicy
+}
+
+// replicaPolicy returns the policy used to allocate replicated and MIG devices.
+// A replica policy set for time-slicing takes precedence over the allocation policy.
+func (r *resourceManager) replicaPolicy() string {
+	if policy := r.config.Sharing.TimeSlicing.ReplicaPolicy; policy != "" {
+		return policy
+	}
+	if r.allocationPolicy() == spec.AllocationPolicyPacking {
+		return spec.ReplicaPolicyPacked
+	}
+	return spec.ReplicaPolicyDistributed
+}
+
+// alignedAllocationPolicy returns the go-gpuallocator policy used to allocate full GPUs.
+// The packing and spreading policies only apply to replicated and MIG devices, so full
+// GPUs are allocated with the best-effort policy under them. Since replicated and MIG
+// devices are distributed by default, spreading is an alias of best-effort.
+func (r *resourceManager) alignedAllocationPolicy() gpuallocator.Policy {
+	switch r.allocationPolicy() {
+	case spec.AllocationPolicySimple:
+		return gpuallocator.NewSimplePolicy()
+	case spec.AllocationPolicyStaticDGX1Pascal:
+		return gpuallocator.NewStaticDGX1Policy(gpuallocator.GPUTypePascal)
+	case spec.AllocationPolicyStaticDGX1Volta:
+		return gpuallocator.NewStaticDGX1Policy(gpuallocator.GPUTypeVolta)
+	}
+	return gpuallocator.NewBestEffortPolicy()
+}
+
+// physicalDeviceOf returns a key identifying the physical device that the specified device belongs to.
+// Replicas belong to the device they replicate and MIG devices belong to their parent GPU.
+func (r *resourceManager) physicalDeviceOf(id string) string {
+	if AnnotatedID(id).HasAnnotations() {
+		return AnnotatedID(id).GetID()
+	}
+	if d, exists := r.devices[id]; exists && d.IsMigDevice() {
+		return "gpu:" + strings.SplitN(d.Index, ":", 2)[0]
+	}
+	return id
+}
+
+// alignedAlloc shells out to the configured alignedAllocationPolicy in
 // order to calculate the preferred allocation.
 func (r *resourceManager) alignedAlloc(available, required []string, size int) ([]string, error) {
 	var devices []string
@@ -53,7 +246,7 @@ func (r *resourceManager) alignedAlloc(available, required []string, size int) (
 		return nil, fmt.Errorf("unable to retrieve list of required devices: %v", err)
 	}
 
-	allocatedDevices := alignedAllocationPolicy.Allocate(availableDevices, requiredDevices, size)
+	allocatedDevices := r.alignedAllocationPolicy().Allocate(availableDevices, requiredDevices, size)
 
 	for _, device := range allocatedDevices {
 		devices = append(devices, device.UUID)
@@ -62,6 +255,65 @@ func (r *resourceManager) alignedAlloc(available, required []string, size int) (
 	return devices, nil
 }
 
+// alignedReplicaAlloc returns a list of replicas such that the replicas are
+// spread across as many distinct GPUs as possible, with the GPUs chosen by the
+// alignedAllocationPolicy so as to take the topology between them into account.
+// Once each GPU holds a replica, any remaining replicas are distributed evenly
+// across the chosen GPUs.
+func (r *resourceManager) alignedReplicaAlloc(available, required []string, size int) ([]string, error) {
+	return r.alignedReplicaAllocWith(r.alignedAlloc, available, required, size)
+}
+
+// alignedReplicaAllocWith implements alignedReplicaAlloc with the GPUs chosen by the specified
+// allocation function, which is given the UUIDs of the available and required GPUs.
+func (r *resourceManager) alignedReplicaAllocWith(alignedAlloc func(available, required []string, size int) ([]string, error), available, required []string, size int) ([]string, error) {
+	candidates := r.devices.Subset(available).Difference(r.devices.Subset(required)).GetIDs()
+	sort.Strings(candidates)
+
+	// Build the sets of GPUs that available and required replicas belong to.
+	var availableGPUs, requiredGPUs []string
+	replicas := make(map[string][]string)
+	for _, c := range candidates {
+		id := AnnotatedID(c).GetID()
+		if len(replicas[id]) == 0 {
+			availableGPUs = append(availableGPUs, id)
+		}
+		replicas[id] = append(replicas[id], c)
+	}
+	for id := range AnnotatedIDs(required).CountByID() {
+		requiredGPUs = append(requiredGPUs, id)
+		if len(replicas[id]) == 0 {
+			availableGPUs = append(availableGPUs, id)
+		}
+	}
+
+	// Each replica that is still needed can be taken from a distinct GPU.
+	gpus := len(requiredGPUs) + size - len(required)
+	if gpus > len(availableGPUs) {
+		gpus = len(availableGPUs)
+	}
+	if len(requiredGPUs) >= gpus {
+		return r.distributedAlloc(available, required, size)
+	}
+
+	aligned, err := alignedAlloc(availableGPUs, requiredGPUs, gpus)
+	if err != nil {
+		return nil, err
+	}
+
+	// Take a single replica from each of the GPUs that does not already hold a required replica.
+	devices := append([]string{}, required...)
+	for _, id := range aligned {
+		if len(replicas[id]) == 0 || contains(requiredGPUs, id) {
+			continue
+		}
+		devices = append(devices, replicas[id][0])
+	}
+
+	// Any remaining replicas are distributed across the GPUs as before.
+	return r.distributedAlloc(available, devices, size)
+}
+
 // distributedAlloc returns a list of devices such that any replicated
 // devices are distributed across all replicated GPUs equally. It takes into
 // account already allocated replicas to ensure a proper balance across them.
@@ -74,42 +326,26 @@ func (r *resourceManager) distributedAlloc(available, required []string, size in
 		return nil, fmt.Errorf("not enough available devices to satisfy allocation")
 	}
 
-	// For each candidate device, build a mapping of (stripped) device ID to
-	// total / available replicas for that device.
-	replicas := make(map[string]*struct{ total, available int })
-	for _, c := range candidates {
-		id := AnnotatedID(c).GetID()
-		if _, exists := replicas[id]; !exists {
-			replicas[id] = &struct{ total, available int }{}
-		}
-		replicas[id].available++
-	}
-	for d := range r.devices {
-		id := AnnotatedID(d).GetID()
-		if _, exists := replicas[id]; !exists {
-			continue
-		}
-		replicas[id].total++
-	}
+	// Build a mapping of (stripped) device ID to the number of replicas of
+	// that device that are already in use.
+	used := r.usedReplicas(candidates, required)
 
 	// Grab the set of 'needed' devices one-by-one from the candidates list.
 	// Before selecting each candidate, first sort the candidate list using the
-	// replicas map above. After sorting, the first element in the list will
-	// contain the device with the least difference between total and available
-	// replications (based on what's already been allocated). Add this device
-	// to the list of devices to allocate, remove it from the candidate list,
-	// down its available count in the replicas map, and repeat.
+	// used map above. After sorting, the first element in the list will
+	// contain the device with the fewest replicas in use (based on what's
+	// already been allocated). Add this device to the list of devices to
+	// allocate, remove it from the candidate list, up its used count in the
+	// used map, and repeat.
 	var devices []string
 	for i := 0; i < needed; i++ {
 		sort.Slice(candidates, func(i, j int) bool {
-			iid := AnnotatedID(candidates[i]).GetID()
-			jid := AnnotatedID(candidates[j]).GetID()
-			idiff := replicas[iid].total - replicas[iid].available
-			jdiff := replicas[jid].total - replicas[jid].available
-			return idiff < jdiff
+			iid := r.physicalDeviceOf(candidates[i])
+			jid := r.physicalDeviceOf(candidates[j])
+			return used[iid] < used[jid]
 		})
-		id := AnnotatedID(candidates[0]).GetID()
-		replicas[id].available--
+		id := r.physicalDeviceOf(candidates[0])
+		used[id]++
 		devices = append(devices, candidates[0])
 		candidates = candidates[1:]
 	}
@@ -119,3 +355,126 @@ func (r *resourceManager) distributedAlloc(available, required []string, size in
 
 	return devices, nil
 }
+
+// usedReplicas returns a mapping of (stripped) device ID to the number of
+// replicas of that device that are in use. If the resource manager has access
+// to the kubelet PodResources API, the replicas allocated to containers are
+// counted, including replicas advertised under a previous configuration or by
+// other resources. This keeps the allocations balanced across plugin restarts.
+// Otherwise, or if the kubelet cannot be queried, all replicas that are not
+// candidates are assumed to be in use. The required replicas are always
+// counted as in use.
+func (r *resourceManager) usedReplicas(candidates, required []string) map[string]int {
+	used := make(map[string]int)
+	if r.podResources != nil {
+		allocations, err := r.podResources.GetAllocations()
+		if err == nil {
+			for _, id := range append(allocations.GetDeviceIDs(), required...) {
+				used[r.physicalDeviceOf(id)]++
+			}
+			return used
+		}
+		klog.Warningf("Failed to get allocations from the kubelet; balancing on available devices only: %v", err)
+	}
+
+	isCandidate := make(map[string]bool)
+	for _, c := range candidates {
+		isCandidate[c] = true
+	}
+	for d := range r.devices {
+		if !isCandidate[d] {
+			used[r.physicalDeviceOf(d)]++
+		}
+	}
+	return used
+}
+
+// packedAlloc returns a list of devices such that any replicated devices
+// (including memory units) are packed onto as few GPUs as possible. If a
+// single GPU has enough available replicas to satisfy the allocation, the GPU
+// with the fewest available replicas is chosen so as to leave larger blocks
+// of replicas available for later requests. Otherwise, replicas are taken
+// from the GPUs with the most available replicas first. GPUs that already
+// hold required replicas are always filled first.
+func (r *resourceManager) packedAlloc(available, required []string, size int) ([]string, error) {
+	candidates := r.devices.Subset(available).Difference(r.devices.Subset(required)).GetIDs()
+	needed := size - len(required)
+
+	if len(candidates) < needed {
+		return nil, fmt.Errorf("not enough available devices to satisfy allocation")
+	}
+
+	// Group the candidate replicas by GPU.
+	indices := make(map[string]string)
+	for _, d := range r.devices {
+		indices[r.physicalDeviceOf(d.ID)] = d.Index
+	}
+	replicas := make(map[string][]string)
+	for _, c := range candidates {
+		id := r.physicalDeviceOf(c)
+		replicas[id] = append(replicas[id], c)
+	}
+	var ids []string
+	for id := range replicas {
+		sort.Strings(replicas[id])
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return LessIndex(indices[ids[i]], indices[ids[j]])
+	})
+
+	devices := append([]string{}, required...)
+	take := func(id string, count int) {
+		if count > len(replicas[id]) {
+			count = len(replicas[id])
+		}
+		devices = append(devices, replicas[id][:count]...)
+		replicas[id] = replicas[id][count:]
+		needed -= count
+	}
+
+	// Fill the GPUs that required replicas are allocated from first.
+	for _, id := range required {
+		take(r.physicalDeviceOf(id), needed)
+	}
+	if needed == 0 {
+		return devices, nil
+	}
+
+	// Find the best fit on a single GPU.
+	bestFit := ""
+	for _, id := range ids {
+		if len(replicas[id]) < needed {
+			continue
+		}
+		if bestFit == "" || len(replicas[id]) < len(replicas[bestFit]) {
+			bestFit = id
+		}
+	}
+	if bestFit != "" {
+		take(bestFit, needed)
+		return devices, nil
+	}
+
+	// Otherwise, take replicas from the GPUs with the most available replicas first.
+	sort.SliceStable(ids, func(i, j int) bool {
+		return len(replicas[ids[i]]) > len(replicas[ids[j]])
+	})
+	for _, id := range ids {
+		if needed == 0 {
+			break
+		}
+		take(id, needed)
+	}
+
+	return devices, nil
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,641 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+	"github.com/stretchr/testify/require"
+
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
+)
+
+// newMemoryUnits returns the IDs of the first count memory units of the specified device.
+func newMemoryUnits(id string, count int) []string {
+	var ids []string
+	for i := 0; i < count; i++ {
+		ids = append(ids, string(NewMemoryUnitID(id, i)))
+	}
+	return ids
+}
+
+func TestPackedAlloc(t *testing.T) {
+	// Two devices with 4 units of memory each.
+	devices := make(Devices)
+	for i := 0; i < 2; i++ {
+		for _, id := range newMemoryUnits(fmt.Sprintf("GPU-%d", i), 4) {
+			d := &Device{Index: fmt.Sprintf("%d", i)}
+			d.ID = id
+			devices[id] = d
+		}
+	}
+	r := &resourceManager{devices: devices}
+
+	gpu0 := newMemoryUnits("GPU-0", 4)
+	gpu1 := newMemoryUnits("GPU-1", 4)
+
+	testCases := []struct {
+		description     string
+		available       []string
+		required        []string
+		size            int
+		expectedDevices map[string]int
+		expectedError   bool
+	}{
+		{
+			description:     "ties are broken by index",
+			available:       append(gpu0, gpu1...),
+			size:            2,
+			expectedDevices: map[string]int{"GPU-0": 2},
+		},
+		{
+			description:     "best fit on a single device",
+			available:       append(gpu0, gpu1[2:]...),
+			size:            2,
+			expectedDevices: map[string]int{"GPU-1": 2},
+		},
+		{
+			description:     "only one device fits",
+			available:       append(gpu0, gpu1[2:]...),
+			size:            3,
+			expectedDevices: map[string]int{"GPU-0": 3},
+		},
+		{
+			description:     "packed across as few devices as possible",
+			available:       append(gpu0[1:], gpu1[2:]...),
+			size:            4,
+			expectedDevices: map[string]int{"GPU-0": 3, "GPU-1": 1},
+		},
+		{
+			description:     "the device of required units is filled first",
+			available:       append(gpu0, gpu1...),
+			required:        gpu1[:1],
+			size:            3,
+			expectedDevices: map[string]int{"GPU-1": 3},
+		},
+		{
+			description:   "not enough units",
+			available:     gpu0,
+			size:          5,
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			allocated, err := r.getPreferredAllocation(tc.available, tc.required, tc.size)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, allocated, tc.size)
+			require.Equal(t, tc.expectedDevices, MemoryUnitIDs(allocated).CountByID())
+
+			// Each unit is only allocated once.
+			sort.Strings(allocated)
+			for i := 1; i < len(allocated); i++ {
+				require.NotEqual(t, allocated[i-1], allocated[i])
+			}
+		})
+	}
+}
+
+func TestReplicaPolicies(t *testing.T) {
+	// Two devices with 4 replicas each.
+	devices := make(Devices)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 4; j++ {
+			d := &Device{Index: fmt.Sprintf("%d", i)}
+			d.ID = string(NewAnnotatedID(fmt.Sprintf("GPU-%d", i), j))
+			devices[d.ID] = d
+		}
+	}
+	available := devices.GetIDs()
+
+	testCases := []struct {
+		description     string
+		policy          string
+		required        []string
+		size            int
+		expectedDevices map[string]int
+	}{
+		{
+			description:     "distributed by default",
+			size:            2,
+			expectedDevices: map[string]int{"GPU-0": 1, "GPU-1": 1},
+		},
+		{
+			description:     "distributed",
+			policy:          spec.ReplicaPolicyDistributed,
+			size:            4,
+			expectedDevices: map[string]int{"GPU-0": 2, "GPU-1": 2},
+		},
+		{
+			description:     "packed",
+			policy:          spec.ReplicaPolicyPacked,
+			size:            2,
+			expectedDevices: map[string]int{"GPU-0": 2},
+		},
+		{
+			description:     "packed with required replicas",
+			policy:          spec.ReplicaPolicyPacked,
+			required:        []string{"GPU-1::2"},
+			size:            3,
+			expectedDevices: map[string]int{"GPU-1": 3},
+		},
+		{
+			description:     "packed across devices",
+			policy:          spec.ReplicaPolicyPacked,
+			size:            6,
+			expectedDevices: map[string]int{"GPU-0": 4, "GPU-1": 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r := &resourceManager{
+				config:  &spec.Config{Sharing: spec.Sharing{TimeSlicing: spec.TimeSlicing{ReplicaPolicy: tc.policy}}},
+				devices: devices,
+			}
+			allocated, err := r.getPreferredAllocation(available, tc.required, tc.size)
+			require.NoError(t, err)
+			require.Len(t, allocated, tc.size)
+			require.Subset(t, allocated, tc.required)
+			require.Equal(t, tc.expectedDevices, AnnotatedIDs(allocated).CountByID())
+		})
+	}
+}
+
+// newTestAlignedAlloc returns an allocation function that chooses the set of GPUs with the
+// highest sum of the scores of the links between them, standing in for go-gpuallocator.
+// Links between GPUs that are not listed score 0.
+func newTestAlignedAlloc(links map[[2]string]int) func([]string, []string, int) ([]string, error) {
+	score := func(gpus []string) int {
+		total := 0
+		for i := range gpus {
+			for j := i + 1; j < len(gpus); j++ {
+				total += links[[2]string{gpus[i], gpus[j]}] + links[[2]string{gpus[j], gpus[i]}]
+			}
+		}
+		return total
+	}
+
+	return func(available, required []string, size int) ([]string, error) {
+		var candidates []string
+		for _, id := range available {
+			if !contains(required, id) {
+				candidates = append(candidates, id)
+			}
+		}
+		sort.Strings(candidates)
+
+		var best []string
+		var choose func(chosen []string, next int)
+		choose = func(chosen []string, next int) {
+			if len(chosen) == size {
+				if best == nil || score(chosen) > score(best) {
+					best = append([]string{}, chosen...)
+				}
+				return
+			}
+			for i := next; i < len(candidates); i++ {
+				choose(append(chosen, candidates[i]), i+1)
+			}
+		}
+		choose(append([]string{}, required...), 0)
+		if best == nil {
+			return nil, fmt.Errorf("not enough devices")
+		}
+		return best, nil
+	}
+}
+
+func TestAlignedReplicaPolicy(t *testing.T) {
+	// Four devices with 2 replicas each. Devices 1 and 3 are linked by four
+	// NVLinks and devices 0 and 2 by a single NVLink.
+	config := newTestConfig(t, spec.Resources{}, spec.Sharing{
+		TimeSlicing: spec.TimeSlicing{
+			ReplicaPolicy: spec.ReplicaPolicyAligned,
+			Resources: []spec.ReplicatedResource{
+				{Name: "nvidia.com/gpu", Devices: spec.ReplicatedDevices{All: true}, Replicas: 2},
+			},
+		},
+	})
+	deviceMap, err := NewDeviceMap(newMockNVML("Tesla V100-SXM2-16GB", "Tesla V100-SXM2-16GB", "Tesla V100-SXM2-16GB", "Tesla V100-SXM2-16GB"), config)
+	require.NoError(t, err)
+	devices := deviceMap["nvidia.com/gpu"]
+
+	gpu := func(i int) string {
+		return testGPUUUID(i)
+	}
+	replica := func(i int, j int) string {
+		return string(NewAnnotatedID(gpu(i), j))
+	}
+	alignedAlloc := newTestAlignedAlloc(map[[2]string]int{
+		{gpu(1), gpu(3)}: 4,
+		{gpu(0), gpu(2)}: 1,
+	})
+
+	testCases := []struct {
+		description     string
+		available       []string
+		required        []string
+		size            int
+		expectedDevices map[string]int
+	}{
+		{
+			description:     "best linked devices",
+			available:       devices.GetIDs(),
+			size:            2,
+			expectedDevices: map[string]int{gpu(1): 1, gpu(3): 1},
+		},
+		{
+			description:     "device best linked to required replica",
+			available:       devices.GetIDs(),
+			required:        []string{replica(2, 1)},
+			size:            2,
+			expectedDevices: map[string]int{gpu(0): 1, gpu(2): 1},
+		},
+		{
+			description:     "best linked available devices",
+			available:       devices.Difference(devices.Subset([]string{replica(1, 0), replica(1, 1)})).GetIDs(),
+			size:            2,
+			expectedDevices: map[string]int{gpu(0): 1, gpu(2): 1},
+		},
+		{
+			description:     "one replica on each device",
+			available:       devices.GetIDs(),
+			size:            4,
+			expectedDevices: map[string]int{gpu(0): 1, gpu(1): 1, gpu(2): 1, gpu(3): 1},
+		},
+		{
+			description:     "remaining replicas are distributed",
+			available:       devices.GetIDs(),
+			required:        []string{replica(1, 0), replica(1, 1)},
+			size:            3,
+			expectedDevices: map[string]int{gpu(1): 2, gpu(3): 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r := &resourceManager{
+				config:  config,
+				devices: devices,
+			}
+			allocated, err := r.alignedReplicaAllocWith(alignedAlloc, tc.available, tc.required, tc.size)
+			require.NoError(t, err)
+			require.Len(t, allocated, tc.size)
+			require.Subset(t, allocated, tc.required)
+			require.Equal(t, tc.expectedDevices, AnnotatedIDs(allocated).CountByID())
+		})
+	}
+}
+
+// testPodResources returns a fixed set of allocations or an error.
+type testPodResources struct {
+	allocations podresources.Allocations
+	err         error
+}
+
+func (p *testPodResources) GetAllocations() (podresources.Allocations, error) {
+	return p.allocations, p.err
+}
+
+func TestDistributedAllocWithPodResources(t *testing.T) {
+	// Two GPUs with 4 replicas each.
+	devices := make(Devices)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 4; j++ {
+			d := &Device{Index: fmt.Sprintf("%d", i)}
+			d.ID = string(NewAnnotatedID(fmt.Sprintf("GPU-%d", i), j))
+			devices[d.ID] = d
+		}
+	}
+
+	allocated := func(ids ...string) *testPodResources {
+		return &testPodResources{
+			allocations: podresources.Allocations{
+				{Namespace: "default", Pod: "pod", Container: "ctr", Resource: "nvidia.com/gpu", DeviceIDs: ids},
+			},
+		}
+	}
+
+	testCases := []struct {
+		description     string
+		podResources    podresources.Interface
+		available       []string
+		required        []string
+		expectedDevices map[string]int
+	}{
+		{
+			description:     "unavailable replicas are counted without pod resources",
+			available:       devices.Difference(devices.Subset([]string{"GPU-0::0", "GPU-0::1"})).GetIDs(),
+			expectedDevices: map[string]int{"GPU-1": 1},
+		},
+		{
+			description:     "replicas allocated under a previous configuration are counted",
+			podResources:    allocated("GPU-1::5", "GPU-1::6"),
+			available:       devices.GetIDs(),
+			expectedDevices: map[string]int{"GPU-0": 1},
+		},
+		{
+			description:     "unhealthy replicas are not counted",
+			podResources:    allocated("GPU-1::0"),
+			available:       devices.Difference(devices.Subset([]string{"GPU-0::0", "GPU-0::1", "GPU-1::0"})).GetIDs(),
+			expectedDevices: map[string]int{"GPU-0": 1},
+		},
+		{
+			description:     "required replicas are counted",
+			podResources:    allocated("GPU-1::0"),
+			available:       devices.GetIDs(),
+			required:        []string{"GPU-0::0", "GPU-0::1"},
+			expectedDevices: map[string]int{"GPU-0": 2, "GPU-1": 1},
+		},
+		{
+			description:     "unavailable replicas are counted if the kubelet cannot be queried",
+			podResources:    &testPodResources{err: fmt.Errorf("connection refused")},
+			available:       devices.Difference(devices.Subset([]string{"GPU-0::0", "GPU-0::1"})).GetIDs(),
+			expectedDevices: map[string]int{"GPU-1": 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r := &resourceManager{
+				devices:      devices,
+				podResources: tc.podResources,
+			}
+			size := len(tc.required) + 1
+			allocated, err := r.distributedAlloc(tc.available, tc.required, size)
+			require.NoError(t, err)
+			require.Len(t, allocated, size)
+			require.Subset(t, allocated, tc.required)
+			require.Equal(t, tc.expectedDevices, AnnotatedIDs(allocated).CountByID())
+		})
+	}
+}
+
+func TestAllocationPolicies(t *testing.T) {
+	// Two GPUs with 4 MIG devices each.
+	devices := make(Devices)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 4; j++ {
+			d := &Device{Index: fmt.Sprintf("%d:%d", i, j)}
+			d.ID = fmt.Sprintf("MIG-%d-%d", i, j)
+			devices[d.ID] = d
+		}
+	}
+	available := devices.GetIDs()
+
+	testCases := []struct {
+		description     string
+		policy          string
+		replicaPolicy   string
+		required        []string
+		size            int
+		expectedDevices map[string]int
+	}{
+		{
+			description:     "spreading",
+			policy:          spec.AllocationPolicySpreading,
+			size:            2,
+			expectedDevices: map[string]int{"0": 1, "1": 1},
+		},
+		{
+			description:     "spreading with required devices",
+			policy:          spec.AllocationPolicySpreading,
+			required:        []string{"MIG-1-0"},
+			size:            3,
+			expectedDevices: map[string]int{"0": 2, "1": 1},
+		},
+		{
+			description:     "packing",
+			policy:          spec.AllocationPolicyPacking,
+			size:            3,
+			expectedDevices: map[string]int{"0": 3},
+		},
+		{
+			description:     "packing with required devices",
+			policy:          spec.AllocationPolicyPacking,
+			required:        []string{"MIG-1-0"},
+			size:            2,
+			expectedDevices: map[string]int{"1": 2},
+		},
+		{
+			description:     "replica policy takes precedence",
+			policy:          spec.AllocationPolicyPacking,
+			replicaPolicy:   spec.ReplicaPolicyDistributed,
+			size:            2,
+			expectedDevices: map[string]int{"0": 1, "1": 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			config := &spec.Config{
+				Flags: spec.Flags{
+					CommandLineFlags: spec.CommandLineFlags{
+						Plugin: &spec.PluginCommandLineFlags{AllocationPolicy: &tc.policy},
+					},
+				},
+				Sharing: spec.Sharing{TimeSlicing: spec.TimeSlicing{ReplicaPolicy: tc.replicaPolicy}},
+			}
+			r := &resourceManager{config: config, devices: devices}
+
+			allocated, err := r.getPreferredAllocation(available, tc.required, tc.size)
+			require.NoError(t, err)
+			require.Len(t, allocated, tc.size)
+			require.Subset(t, allocated, tc.required)
+
+			gpus := make(map[string]int)
+			for _, id := range allocated {
+				gpus[strings.SplitN(devices[id].Index, ":", 2)[0]]++
+			}
+			require.Equal(t, tc.expectedDevices, gpus)
+		})
+	}
+}
+
+func TestNUMAAlignedAllocation(t *testing.T) {
+	// Four devices with 2 replicas each. Devices 0 and 1 are attached to NUMA node 0
+	// and devices 2 and 3 to NUMA node 1.
+	devices := make(Devices)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 2; j++ {
+			d := &Device{Index: fmt.Sprintf("%d", i)}
+			d.ID = string(NewAnnotatedID(fmt.Sprintf("GPU-%d", i), j))
+			d.Topology = &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: int64(i / 2)}}}
+			devices[d.ID] = d
+		}
+	}
+	testCases := []struct {
+		description   string
+		policy        string
+		available     []string
+		required      []string
+		size          int
+		expectedNodes []int
+	}{
+		{
+			description:   "fits on a single node",
+			available:     devices.GetIDs(),
+			size:          4,
+			expectedNodes: []int{0},
+		},
+		{
+			description:   "node with fewest available devices",
+			policy:        spec.ReplicaPolicyPacked,
+			available:     []string{"GPU-0::0", "GPU-1::0", "GPU-1::1", "GPU-2::0", "GPU-3::0"},
+			size:          2,
+			expectedNodes: []int{1},
+		},
+		{
+			description:   "node of the least used device",
+			available:     []string{"GPU-0::0", "GPU-1::0", "GPU-1::1", "GPU-2::0", "GPU-3::0"},
+			size:          2,
+			expectedNodes: []int{0},
+		},
+		{
+			description:   "node of required devices",
+			available:     devices.GetIDs(),
+			required:      []string{"GPU-3::1"},
+			size:          2,
+			expectedNodes: []int{1},
+		},
+		{
+			description:   "spans nodes if the allocation does not fit on one",
+			available:     devices.GetIDs(),
+			size:          5,
+			expectedNodes: []int{0, 1},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			r := &resourceManager{
+				config:  &spec.Config{Sharing: spec.Sharing{TimeSlicing: spec.TimeSlicing{ReplicaPolicy: tc.policy}}},
+				devices: devices,
+			}
+			allocated, err := r.getPreferredAllocation(tc.available, tc.required, tc.size)
+			require.NoError(t, err)
+			require.Len(t, allocated, tc.size)
+			require.Subset(t, allocated, tc.required)
+			require.Equal(t, tc.expectedNodes, devices.Subset(allocated).GetNUMANodes())
+		})
+	}
+}
+
+func TestNUMAAlignedDistributedAllocation(t *testing.T) {
+	// Two devices with 4 replicas each. Device 0 is attached to NUMA node 0 and
+	// device 1 to NUMA node 1.
+	devices := make(Devices)
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 4; j++ {
+			d := &Device{Index: fmt.Sprintf("%d", i)}
+			d.ID = string(NewAnnotatedID(fmt.Sprintf("GPU-%d", i), j))
+			d.Topology = &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: int64(i)}}}
+			devices[d.ID] = d
+		}
+	}
+	r := &resourceManager{config: &spec.Config{}, devices: devices}
+
+	// Successive allocations of a single replica are balanced across the devices.
+	available := devices.GetIDs()
+	var allocated []string
+	for i := 0; i < 4; i++ {
+		devices, err := r.getPreferredAllocation(available, nil, 1)
+		require.NoError(t, err)
+		require.Len(t, devices, 1)
+		allocated = append(allocated, devices...)
+		available = r.devices.Subset(available).Difference(r.devices.Subset(devices)).GetIDs()
+	}
+	require.Equal(t, map[string]int{"GPU-0": 2, "GPU-1": 2}, AnnotatedIDs(allocated).CountByID())
+}
+
+func TestRDMAPairedAllocation(t *testing.T) {
+	// Four devices with 2 replicas each. Devices 0 and 1 are attached to NUMA node 0
+	// and devices 2 and 3 to NUMA node 1. Devices 0 and 2 share a PCIe switch with
+	// an RDMA device.
+	rdmaDevices := map[int][]string{0: {"mlx5_0"}, 2: {"mlx5_1"}}
+	devices := make(Devices)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 2; j++ {
+			d := &Device{Index: fmt.Sprintf("%d", i), RDMADevices: rdmaDevices[i]}
+			d.ID = string(NewAnnotatedID(fmt.Sprintf("GPU-%d", i), j))
+			d.Topology = &pluginapi.TopologyInfo{Nodes: []*pluginapi.NUMANode{{ID: int64(i / 2)}}}
+			devices[d.ID] = d
+		}
+	}
+	r := &resourceManager{config: &spec.Config{}, devices: devices}
+
+	testCases := []struct {
+		description         string
+		available           []string
+		required            []string
+		size                int
+		expectedRDMADevices []string
+		expectedNodes       []int
+	}{
+		{
+			description:         "paired devices on a single node",
+			available:           devices.GetIDs(),
+			size:                2,
+			expectedRDMADevices: []string{"mlx5_0"},
+			expectedNodes:       []int{0},
+		},
+		{
+			description:         "paired devices across nodes",
+			available:           devices.GetIDs(),
+			size:                3,
+			expectedRDMADevices: []string{"mlx5_0", "mlx5_1"},
+			expectedNodes:       []int{0, 1},
+		},
+		{
+			description:         "required devices are included",
+			available:           devices.GetIDs(),
+			required:            []string{"GPU-3::0"},
+			size:                2,
+			expectedRDMADevices: []string{"mlx5_1"},
+			expectedNodes:       []int{1},
+		},
+		{
+			description:         "not enough paired devices",
+			available:           []string{"GPU-0::0", "GPU-1::0", "GPU-1::1", "GPU-3::0"},
+			size:                3,
+			expectedRDMADevices: []string{"mlx5_0"},
+			expectedNodes:       []int{0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			allocated, err := r.getPreferredAllocation(tc.available, tc.required, tc.size)
+			require.NoError(t, err)
+			require.Len(t, allocated, tc.size)
+			require.Subset(t, allocated, tc.required)
+			require.Equal(t, tc.expectedRDMADevices, devices.Subset(allocated).GetRDMADevices())
+			require.Equal(t, tc.expectedNodes, devices.Subset(allocated).GetNUMANodes())
+		})
+	}
+}
@@ -18,8 +18,12 @@ package rm
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rdma"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvlib/device"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
 )
@@ -27,6 +31,9 @@ import (
 type deviceMapBuilder struct {
 	device.Interface
 	config *spec.Config
+	// newGPUDevice and newMigDevice return the index and the info of a visited GPU or MIG device.
+	newGPUDevice func(i int, gpu nvml.Device) (string, deviceInfo)
+	newMigDevice func(i int, j int, mig nvml.Device) (string, deviceInfo)
 }
 
 // DeviceMap stores a set of devices per resource name.
@@ -35,8 +42,10 @@ type DeviceMap map[spec.ResourceName]Devices
 // NewDeviceMap creates a device map for the specified NVML library and config.
 func NewDeviceMap(nvmllib nvml.Interface, config *spec.Config) (DeviceMap, error) {
 	b := deviceMapBuilder{
-		Interface: device.New(device.WithNvml(nvmllib)),
-		config:    config,
+		Interface:    device.New(device.WithNvml(nvmllib)),
+		config:       config,
+		newGPUDevice: newGPUDevice,
+		newMigDevice: newMigDevice,
 	}
 	return b.build()
 }
@@ -47,9 +56,18 @@ func (b *deviceMapBuilder) build() (DeviceMap, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error building device map from config.resources: %v", err)
 	}
-	devices, err = updateDeviceMapWithReplicas(b.config, devices)
+	return updateDeviceMapWithSharing(b.config, devices)
+}
+
+// updateDeviceMapWithSharing updates a device map with the replicas and memory units from config.sharing.
+func updateDeviceMapWithSharing(config *spec.Config, devices DeviceMap) (DeviceMap, error) {
+	devices, err := updateDeviceMapWithReplicas(config, devices)
+	if err != nil {
+		return nil, fmt.Errorf("error updating device map with replicas from config.sharing: %v", err)
+	}
+	devices, err = updateDeviceMapWithMemoryUnits(config, devices)
 	if err != nil {
-		return nil, fmt.Errorf("error updating device map with replicas from config.sharing.timeSlicing.resources: %v", err)
+		return nil, fmt.Errorf("error updating device map with memory units from config.sharing.memory: %v", err)
 	}
 	return devices, nil
 }
@@ -93,7 +111,7 @@ func (b *deviceMapBuilder) buildDeviceMapFromConfigResources() (DeviceMap, error
 func (b *deviceMapBuilder) buildGPUDeviceMap() (DeviceMap, error) {
 	devices := make(DeviceMap)
 
-	b.VisitDevices(func(i int, gpu device.Device) error {
+	err := b.VisitDevices(func(i int, gpu device.Device) error {
 		name, ret := gpu.GetName()
 		if ret != nvml.SUCCESS {
 			return fmt.Errorf("error getting product name for GPU: %v", ret)
@@ -105,15 +123,14 @@ func (b *deviceMapBuilder) buildGPUDeviceMap() (DeviceMap, error) {
 		if migEnabled && *b.config.Flags.MigStrategy != spec.MigStrategyNone {
 			return nil
 		}
-		for _, resource := range b.config.Resources.GPUs {
-			if resource.Pattern.Matches(name) {
-				index, info := newGPUDevice(i, gpu)
-				return devices.setEntry(resource.Name, index, info)
-			}
+		resourceName, err := getGPUResourceName(b.config, name)
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("GPU name '%v' does not match any resource patterns", name)
+		index, info := b.newGPUDevice(i, gpu)
+		return devices.setEntry(resourceName, index, info)
 	})
-	return devices, nil
+	return devices, err
 }
 
 // buildMigDeviceMap builds a map of resource names to MIG devices
@@ -124,17 +141,36 @@ func (b *deviceMapBuilder) buildMigDeviceMap() (DeviceMap, error) {
 		if err != nil {
 			return fmt.Errorf("error getting MIG profile for MIG device at index '(%v, %v)': %v", i, j, err)
 		}
-		for _, resource := range b.config.Resources.MIGs {
-			if resource.Pattern.Matches(migProfile.String()) {
-				index, info := newMigDevice(i, j, mig)
-				return devices.setEntry(resource.Name, index, info)
-			}
+		resourceName, err := getMigResourceName(b.config, migProfile.String())
+		if err != nil {
+			return err
 		}
-		return fmt.Errorf("MIG profile '%v' does not match any resource patterns", migProfile)
+		index, info := b.newMigDevice(i, j, mig)
+		return devices.setEntry(resourceName, index, info)
 	})
 	return devices, err
 }
 
+// getGPUResourceName returns the name of the first GPU resource whose pattern matches the GPU name.
+func getGPUResourceName(config *spec.Config, name string) (spec.ResourceName, error) {
+	for _, resource := range config.Resources.GPUs {
+		if resource.Pattern.Matches(name) {
+			return resource.Name, nil
+		}
+	}
+	return "", fmt.Errorf("GPU name '%v' does not match any resource patterns", name)
+}
+
+// getMigResourceName returns the name of the first MIG resource whose pattern matches the MIG profile.
+func getMigResourceName(config *spec.Config, profile string) (spec.ResourceName, error) {
+	for _, resource := range config.Resources.MIGs {
+		if resource.Pattern.Matches(profile) {
+			return resource.Name, nil
+		}
+	}
+	return "", fmt.Errorf("MIG profile '%v' does not match any resource patterns", profile)
+}
+
 // assertAllMigDevicesAreValid ensures that each MIG-enabled device has at least one MIG device
 // associated with it.
 func (b *deviceMapBuilder) assertAllMigDevicesAreValid(uniform bool) error {
@@ -207,6 +243,43 @@ func (d DeviceMap) merge(o DeviceMap) {
 	}
 }
 
+// setRDMADevices sets the RDMA devices that share a PCIe switch with each device in the device map
+func (d DeviceMap) setRDMADevices(topology rdma.Interface) {
+	for _, devices := range d {
+		for _, device := range devices {
+			device.RDMADevices = topology.GetPairedDevices(device.PCIBusID)
+		}
+	}
+}
+
+// Diff returns the resources that were added to, removed from, or changed in o with respect to d.
+// A resource is changed if it is in both maps but its devices differ.
+func (d DeviceMap) Diff(o DeviceMap) (added, removed, changed []spec.ResourceName) {
+	for name, devices := range o {
+		old, exists := d[name]
+		switch {
+		case !exists:
+			added = append(added, name)
+		case !old.Equal(devices):
+			changed = append(changed, name)
+		}
+	}
+	for name := range d {
+		if _, exists := o[name]; !exists {
+			removed = append(removed, name)
+		}
+	}
+
+	less := func(names []spec.ResourceName) func(i, j int) bool {
+		return func(i, j int) bool { return names[i] < names[j] }
+	}
+	sort.Slice(added, less(added))
+	sort.Slice(removed, less(removed))
+	sort.Slice(changed, less(changed))
+
+	return added, removed, changed
+}
+
 // isEmpty checks whether a device map is empty
 func (d DeviceMap) isEmpty() bool {
 	for _, devices := range d {
@@ -234,7 +307,12 @@ func (d DeviceMap) getIDsOfDevicesToReplicate(r *spec.ReplicatedResource) ([]str
 		if r.Devices.Count > len(devices) {
 			return nil, fmt.Errorf("requested %d devices to be replicated, but only %d devices available", r.Devices.Count, len(devices))
 		}
-		return devices.GetIDs()[:r.Devices.Count], nil
+		// Replicate the first devices by index so that the selection is stable across restarts.
+		ids := devices.GetIDs()
+		sort.Slice(ids, func(i, j int) bool {
+			return LessIndex(devices[ids[i]].Index, devices[ids[j]].Index)
+		})
+		return ids[:r.Devices.Count], nil
 	}
 
 	// If a specific set of devices for this resource type are to be replicated.
@@ -247,6 +325,7 @@ func (d DeviceMap) getIDsOfDevicesToReplicate(r *spec.ReplicatedResource) ([]str
 					return nil, fmt.Errorf("no matching device with UUID: %v", ref)
 				}
 				ids = append(ids, d.ID)
+				continue
 			}
 			if ref.IsGPUIndex() || ref.IsMigIndex() {
 				d := devices.GetByIndex(string(ref))
@@ -254,7 +333,9 @@ func (d DeviceMap) getIDsOfDevicesToReplicate(r *spec.ReplicatedResource) ([]str
 					return nil, fmt.Errorf("no matching device at index: %v", ref)
 				}
 				ids = append(ids, d.ID)
+				continue
 			}
+			return nil, fmt.Errorf("unrecognized device reference: %v", ref)
 		}
 		return ids, nil
 	}
@@ -262,26 +343,105 @@ func (d DeviceMap) getIDsOfDevicesToReplicate(r *spec.ReplicatedResource) ([]str
 	return nil, fmt.Errorf("unexpected error")
 }
 
-// updateDeviceMapWithReplicas returns an updated map of resource names to devices with replica information from spec.Config.Sharing.TimeSlicing.Resources
+// LessIndex compares two device indices (e.g. '1' or '1:0' for MIG devices) numerically.
+func LessIndex(a, b string) bool {
+	as := strings.Split(a, ":")
+	bs := strings.Split(b, ":")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		ai, aerr := strconv.Atoi(as[i])
+		bi, berr := strconv.Atoi(bs[i])
+		if aerr != nil || berr != nil {
+			if as[i] != bs[i] {
+				return as[i] < bs[i]
+			}
+			continue
+		}
+		if ai != bi {
+			return ai < bi
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// updateDeviceMapWithReplicas returns an updated map of resource names to devices with replica information
+// from the resources of the sharing strategy in spec.Config.Sharing
 func updateDeviceMapWithReplicas(config *spec.Config, oDevices DeviceMap) (DeviceMap, error) {
+	usesMPS := config.Sharing.SharingStrategy() == spec.SharingStrategyMPS
+	return shareDevices(oDevices, config.Sharing.ReplicatedResources(), func(r *spec.ReplicatedResource, d *Device) ([]*Device, error) {
+		if usesMPS && d.IsMigDevice() {
+			return nil, fmt.Errorf("MPS sharing is not supported for MIG devices")
+		}
+		var replicas []*Device
+		for i := 0; i < r.Replicas; i++ {
+			replicatedDevice := *d
+			replicatedDevice.ID = string(NewAnnotatedID(d.ID, i))
+			replicas = append(replicas, &replicatedDevice)
+		}
+		return replicas, nil
+	})
+}
+
+// updateDeviceMapWithMemoryUnits returns an updated map of resource names to devices in which the devices
+// selected by spec.Config.Sharing.Memory are replaced by a device for each unit of their memory.
+func updateDeviceMapWithMemoryUnits(config *spec.Config, oDevices DeviceMap) (DeviceMap, error) {
+	if config.Sharing.Memory == nil {
+		return oDevices, nil
+	}
+
+	var resources []spec.ReplicatedResource
+	for _, r := range config.Sharing.Memory.Resources {
+		resources = append(resources, spec.ReplicatedResource{
+			Name:    r.Name,
+			Rename:  r.Rename,
+			Devices: r.Devices,
+		})
+	}
+
+	return shareDevices(oDevices, resources, func(r *spec.ReplicatedResource, d *Device) ([]*Device, error) {
+		if config.Sharing.Memory.UsesMPS() && d.IsMigDevice() {
+			return nil, fmt.Errorf("MPS sharing is not supported for MIG devices")
+		}
+		if d.TotalMemory == 0 {
+			return nil, fmt.Errorf("unable to determine the memory of device %v", d.ID)
+		}
+		units := int(d.TotalMemory / MemoryUnitSize)
+		if units == 0 {
+			return nil, fmt.Errorf("device %v has less than one unit of memory", d.ID)
+		}
+		var memoryUnits []*Device
+		for i := 0; i < units; i++ {
+			memoryUnit := *d
+			memoryUnit.ID = string(NewMemoryUnitID(d.ID, i))
+			memoryUnits = append(memoryUnits, &memoryUnit)
+		}
+		return memoryUnits, nil
+	})
+}
+
+// shareDevices returns an updated map of resource names to devices in which the selected devices of each
+// of the specified resources are replaced by the shared devices created for them by newSharedDevices.
+// The shared devices are advertised under the new name of the resource, if one is specified.
+func shareDevices(oDevices DeviceMap, resources []spec.ReplicatedResource, newSharedDevices func(*spec.ReplicatedResource, *Device) ([]*Device, error)) (DeviceMap, error) {
 	devices := make(DeviceMap)
 
-	// Begin by walking config.Sharing.TimeSlicing.Resources and building a map of just the resource names.
+	// Begin by walking the shared resources and building a map of just the resource names.
 	names := make(map[spec.ResourceName]bool)
-	for _, r := range config.Sharing.TimeSlicing.Resources {
+	for _, r := range resources {
 		names[r.Name] = true
 	}
 
-	// Copy over all devices from oDevices without a resource reference in TimeSlicing.Resources.
+	// Copy over all devices from oDevices without a resource reference in the shared resources.
 	for r, ds := range oDevices {
 		if !names[r] {
 			devices[r] = ds
 		}
 	}
 
-	// Walk TimeSlicing.Resources and update devices in the device map as appropriate.
-	for _, r := range config.Sharing.TimeSlicing.Resources {
-		// Get the IDs of the devices we want to replicate from oDevices
+	// Walk the shared resources and update devices in the device map as appropriate.
+	renamed := make(map[spec.ResourceName]spec.ResourceName)
+	for _, r := range resources {
+		r := r
+		// Get the IDs of the devices we want to share from oDevices
 		ids, err := oDevices.getIDsOfDevicesToReplicate(&r)
 		if err != nil {
 			return nil, fmt.Errorf("unable to get IDs of devices to replicate for '%v' resource: %v", r.Name, err)
@@ -291,23 +451,34 @@ func updateDeviceMapWithReplicas(config *spec.Config, oDevices DeviceMap) (Devic
 			continue
 		}
 
-		// Add any devices we don't want replicated directly into the device map.
+		// Add any devices we don't want shared directly into the device map.
 		for _, d := range oDevices[r.Name].Difference(oDevices[r.Name].Subset(ids)) {
 			devices.insert(r.Name, d)
 		}
 
-		// Create replicated devices add them to the device map.
-		// Rename the resource for replicated devices as requested.
+		// Create shared devices and add them to the device map.
+		// Rename the resource for shared devices as requested.
 		name := r.Name
 		if r.Rename != "" {
 			name = r.Rename
 		}
+		if name != r.Name {
+			// Renamed devices must not be mixed in with the devices of another resource.
+			if _, exists := oDevices[name]; exists {
+				return nil, fmt.Errorf("unable to rename '%v' resource to '%v': resource name already in use", r.Name, name)
+			}
+			if other, exists := renamed[name]; exists && other != r.Name {
+				return nil, fmt.Errorf("unable to rename '%v' resource to '%v': resource name already used by '%v'", r.Name, name, other)
+			}
+			renamed[name] = r.Name
+		}
 		for _, id := range ids {
-			for i := 0; i < r.Replicas; i++ {
-				annotatedID := string(NewAnnotatedID(id, i))
-				replicatedDevice := *(oDevices[r.Name][id])
-				replicatedDevice.ID = annotatedID
-				devices.insert(name, &replicatedDevice)
+			shared, err := newSharedDevices(&r, oDevices[r.Name][id])
+			if err != nil {
+				return nil, fmt.Errorf("unable to share device %v of '%v' resource: %v", id, r.Name, err)
+			}
+			for _, d := range shared {
+				devices.insert(name, d)
 			}
 		}
 	}
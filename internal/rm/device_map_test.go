@@ -17,13 +17,87 @@
 package rm
 
 import (
+	"fmt"
+	"sort"
 	"testing"
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
 	"github.com/stretchr/testify/require"
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
+// testGPUUUID returns the UUID of the GPU with the specified index in the mocked NVML library.
+func testGPUUUID(i int) string {
+	return fmt.Sprintf("GPU-%08x-cfa2-0990-bf4a-5da9abb51763", i)
+}
+
+// newMockNVML returns a mocked NVML library with a (non-MIG) GPU for each of the specified names.
+// The GPU at index i has the UUID GPU-i and 16GiB of memory.
+func newMockNVML(names ...string) *nvml.InterfaceMock {
+	var devices []nvml.Device
+	for i, name := range names {
+		i, name := i, name
+		devices = append(devices, &nvml.DeviceMock{
+			GetNameFunc: func() (string, nvml.Return) {
+				return name, nvml.SUCCESS
+			},
+			GetUUIDFunc: func() (string, nvml.Return) {
+				return testGPUUUID(i), nvml.SUCCESS
+			},
+			GetMinorNumberFunc: func() (int, nvml.Return) {
+				return i, nvml.SUCCESS
+			},
+			GetPciInfoFunc: func() (nvml.PciInfo, nvml.Return) {
+				return nvml.PciInfo{}, nvml.SUCCESS
+			},
+			GetMigModeFunc: func() (int, int, nvml.Return) {
+				return 0, 0, nvml.ERROR_NOT_SUPPORTED
+			},
+			GetMemoryInfoFunc: func() (nvml.Memory, nvml.Return) {
+				return nvml.Memory{Total: 16 << 30}, nvml.SUCCESS
+			},
+		})
+	}
+
+	return &nvml.InterfaceMock{
+		DeviceGetCountFunc: func() (int, nvml.Return) {
+			return len(devices), nvml.SUCCESS
+		},
+		DeviceGetHandleByIndexFunc: func(i int) (nvml.Device, nvml.Return) {
+			return devices[i], nvml.SUCCESS
+		},
+	}
+}
+
+// newTestConfig returns a config with the specified resources followed by the default resources.
+func newTestConfig(t *testing.T, resources spec.Resources, sharing spec.Sharing) *spec.Config {
+	migStrategy := spec.MigStrategyNone
+	config := &spec.Config{
+		Flags: spec.Flags{
+			CommandLineFlags: spec.CommandLineFlags{
+				MigStrategy: &migStrategy,
+			},
+		},
+		Resources: resources,
+		Sharing:   sharing,
+	}
+	require.NoError(t, AddDefaultResourcesToConfig(config))
+	return config
+}
+
+// getIDsByResource returns the (sorted) device IDs in a DeviceMap by resource name.
+func getIDsByResource(deviceMap DeviceMap) map[spec.ResourceName][]string {
+	ids := make(map[spec.ResourceName][]string)
+	for name, devices := range deviceMap {
+		for _, d := range devices {
+			ids[name] = append(ids[name], d.ID)
+		}
+		sort.Strings(ids[name])
+	}
+	return ids
+}
+
 func TestDeviceMapInsert(t *testing.T) {
 	device0 := Device{Device: pluginapi.Device{ID: "0"}}
 	device0withIndex := Device{Device: pluginapi.Device{ID: "0"}, Index: "index"}
@@ -106,3 +180,369 @@ func TestDeviceMapInsert(t *testing.T) {
 		})
 	}
 }
+
+func TestNewDeviceMapWithResources(t *testing.T) {
+	testCases := []struct {
+		description string
+		gpus        []string
+		resources   spec.Resources
+		expectedIDs map[spec.ResourceName][]string
+	}{
+		{
+			description: "default resources",
+			gpus:        []string{"NVIDIA A100-SXM4-40GB", "Tesla T4"},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/gpu": {testGPUUUID(0), testGPUUUID(1)},
+			},
+		},
+		{
+			description: "each GPU model is named separately",
+			gpus:        []string{"NVIDIA A100-SXM4-40GB", "Tesla T4", "NVIDIA A100-SXM4-40GB"},
+			resources: spec.Resources{
+				GPUs: []spec.Resource{
+					{Pattern: "*A100*", Name: "nvidia.com/a100"},
+					{Pattern: "*T4*", Name: "nvidia.com/t4"},
+				},
+			},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/a100": {testGPUUUID(0), testGPUUUID(2)},
+				"nvidia.com/t4":   {testGPUUUID(1)},
+			},
+		},
+		{
+			description: "unmatched GPUs fall back to the default resource",
+			gpus:        []string{"NVIDIA A100-SXM4-40GB", "Tesla T4"},
+			resources: spec.Resources{
+				GPUs: []spec.Resource{
+					{Pattern: "*A100*", Name: "nvidia.com/a100"},
+				},
+			},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/a100": {testGPUUUID(0)},
+				"nvidia.com/gpu":  {testGPUUUID(1)},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			config := newTestConfig(t, tc.resources, spec.Sharing{})
+
+			deviceMap, err := NewDeviceMap(newMockNVML(tc.gpus...), config)
+			require.NoError(t, err)
+			require.EqualValues(t, tc.expectedIDs, getIDsByResource(deviceMap))
+		})
+	}
+}
+
+func TestNewDeviceMapWithReplicas(t *testing.T) {
+	gpus := []string{"Tesla T4", "Tesla T4", "Tesla T4", "Tesla T4"}
+
+	testCases := []struct {
+		description   string
+		timeSlicing   spec.TimeSlicing
+		expectedIDs   map[spec.ResourceName][]string
+		expectedError bool
+	}{
+		{
+			description: "all devices replicated",
+			timeSlicing: spec.TimeSlicing{
+				Resources: []spec.ReplicatedResource{
+					{Name: "nvidia.com/gpu", Devices: spec.ReplicatedDevices{All: true}, Replicas: 2},
+				},
+			},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/gpu": {testGPUUUID(0) + "::0", testGPUUUID(0) + "::1", testGPUUUID(1) + "::0", testGPUUUID(1) + "::1", testGPUUUID(2) + "::0", testGPUUUID(2) + "::1", testGPUUUID(3) + "::0", testGPUUUID(3) + "::1"},
+			},
+		},
+		{
+			description: "devices selected by index are renamed",
+			timeSlicing: spec.TimeSlicing{
+				Resources: []spec.ReplicatedResource{
+					{
+						Name:     "nvidia.com/gpu",
+						Rename:   "nvidia.com/gpu.shared",
+						Devices:  spec.ReplicatedDevices{List: []spec.ReplicatedDeviceRef{"0", "1"}},
+						Replicas: 2,
+					},
+				},
+			},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/gpu":        {testGPUUUID(2), testGPUUUID(3)},
+				"nvidia.com/gpu.shared": {testGPUUUID(0) + "::0", testGPUUUID(0) + "::1", testGPUUUID(1) + "::0", testGPUUUID(1) + "::1"},
+			},
+		},
+		{
+			description: "devices selected by UUID are renamed",
+			timeSlicing: spec.TimeSlicing{
+				Resources: []spec.ReplicatedResource{
+					{
+						Name:     "nvidia.com/gpu",
+						Rename:   "nvidia.com/gpu.shared",
+						Devices:  spec.ReplicatedDevices{List: []spec.ReplicatedDeviceRef{spec.ReplicatedDeviceRef(testGPUUUID(1)), spec.ReplicatedDeviceRef(testGPUUUID(3))}},
+						Replicas: 2,
+					},
+				},
+			},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/gpu":        {testGPUUUID(0), testGPUUUID(2)},
+				"nvidia.com/gpu.shared": {testGPUUUID(1) + "::0", testGPUUUID(1) + "::1", testGPUUUID(3) + "::0", testGPUUUID(3) + "::1"},
+			},
+		},
+		{
+			description: "devices selected by index and UUID are renamed",
+			timeSlicing: spec.TimeSlicing{
+				Resources: []spec.ReplicatedResource{
+					{
+						Name:     "nvidia.com/gpu",
+						Rename:   "nvidia.com/gpu.shared",
+						Devices:  spec.ReplicatedDevices{List: []spec.ReplicatedDeviceRef{"0", spec.ReplicatedDeviceRef(testGPUUUID(2))}},
+						Replicas: 2,
+					},
+				},
+			},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/gpu":        {testGPUUUID(1), testGPUUUID(3)},
+				"nvidia.com/gpu.shared": {testGPUUUID(0) + "::0", testGPUUUID(0) + "::1", testGPUUUID(2) + "::0", testGPUUUID(2) + "::1"},
+			},
+		},
+		{
+			description: "count selects the devices with the lowest indices",
+			timeSlicing: spec.TimeSlicing{
+				Resources: []spec.ReplicatedResource{
+					{
+						Name:     "nvidia.com/gpu",
+						Rename:   "nvidia.com/gpu.shared",
+						Devices:  spec.ReplicatedDevices{Count: 2},
+						Replicas: 2,
+					},
+				},
+			},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/gpu":        {testGPUUUID(2), testGPUUUID(3)},
+				"nvidia.com/gpu.shared": {testGPUUUID(0) + "::0", testGPUUUID(0) + "::1", testGPUUUID(1) + "::0", testGPUUUID(1) + "::1"},
+			},
+		},
+		{
+			description: "unknown index is an error",
+			timeSlicing: spec.TimeSlicing{
+				Resources: []spec.ReplicatedResource{
+					{Name: "nvidia.com/gpu", Devices: spec.ReplicatedDevices{List: []spec.ReplicatedDeviceRef{"4"}}, Replicas: 2},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			description: "unknown UUID is an error",
+			timeSlicing: spec.TimeSlicing{
+				Resources: []spec.ReplicatedResource{
+					{Name: "nvidia.com/gpu", Devices: spec.ReplicatedDevices{List: []spec.ReplicatedDeviceRef{spec.ReplicatedDeviceRef(testGPUUUID(4))}}, Replicas: 2},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			description: "unrecognized device reference is an error",
+			timeSlicing: spec.TimeSlicing{
+				Resources: []spec.ReplicatedResource{
+					{Name: "nvidia.com/gpu", Devices: spec.ReplicatedDevices{List: []spec.ReplicatedDeviceRef{"GPU-3"}}, Replicas: 2},
+				},
+			},
+			expectedError: true,
+		},
+		{
+			description: "count larger than the number of devices is an error",
+			timeSlicing: spec.TimeSlicing{
+				Resources: []spec.ReplicatedResource{
+					{Name: "nvidia.com/gpu", Devices: spec.ReplicatedDevices{Count: 5}, Replicas: 2},
+				},
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			config := newTestConfig(t, spec.Resources{}, spec.Sharing{TimeSlicing: tc.timeSlicing})
+
+			deviceMap, err := NewDeviceMap(newMockNVML(gpus...), config)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.EqualValues(t, tc.expectedIDs, getIDsByResource(deviceMap))
+		})
+	}
+}
+
+func TestNewDeviceMapWithReplicatedMigDevices(t *testing.T) {
+	topology := &Topology{
+		GPUs: []TopologyGPU{
+			{Name: "Tesla T4", UUID: testGPUUUID(0)},
+			{Name: "NVIDIA A100-SXM4-40GB", UUID: testGPUUUID(1), MigDevices: []string{"1g.5gb", "1g.5gb", "1g.5gb"}},
+		},
+	}
+	migUUID := func(gi int) string {
+		return fmt.Sprintf("MIG-%s/%d/0", testGPUUUID(1), gi)
+	}
+
+	testCases := []struct {
+		description   string
+		devices       []spec.ReplicatedDeviceRef
+		expectedIDs   map[spec.ResourceName][]string
+		expectedError bool
+	}{
+		{
+			description: "MIG devices selected by index",
+			devices:     []spec.ReplicatedDeviceRef{"1:0", "1:2"},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/gpu":               {testGPUUUID(0)},
+				"nvidia.com/mig-1g.5gb":        {migUUID(1)},
+				"nvidia.com/mig-1g.5gb.shared": {migUUID(0) + "::0", migUUID(0) + "::1", migUUID(2) + "::0", migUUID(2) + "::1"},
+			},
+		},
+		{
+			description: "MIG devices selected by UUID",
+			devices:     []spec.ReplicatedDeviceRef{spec.ReplicatedDeviceRef(migUUID(1))},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/gpu":               {testGPUUUID(0)},
+				"nvidia.com/mig-1g.5gb":        {migUUID(0), migUUID(2)},
+				"nvidia.com/mig-1g.5gb.shared": {migUUID(1) + "::0", migUUID(1) + "::1"},
+			},
+		},
+		{
+			description: "MIG devices selected by index and UUID",
+			devices:     []spec.ReplicatedDeviceRef{"1:0", spec.ReplicatedDeviceRef(migUUID(2))},
+			expectedIDs: map[spec.ResourceName][]string{
+				"nvidia.com/gpu":               {testGPUUUID(0)},
+				"nvidia.com/mig-1g.5gb":        {migUUID(1)},
+				"nvidia.com/mig-1g.5gb.shared": {migUUID(0) + "::0", migUUID(0) + "::1", migUUID(2) + "::0", migUUID(2) + "::1"},
+			},
+		},
+		{
+			description:   "UUID of a GPU of another resource is an error",
+			devices:       []spec.ReplicatedDeviceRef{spec.ReplicatedDeviceRef(testGPUUUID(0))},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			migStrategy := spec.MigStrategyMixed
+			config := &spec.Config{
+				Flags: spec.Flags{
+					CommandLineFlags: spec.CommandLineFlags{MigStrategy: &migStrategy},
+				},
+				Sharing: spec.Sharing{
+					TimeSlicing: spec.TimeSlicing{
+						Resources: []spec.ReplicatedResource{
+							{
+								Name:     "nvidia.com/mig-1g.5gb",
+								Rename:   "nvidia.com/mig-1g.5gb.shared",
+								Devices:  spec.ReplicatedDevices{List: tc.devices},
+								Replicas: 2,
+							},
+						},
+					},
+				},
+			}
+			require.NoError(t, topology.AddDefaultResourcesToConfig(config))
+
+			deviceMap, err := NewDeviceMapFromTopology(topology, config)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.EqualValues(t, tc.expectedIDs, getIDsByResource(deviceMap))
+		})
+	}
+}
+
+func TestNewDeviceMapWithReplicasRenameConflict(t *testing.T) {
+	resources := spec.Resources{
+		GPUs: []spec.Resource{
+			{Pattern: "*A100*", Name: "nvidia.com/a100"},
+		},
+	}
+	sharing := spec.Sharing{
+		TimeSlicing: spec.TimeSlicing{
+			Resources: []spec.ReplicatedResource{
+				{Name: "nvidia.com/gpu", Rename: "nvidia.com/a100", Devices: spec.ReplicatedDevices{All: true}, Replicas: 2},
+			},
+		},
+	}
+	config := newTestConfig(t, resources, sharing)
+
+	_, err := NewDeviceMap(newMockNVML("NVIDIA A100-SXM4-40GB", "Tesla T4"), config)
+	require.Error(t, err)
+}
+
+func TestNewDeviceMapWithMemoryUnits(t *testing.T) {
+	sharing := spec.Sharing{
+		Memory: &spec.Memory{
+			Resources: []spec.MemoryResource{
+				{
+					Name:    "nvidia.com/gpu",
+					Rename:  "nvidia.com/gpumem",
+					Devices: spec.ReplicatedDevices{List: []spec.ReplicatedDeviceRef{"1"}},
+				},
+			},
+		},
+	}
+	config := newTestConfig(t, spec.Resources{}, sharing)
+
+	deviceMap, err := NewDeviceMap(newMockNVML("Tesla T4", "Tesla T4"), config)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{testGPUUUID(0)}, deviceMap["nvidia.com/gpu"].GetIDs())
+	require.Len(t, deviceMap["nvidia.com/gpumem"], 16)
+	for id, d := range deviceMap["nvidia.com/gpumem"] {
+		require.True(t, MemoryUnitID(id).IsMemoryUnit())
+		require.Equal(t, testGPUUUID(1), d.GetUUID())
+		require.Equal(t, "1", d.Index)
+	}
+}
+
+func TestDeviceMapDiff(t *testing.T) {
+	config := newTestConfig(t, spec.Resources{}, spec.Sharing{})
+	old, err := NewDeviceMap(newMockNVML("Tesla T4", "Tesla T4"), config)
+	require.NoError(t, err)
+
+	// Rebuilding the device map for the same devices and config results in no changes.
+	same, err := NewDeviceMap(newMockNVML("Tesla T4", "Tesla T4"), config)
+	require.NoError(t, err)
+	same["nvidia.com/gpu"][testGPUUUID(0)].Health = pluginapi.Unhealthy
+	added, removed, changed := old.Diff(same)
+	require.Empty(t, added)
+	require.Empty(t, removed)
+	require.Empty(t, changed)
+
+	// Time-slicing one GPU under a new name changes the devices of the
+	// existing resource and adds a new resource.
+	sharing := spec.Sharing{
+		TimeSlicing: spec.TimeSlicing{
+			Resources: []spec.ReplicatedResource{
+				{
+					Name:     "nvidia.com/gpu",
+					Rename:   "nvidia.com/gpu.shared",
+					Devices:  spec.ReplicatedDevices{List: []spec.ReplicatedDeviceRef{"1"}},
+					Replicas: 2,
+				},
+			},
+		},
+	}
+	shared, err := NewDeviceMap(newMockNVML("Tesla T4", "Tesla T4"), newTestConfig(t, spec.Resources{}, sharing))
+	require.NoError(t, err)
+	added, removed, changed = old.Diff(shared)
+	require.Equal(t, []spec.ResourceName{"nvidia.com/gpu.shared"}, added)
+	require.Empty(t, removed)
+	require.Equal(t, []spec.ResourceName{"nvidia.com/gpu"}, changed)
+
+	// Going back removes the new resource again.
+	added, removed, changed = shared.Diff(old)
+	require.Empty(t, added)
+	require.Equal(t, []spec.ResourceName{"nvidia.com/gpu.shared"}, removed)
+	require.Equal(t, []spec.ResourceName{"nvidia.com/gpu"}, changed)
+}
@@ -18,9 +18,11 @@ package rm
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
+	"k8s.io/klog/v2"
 	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
@@ -29,6 +31,21 @@ type Device struct {
 	pluginapi.Device
 	Paths []string
 	Index string
+	// TotalMemory is the total memory of the device in bytes.
+	TotalMemory uint64
+	// PCIBusID is the PCI bus ID of the device (or of the parent of a MIG device).
+	PCIBusID string
+	// RDMADevices are the names of the RDMA devices that share a PCIe switch with the device.
+	RDMADevices []string
+}
+
+// MigPlacement defines the placement of a MIG device on its parent GPU.
+// If the placement could not be determined, Error describes why.
+type MigPlacement struct {
+	Parent string `json:"parent,omitempty"`
+	GI     int    `json:"gi"`
+	CI     int    `json:"ci"`
+	Error  string `json:"error,omitempty"`
 }
 
 // deviceInfo defines the information the required to construct a Device
@@ -36,6 +53,8 @@ type deviceInfo interface {
 	GetUUID() (string, error)
 	GetPaths() ([]string, error)
 	GetNumaNode() (bool, int, error)
+	GetTotalMemory() (uint64, error)
+	GetPCIBusID() (string, error)
 }
 
 // Devices wraps a map[string]*Device with some functions.
@@ -47,6 +66,18 @@ type AnnotatedID string
 // AnnotatedIDs can be used to treat a []string as a []AnnotatedID.
 type AnnotatedIDs []string
 
+// MemoryUnitID represents the ID of a unit of the memory of a device.
+// It has the form <id>::mem-<unit> so that it is also an AnnotatedID of the device.
+type MemoryUnitID string
+
+// MemoryUnitIDs can be used to treat a []string as a []MemoryUnitID.
+type MemoryUnitIDs []string
+
+// MemoryUnitSize is the amount of device memory represented by a memory unit in bytes.
+const MemoryUnitSize = 1 << 30
+
+const memoryUnitSeparator = "::mem-"
+
 // BuildDevice builds an rm.Device with the specified index and deviceInfo
 func BuildDevice(index string, d deviceInfo) (*Device, error) {
 	uuid, err := d.GetUUID()
@@ -64,10 +95,25 @@ func BuildDevice(index string, d deviceInfo) (*Device, error) {
 		return nil, fmt.Errorf("error getting device NUMA node: %v", err)
 	}
 
+	// The memory of a device is only required when sharing it with MPS or by
+	// memory, which fail for devices with unknown memory.
+	totalMemory, err := d.GetTotalMemory()
+	if err != nil {
+		klog.Warningf("Error getting memory of device %v: %v", uuid, err)
+		totalMemory = 0
+	}
+
+	busID, err := d.GetPCIBusID()
+	if err != nil {
+		return nil, fmt.Errorf("error getting device PCI bus ID: %v", err)
+	}
+
 	dev := Device{}
 	dev.ID = uuid
 	dev.Index = index
 	dev.Paths = paths
+	dev.TotalMemory = totalMemory
+	dev.PCIBusID = busID
 	dev.Health = pluginapi.Healthy
 	if hasNuma {
 		dev.Topology = &pluginapi.TopologyInfo{
@@ -92,6 +138,39 @@ func (ds Devices) ContainsMigDevices() bool {
 	return false
 }
 
+// GetNUMANodes returns the sorted set of NUMA nodes that the devices are attached to.
+func (ds Devices) GetNUMANodes() []int {
+	seen := make(map[int]bool)
+	var nodes []int
+	for _, d := range ds {
+		node, hasNuma := d.GetNUMANode()
+		if !hasNuma || seen[node] {
+			continue
+		}
+		seen[node] = true
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+	return nodes
+}
+
+// GetRDMADevices returns the sorted set of RDMA devices that share a PCIe switch with the devices.
+func (ds Devices) GetRDMADevices() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, d := range ds {
+		for _, name := range d.RDMADevices {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Contains checks if Devices contains devices matching all ids.
 func (ds Devices) Contains(ids ...string) bool {
 	for _, id := range ids {
@@ -140,6 +219,21 @@ func (ds Devices) Difference(ods Devices) Devices {
 	return res
 }
 
+// Equal checks whether ds and ods contain the same devices.
+// The health of the devices is not taken into account.
+func (ds Devices) Equal(ods Devices) bool {
+	if len(ds) != len(ods) {
+		return false
+	}
+	for id, d := range ds {
+		od, exists := ods[id]
+		if !exists || !d.equal(od) {
+			return false
+		}
+	}
+	return true
+}
+
 // GetIDs returns the ids from all devices in the Devices
 func (ds Devices) GetIDs() []string {
 	var res []string
@@ -176,6 +270,30 @@ func (ds Devices) GetPaths() []string {
 	return res
 }
 
+// GetNUMANode returns the NUMA node that the device is attached to, if known.
+func (d Device) GetNUMANode() (int, bool) {
+	if d.Topology == nil || len(d.Topology.Nodes) == 0 {
+		return 0, false
+	}
+	return int(d.Topology.Nodes[0].ID), true
+}
+
+// equal checks whether d and o describe the same device, ignoring its health.
+func (d *Device) equal(o *Device) bool {
+	if d.ID != o.ID || d.Index != o.Index || d.TotalMemory != o.TotalMemory || d.PCIBusID != o.PCIBusID {
+		return false
+	}
+	if strings.Join(d.Paths, ",") != strings.Join(o.Paths, ",") {
+		return false
+	}
+	if strings.Join(d.RDMADevices, ",") != strings.Join(o.RDMADevices, ",") {
+		return false
+	}
+	numaNode, hasNUMANode := d.GetNUMANode()
+	oNUMANode, oHasNUMANode := o.GetNUMANode()
+	return numaNode == oNUMANode && hasNUMANode == oHasNUMANode
+}
+
 // IsMigDevice returns checks whether d is a MIG device or not.
 func (d Device) IsMigDevice() bool {
 	return strings.Contains(d.Index, ":")
@@ -234,3 +352,46 @@ func (rs AnnotatedIDs) GetIDs() []string {
 	}
 	return res
 }
+
+// CountByID returns the number of annotated IDs of each ID.
+func (rs AnnotatedIDs) CountByID() map[string]int {
+	res := make(map[string]int)
+	for _, r := range rs {
+		res[AnnotatedID(r).GetID()]++
+	}
+	return res
+}
+
+// NewMemoryUnitID creates a new MemoryUnitID from an ID and a unit number.
+func NewMemoryUnitID(id string, unit int) MemoryUnitID {
+	return MemoryUnitID(fmt.Sprintf("%s%s%d", id, memoryUnitSeparator, unit))
+}
+
+// IsMemoryUnit checks if a MemoryUnitID refers to a unit of memory or to a full device.
+func (m MemoryUnitID) IsMemoryUnit() bool {
+	return strings.Contains(string(m), memoryUnitSeparator)
+}
+
+// GetID returns just the ID of the device that the memory unit belongs to.
+func (m MemoryUnitID) GetID() string {
+	return strings.SplitN(string(m), memoryUnitSeparator, 2)[0]
+}
+
+// AnyIsMemoryUnit checks if any ID refers to a unit of memory.
+func (ms MemoryUnitIDs) AnyIsMemoryUnit() bool {
+	for _, m := range ms {
+		if MemoryUnitID(m).IsMemoryUnit() {
+			return true
+		}
+	}
+	return false
+}
+
+// CountByID returns the number of memory units of each device.
+func (ms MemoryUnitIDs) CountByID() map[string]int {
+	res := make(map[string]int)
+	for _, m := range ms {
+		res[MemoryUnitID(m).GetID()]++
+	}
+	return res
+}
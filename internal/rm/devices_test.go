@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testDeviceInfo is a deviceInfo whose memory may be unknown.
+type testDeviceInfo struct {
+	memory    uint64
+	memoryErr error
+}
+
+func (d *testDeviceInfo) GetUUID() (string, error)        { return "GPU-0", nil }
+func (d *testDeviceInfo) GetPaths() ([]string, error)     { return []string{"/dev/nvidia0"}, nil }
+func (d *testDeviceInfo) GetNumaNode() (bool, int, error) { return false, 0, nil }
+func (d *testDeviceInfo) GetPCIBusID() (string, error)    { return "0000:00:00.0", nil }
+func (d *testDeviceInfo) GetTotalMemory() (uint64, error) { return d.memory, d.memoryErr }
+
+func TestBuildDevice(t *testing.T) {
+	testCases := []struct {
+		description    string
+		info           *testDeviceInfo
+		expectedMemory uint64
+	}{
+		{
+			description:    "memory is recorded",
+			info:           &testDeviceInfo{memory: 16 << 30},
+			expectedMemory: 16 << 30,
+		},
+		{
+			description: "unknown memory is not an error",
+			info:        &testDeviceInfo{memoryErr: fmt.Errorf("not supported")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			d, err := BuildDevice("0", tc.info)
+			require.NoError(t, err)
+			require.Equal(t, "GPU-0", d.ID)
+			require.Equal(t, tc.expectedMemory, d.TotalMemory)
+		})
+	}
+}
@@ -21,9 +21,13 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/metrics"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
 	"k8s.io/klog/v2"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
 const (
@@ -38,8 +42,46 @@ const (
 	maxSuccessiveEventErrorCount = 3
 )
 
-// CheckHealth performs health checks on a set of devices, writing to the 'unhealthy' channel with any unhealthy devices
-func (r *nvmlResourceManager) checkHealth(stop <-chan interface{}, devices Devices, unhealthy chan<- *Device) error {
+// HealthEvent represents a transition in the health of a device.
+// The Reason describes the cause of the transition and Xid is set if the
+// device was marked unhealthy because of an Xid error.
+type HealthEvent struct {
+	Device *Device
+	Health string
+	Reason string
+	Xid    *uint64
+}
+
+// newUnhealthyEvent creates a HealthEvent marking the specified device as unhealthy.
+func newUnhealthyEvent(d *Device, reason string) *HealthEvent {
+	return &HealthEvent{Device: d, Health: pluginapi.Unhealthy, Reason: reason}
+}
+
+// newHealthyEvent creates a HealthEvent marking the specified device as healthy.
+func newHealthyEvent(d *Device, reason string) *HealthEvent {
+	return &HealthEvent{Device: d, Health: pluginapi.Healthy, Reason: reason}
+}
+
+// newUnhealthyEventFromEventData creates a HealthEvent marking the specified device as unhealthy because of e.
+func newUnhealthyEventFromEventData(d *Device, e nvml.EventData) *HealthEvent {
+	switch e.EventType {
+	case nvml.EventTypeXidCriticalError:
+		xid := e.EventData
+		event := newUnhealthyEvent(d, fmt.Sprintf("Xid %d", xid))
+		event.Xid = &xid
+		return event
+	case nvml.EventTypeDoubleBitEccError:
+		return newUnhealthyEvent(d, "double-bit ECC error")
+	case nvml.EventTypeSingleBitEccError:
+		return newUnhealthyEvent(d, "single-bit ECC errors")
+	}
+	return newUnhealthyEvent(d, fmt.Sprintf("event type %d", e.EventType))
+}
+
+// CheckHealth performs health checks on a set of devices, writing to the 'events' channel with any health transitions.
+// A device that has been marked unhealthy is marked healthy again once no further errors have been seen for the
+// configured recovery period and it can successfully be re-probed through NVML.
+func (r *nvmlResourceManager) checkHealth(stop <-chan interface{}, devices Devices, events chan<- *HealthEvent) error {
 	disableHealthChecks := strings.ToLower(os.Getenv(envDisableHealthChecks))
 	if disableHealthChecks == "all" {
 		disableHealthChecks = allHealthChecks
@@ -62,69 +104,40 @@ func (r *nvmlResourceManager) checkHealth(stop <-chan interface{}, devices Devic
 		}
 	}()
 
-	// FIXME: formalize the full list and document it.
-	// http://docs.nvidia.com/deploy/xid-errors/index.html#topic_4
-	// Application errors: the GPU should still be healthy
-	applicationErrorXids := []uint64{
-		13, // Graphics Engine Exception
-		31, // GPU memory page fault
-		43, // GPU stopped processing
-		45, // Preemptive cleanup, due to previous errors
-		68, // Video processor exception
-	}
-
-	skippedXids := make(map[uint64]bool)
-	for _, id := range applicationErrorXids {
-		skippedXids[id] = true
-	}
-
-	for _, additionalXid := range getAdditionalXids(disableHealthChecks) {
-		skippedXids[additionalXid] = true
-	}
-
 	eventSet, ret := r.nvml.EventSetCreate()
 	if ret != nvml.SUCCESS {
 		return fmt.Errorf("failed to create event set: %v", ret)
 	}
 	defer eventSet.Free()
 
-	parentToDeviceMap := make(map[string]*Device)
-	deviceIDToGiMap := make(map[string]int)
-	deviceIDToCiMap := make(map[string]int)
+	checker := newDeviceHealthChecker(devices, newHealthPolicy(&r.config.Health, getAdditionalXids(disableHealthChecks)))
+	tracker := newUnhealthyDeviceTracker(r.getHealthRecoveryPeriod())
+	markUnhealthy := func(event *HealthEvent) {
+		tracker.markUnhealthy(event.Device)
+		events <- event
+	}
 
-	eventMask := uint64(nvml.EventTypeXidCriticalError | nvml.EventTypeDoubleBitEccError | nvml.EventTypeSingleBitEccError)
-	for _, d := range devices {
+	registered := make(map[string]bool)
+	register := func(d *Device) error {
 		uuid, gi, ci, err := r.getDevicePlacement(d)
 		if err != nil {
-			klog.Warningf("Could not determine device placement for %v: %v; Marking it unhealthy.", d.ID, err)
-			unhealthy <- d
-			continue
-		}
-		deviceIDToGiMap[d.ID] = gi
-		deviceIDToCiMap[d.ID] = ci
-		parentToDeviceMap[uuid] = d
-
-		gpu, ret := r.nvml.DeviceGetHandleByUUID(uuid)
-		if ret != nvml.SUCCESS {
-			klog.Infof("unable to get device handle from UUID: %v; marking it as unhealthy", ret)
-			unhealthy <- d
-			continue
+			return fmt.Errorf("could not determine device placement: %v", err)
 		}
+		checker.addDevice(uuid, gi, ci, d)
 
-		supportedEvents, ret := gpu.GetSupportedEventTypes()
-		if ret != nvml.SUCCESS {
-			klog.Infof("Unable to determine the supported events for %v: %v; marking it as unhealthy", d.ID, ret)
-			unhealthy <- d
-			continue
+		err = r.registerDeviceEvents(eventSet, uuid)
+		if err != nil {
+			return err
 		}
+		registered[d.ID] = true
+		return nil
+	}
 
-		ret = gpu.RegisterEvents(eventMask&supportedEvents, eventSet)
-		if ret == nvml.ERROR_NOT_SUPPORTED {
-			klog.Warningf("Device %v is too old to support healthchecking.", d.ID)
-		}
-		if ret != nvml.SUCCESS {
-			klog.Infof("Marking device %v as unhealthy: %v", d.ID, ret)
-			unhealthy <- d
+	for _, d := range devices {
+		err := register(d)
+		if err != nil {
+			klog.Infof("Marking device %v as unhealthy: %v", d.ID, err)
+			markUnhealthy(newUnhealthyEvent(d, err.Error()))
 		}
 	}
 
@@ -135,6 +148,23 @@ func (r *nvmlResourceManager) checkHealth(stop <-chan interface{}, devices Devic
 		default:
 		}
 
+		for _, d := range tracker.getRecoveryCandidates() {
+			var err error
+			if registered[d.ID] {
+				err = r.probeDevice(d)
+			} else {
+				err = register(d)
+			}
+			if err != nil {
+				klog.Infof("Device %v is still unhealthy: %v", d.ID, err)
+				tracker.markUnhealthy(d)
+				continue
+			}
+			klog.Infof("No errors seen on device %v for %v; marking device as healthy.", d.ID, tracker.recoveryPeriod)
+			tracker.markHealthy(d)
+			events <- newHealthyEvent(d, fmt.Sprintf("no errors seen for %v", tracker.recoveryPeriod))
+		}
+
 		e, ret := eventSet.Wait(5000)
 		if ret == nvml.ERROR_TIMEOUT {
 			continue
@@ -142,50 +172,214 @@ func (r *nvmlResourceManager) checkHealth(stop <-chan interface{}, devices Devic
 		if ret != nvml.SUCCESS {
 			klog.Infof("Error waiting for event: %v; Marking all devices as unhealthy", ret)
 			for _, d := range devices {
-				unhealthy <- d
+				markUnhealthy(newUnhealthyEvent(d, fmt.Sprintf("error waiting for event: %v", ret)))
 			}
 			continue
 		}
 
-		if e.EventType != nvml.EventTypeXidCriticalError {
-			klog.Infof("Skipping non-nvmlEventTypeXidCriticalError event: %+v", e)
-			continue
+		if e.EventType == nvml.EventTypeXidCriticalError {
+			metrics.XidEvents.WithLabelValues(string(r.resource), strconv.FormatUint(e.EventData, 10)).Inc()
 		}
 
-		if skippedXids[e.EventData] {
-			klog.Infof("Skipping event %+v", e)
-			continue
+		for _, d := range checker.processEvent(e) {
+			markUnhealthy(newUnhealthyEventFromEventData(d, e))
 		}
+	}
+}
 
-		klog.Infof("Processing event %+v", e)
-		eventUUID, ret := e.Device.GetUUID()
-		if ret != nvml.SUCCESS {
-			// If we cannot reliably determine the device UUID, we mark all devices as unhealthy.
-			klog.Infof("Failed to determine uuid for event %v: %v; Marking all devices as unhealthy.", e, ret)
-			for _, d := range devices {
-				unhealthy <- d
-			}
-			continue
-		}
+// deviceHealthChecker maps the events returned by NVML to the devices that should be marked unhealthy.
+type deviceHealthChecker struct {
+	devices         Devices
+	policy          *healthPolicy
+	parentToDevices map[string]Devices
+	deviceIDToGiMap map[string]int
+	deviceIDToCiMap map[string]int
+}
 
-		d, exists := parentToDeviceMap[eventUUID]
-		if !exists {
-			klog.Infof("Ignoring event for unexpected device: %v", eventUUID)
-			continue
+// newDeviceHealthChecker creates a deviceHealthChecker for the specified devices and policy.
+func newDeviceHealthChecker(devices Devices, policy *healthPolicy) *deviceHealthChecker {
+	return &deviceHealthChecker{
+		devices:         devices,
+		policy:          policy,
+		parentToDevices: make(map[string]Devices),
+		deviceIDToGiMap: make(map[string]int),
+		deviceIDToCiMap: make(map[string]int),
+	}
+}
+
+// addDevice records the placement of a device so that events for its parent can be mapped back to it.
+func (c *deviceHealthChecker) addDevice(parentUUID string, gi int, ci int, d *Device) {
+	if c.parentToDevices[parentUUID] == nil {
+		c.parentToDevices[parentUUID] = make(Devices)
+	}
+	c.parentToDevices[parentUUID][d.ID] = d
+	c.deviceIDToGiMap[d.ID] = gi
+	c.deviceIDToCiMap[d.ID] = ci
+}
+
+// processEvent applies the health policy to an event and returns the devices that should be marked unhealthy.
+func (c *deviceHealthChecker) processEvent(e nvml.EventData) []*Device {
+	var policy *spec.HealthPolicy
+	var key string
+	switch e.EventType {
+	case nvml.EventTypeXidCriticalError:
+		policy = c.policy.forXid(e.EventData)
+		key = fmt.Sprintf("xid-%d", e.EventData)
+	case nvml.EventTypeDoubleBitEccError:
+		policy = c.policy.doubleBit
+		key = "ecc-double-bit"
+	case nvml.EventTypeSingleBitEccError:
+		policy = c.policy.singleBit
+		key = "ecc-single-bit"
+	}
+
+	if policy == nil {
+		klog.Infof("Skipping event %+v", e)
+		return nil
+	}
+
+	klog.Infof("Processing event %+v", e)
+	eventUUID, ret := e.Device.GetUUID()
+	if ret != nvml.SUCCESS {
+		// If we cannot reliably determine the device UUID, we mark all devices as unhealthy.
+		klog.Infof("Failed to determine uuid for event %v: %v; Marking all devices as unhealthy.", e, ret)
+		var all []*Device
+		for _, d := range c.devices {
+			all = append(all, d)
 		}
+		return all
+	}
+
+	devices, exists := c.parentToDevices[eventUUID]
+	if !exists {
+		klog.Infof("Ignoring event for unexpected device: %v", eventUUID)
+		return nil
+	}
 
+	var unhealthy []*Device
+	for _, d := range devices {
 		if d.IsMigDevice() && e.GpuInstanceId != 0xFFFFFFFF && e.ComputeInstanceId != 0xFFFFFFFF {
-			gi := deviceIDToGiMap[d.ID]
-			ci := deviceIDToCiMap[d.ID]
+			gi := c.deviceIDToGiMap[d.ID]
+			ci := c.deviceIDToCiMap[d.ID]
 			if !(uint32(gi) == e.GpuInstanceId && uint32(ci) == e.ComputeInstanceId) {
 				continue
 			}
 			klog.Infof("Event for mig device %v (gi=%v, ci=%v)", d.ID, gi, ci)
 		}
 
-		klog.Infof("XidCriticalError: Xid=%d on Device=%s; marking device as unhealthy.", e.EventData, d.ID)
-		unhealthy <- d
+		if !c.policy.shouldMarkUnhealthy(policy, d, key) {
+			klog.Infof("Event %v on Device=%s does not require action (action=%v)", key, d.ID, policy.Action)
+			continue
+		}
+
+		if e.EventType == nvml.EventTypeXidCriticalError {
+			klog.Infof("XidCriticalError: Xid=%d on Device=%s; marking device as unhealthy.", e.EventData, d.ID)
+		} else {
+			klog.Infof("Event %v on Device=%s; marking device as unhealthy.", key, d.ID)
+		}
+		unhealthy = append(unhealthy, d)
+	}
+
+	return unhealthy
+}
+
+// registerDeviceEvents registers the device with the specified UUID for the health events of interest.
+func (r *nvmlResourceManager) registerDeviceEvents(eventSet nvml.EventSet, uuid string) error {
+	eventMask := uint64(nvml.EventTypeXidCriticalError | nvml.EventTypeDoubleBitEccError | nvml.EventTypeSingleBitEccError)
+
+	gpu, ret := r.nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("unable to get device handle from UUID: %v", ret)
+	}
+
+	supportedEvents, ret := gpu.GetSupportedEventTypes()
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("unable to determine the supported events: %v", ret)
+	}
+
+	ret = gpu.RegisterEvents(eventMask&supportedEvents, eventSet)
+	if ret == nvml.ERROR_NOT_SUPPORTED {
+		klog.Warningf("Device %v is too old to support healthchecking.", uuid)
+	}
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("unable to register events: %v", ret)
+	}
+	return nil
+}
+
+// probeDevice checks whether a device can be accessed through NVML.
+func (r *nvmlResourceManager) probeDevice(d *Device) error {
+	uuid, _, _, err := r.getDevicePlacement(d)
+	if err != nil {
+		return fmt.Errorf("could not determine device placement: %v", err)
+	}
+
+	gpu, ret := r.nvml.DeviceGetHandleByUUID(uuid)
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("unable to get device handle from UUID: %v", ret)
+	}
+
+	_, ret = gpu.GetUUID()
+	if ret != nvml.SUCCESS {
+		return fmt.Errorf("unable to query device: %v", ret)
+	}
+	return nil
+}
+
+// getHealthRecoveryPeriod returns the period after which an unhealthy device is considered for recovery.
+// A period of 0 disables recovery.
+func (r *nvmlResourceManager) getHealthRecoveryPeriod() time.Duration {
+	if r.config.Flags.Plugin == nil || r.config.Flags.Plugin.HealthRecoveryPeriod == nil {
+		return 0
+	}
+	return time.Duration(*r.config.Flags.Plugin.HealthRecoveryPeriod)
+}
+
+// unhealthyDeviceTracker keeps track of when devices were last marked unhealthy.
+type unhealthyDeviceTracker struct {
+	recoveryPeriod time.Duration
+	lastUnhealthy  map[string]time.Time
+	devices        map[string]*Device
+	now            func() time.Time
+}
+
+// newUnhealthyDeviceTracker creates a tracker with the specified recovery period.
+func newUnhealthyDeviceTracker(recoveryPeriod time.Duration) *unhealthyDeviceTracker {
+	return &unhealthyDeviceTracker{
+		recoveryPeriod: recoveryPeriod,
+		lastUnhealthy:  make(map[string]time.Time),
+		devices:        make(map[string]*Device),
+		now:            time.Now,
+	}
+}
+
+// markUnhealthy records that the device was marked unhealthy at the current time.
+func (t *unhealthyDeviceTracker) markUnhealthy(d *Device) {
+	t.lastUnhealthy[d.ID] = t.now()
+	t.devices[d.ID] = d
+}
+
+// markHealthy removes the device from the set of tracked devices.
+func (t *unhealthyDeviceTracker) markHealthy(d *Device) {
+	delete(t.lastUnhealthy, d.ID)
+	delete(t.devices, d.ID)
+}
+
+// getRecoveryCandidates returns the devices that have not been marked unhealthy for at least the recovery period.
+// No devices are returned if recovery is disabled.
+func (t *unhealthyDeviceTracker) getRecoveryCandidates() []*Device {
+	if t.recoveryPeriod <= 0 {
+		return nil
+	}
+
+	var candidates []*Device
+	for id, last := range t.lastUnhealthy {
+		if t.now().Sub(last) < t.recoveryPeriod {
+			continue
+		}
+		candidates = append(candidates, t.devices[id])
 	}
+	return candidates
 }
 
 // getAdditionalXids returns a list of additional Xids to skip from the specified string.
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rm
+
+import (
+	"fmt"
+	"time"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+)
+
+// FIXME: formalize the full list and document it.
+// http://docs.nvidia.com/deploy/xid-errors/index.html#topic_4
+// Application errors: the GPU should still be healthy
+var defaultIgnoredXids = []uint64{
+	13, // Graphics Engine Exception
+	31, // GPU memory page fault
+	43, // GPU stopped processing
+	45, // Preemptive cleanup, due to previous errors
+	68, // Video processor exception
+}
+
+const (
+	// defaultSingleBitEccThreshold and defaultSingleBitEccWindow define the default rate of
+	// single-bit ECC errors above which a device is marked unhealthy.
+	defaultSingleBitEccThreshold = 100
+	defaultSingleBitEccWindow    = spec.Duration(time.Hour)
+)
+
+var markUnhealthyPolicy = &spec.HealthPolicy{Action: spec.HealthActionMarkUnhealthy}
+
+// newDefaultSingleBitEccPolicy returns the policy applied to single-bit ECC errors if none is configured.
+func newDefaultSingleBitEccPolicy() *spec.HealthPolicy {
+	window := defaultSingleBitEccWindow
+	return &spec.HealthPolicy{
+		Action:    spec.HealthActionCountThreshold,
+		Threshold: defaultSingleBitEccThreshold,
+		Window:    &window,
+	}
+}
+
+// healthPolicy determines whether the health events seen on devices should cause them to be marked unhealthy.
+type healthPolicy struct {
+	ignoredXids map[uint64]bool
+	fatalXids   map[uint64]bool
+	xids        map[uint64]*spec.HealthPolicy
+	singleBit   *spec.HealthPolicy
+	doubleBit   *spec.HealthPolicy
+
+	counts map[string][]time.Time
+	now    func() time.Time
+}
+
+// newHealthPolicy constructs a healthPolicy from the health section of the config.
+// The additionalIgnoredXids are ignored in addition to the Xids ignored by the config.
+func newHealthPolicy(config *spec.Health, additionalIgnoredXids []uint64) *healthPolicy {
+	p := &healthPolicy{
+		ignoredXids: make(map[uint64]bool),
+		fatalXids:   make(map[uint64]bool),
+		xids:        make(map[uint64]*spec.HealthPolicy),
+		singleBit:   newDefaultSingleBitEccPolicy(),
+		doubleBit:   markUnhealthyPolicy,
+		counts:      make(map[string][]time.Time),
+		now:         time.Now,
+	}
+
+	ignoredXids := defaultIgnoredXids
+	if config.IgnoredXids != nil {
+		ignoredXids = config.IgnoredXids
+	}
+	for _, xid := range ignoredXids {
+		p.ignoredXids[xid] = true
+	}
+	for _, xid := range additionalIgnoredXids {
+		p.ignoredXids[xid] = true
+	}
+
+	for _, xid := range config.FatalXids {
+		p.fatalXids[xid] = true
+	}
+
+	for i := range config.Xids {
+		for _, xid := range config.Xids[i].Xids {
+			p.xids[xid] = &config.Xids[i].HealthPolicy
+		}
+	}
+
+	if config.ECC.SingleBit != nil {
+		p.singleBit = config.ECC.SingleBit
+	}
+	if config.ECC.DoubleBit != nil {
+		p.doubleBit = config.ECC.DoubleBit
+	}
+
+	return p
+}
+
+// forXid returns the HealthPolicy to apply to the specified Xid.
+// Fatal Xids take precedence over Xid-specific policies, which in turn take
+// precedence over ignored Xids. Any other Xid marks the device as unhealthy.
+// A nil policy is returned if the Xid should be ignored.
+func (p *healthPolicy) forXid(xid uint64) *spec.HealthPolicy {
+	if p.fatalXids[xid] {
+		return markUnhealthyPolicy
+	}
+	if policy, exists := p.xids[xid]; exists {
+		return policy
+	}
+	if p.ignoredXids[xid] {
+		return nil
+	}
+	return markUnhealthyPolicy
+}
+
+// shouldMarkUnhealthy applies the specified policy to an event identified by key on the specified device.
+func (p *healthPolicy) shouldMarkUnhealthy(policy *spec.HealthPolicy, d *Device, key string) bool {
+	switch policy.Action {
+	case spec.HealthActionMarkUnhealthy:
+		return true
+	case spec.HealthActionCountThreshold:
+		return p.count(policy, fmt.Sprintf("%s/%s", d.ID, key)) >= policy.Threshold
+	}
+	return false
+}
+
+// count records an event for the specified key and returns the number of
+// events for that key that fall within the window of the policy.
+func (p *healthPolicy) count(policy *spec.HealthPolicy, key string) int {
+	now := p.now()
+
+	var events []time.Time
+	for _, t := range p.counts[key] {
+		if policy.Window != nil && *policy.Window > 0 && now.Sub(t) > time.Duration(*policy.Window) {
+			continue
+		}
+		events = append(events, t)
+	}
+	events = append(events, now)
+	p.counts[key] = events
+
+	return len(events)
+}
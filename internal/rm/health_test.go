@@ -19,8 +19,12 @@ package rm
 import (
 	"fmt"
 	"testing"
+	"time"
 
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
 	"github.com/stretchr/testify/require"
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
+	pluginapi "k8s.io/kubelet/pkg/apis/deviceplugin/v1beta1"
 )
 
 func TestGetAdditionalXids(t *testing.T) {
@@ -72,3 +76,271 @@ func TestGetAdditionalXids(t *testing.T) {
 		})
 	}
 }
+
+func TestUnhealthyDeviceTrackerRecoveryCandidates(t *testing.T) {
+	device0 := &Device{Device: pluginapi.Device{ID: "0"}}
+	device1 := &Device{Device: pluginapi.Device{ID: "1"}}
+
+	start := time.Now()
+
+	testCases := []struct {
+		description    string
+		recoveryPeriod time.Duration
+		elapsed        time.Duration
+		unhealthy      []*Device
+		healthy        []*Device
+		expected       []*Device
+	}{
+		{
+			description:    "recovery disabled returns no candidates",
+			recoveryPeriod: 0,
+			elapsed:        time.Hour,
+			unhealthy:      []*Device{device0},
+		},
+		{
+			description:    "device within recovery period is not a candidate",
+			recoveryPeriod: time.Minute,
+			elapsed:        30 * time.Second,
+			unhealthy:      []*Device{device0},
+		},
+		{
+			description:    "device past recovery period is a candidate",
+			recoveryPeriod: time.Minute,
+			elapsed:        time.Minute,
+			unhealthy:      []*Device{device0},
+			expected:       []*Device{device0},
+		},
+		{
+			description:    "healthy device is not a candidate",
+			recoveryPeriod: time.Minute,
+			elapsed:        time.Hour,
+			unhealthy:      []*Device{device0, device1},
+			healthy:        []*Device{device1},
+			expected:       []*Device{device0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			tracker := newUnhealthyDeviceTracker(tc.recoveryPeriod)
+			tracker.now = func() time.Time { return start }
+			for _, d := range tc.unhealthy {
+				tracker.markUnhealthy(d)
+			}
+			for _, d := range tc.healthy {
+				tracker.markHealthy(d)
+			}
+
+			tracker.now = func() time.Time { return start.Add(tc.elapsed) }
+			require.ElementsMatch(t, tc.expected, tracker.getRecoveryCandidates())
+		})
+	}
+}
+
+func TestHealthPolicyForXid(t *testing.T) {
+	testCases := []struct {
+		description string
+		config      spec.Health
+		additional  []uint64
+		xid         uint64
+		expected    *spec.HealthPolicy
+	}{
+		{
+			description: "default ignored xid is skipped",
+			xid:         13,
+		},
+		{
+			description: "unknown xid marks device unhealthy",
+			xid:         79,
+			expected:    markUnhealthyPolicy,
+		},
+		{
+			description: "additional xid is skipped",
+			additional:  []uint64{79},
+			xid:         79,
+		},
+		{
+			description: "configured ignored xids replace defaults",
+			config:      spec.Health{IgnoredXids: []uint64{48}},
+			xid:         13,
+			expected:    markUnhealthyPolicy,
+		},
+		{
+			description: "fatal xid takes precedence over ignored xid",
+			config:      spec.Health{FatalXids: []uint64{13}},
+			xid:         13,
+			expected:    markUnhealthyPolicy,
+		},
+		{
+			description: "xid policy takes precedence over ignored xid",
+			config: spec.Health{
+				Xids: []spec.XidPolicy{
+					{Xids: []uint64{13}, HealthPolicy: spec.HealthPolicy{Action: spec.HealthActionLogOnly}},
+				},
+			},
+			xid:      13,
+			expected: &spec.HealthPolicy{Action: spec.HealthActionLogOnly},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			policy := newHealthPolicy(&tc.config, tc.additional)
+			require.Equal(t, tc.expected, policy.forXid(tc.xid))
+		})
+	}
+}
+
+func TestHealthPolicyCountThreshold(t *testing.T) {
+	device := &Device{Device: pluginapi.Device{ID: "0"}}
+	window := spec.Duration(time.Minute)
+	countPolicy := &spec.HealthPolicy{
+		Action:    spec.HealthActionCountThreshold,
+		Threshold: 3,
+		Window:    &window,
+	}
+
+	start := time.Now()
+	policy := newHealthPolicy(&spec.Health{}, nil)
+
+	offsets := []time.Duration{0, 10 * time.Second, 2 * time.Minute, 2*time.Minute + 10*time.Second, 2*time.Minute + 20*time.Second}
+	expected := []bool{false, false, false, false, true}
+	for i, offset := range offsets {
+		policy.now = func() time.Time { return start.Add(offset) }
+		require.Equal(t, expected[i], policy.shouldMarkUnhealthy(countPolicy, device, "xid-63"), "event %d", i)
+	}
+}
+
+func TestDeviceHealthCheckerProcessEvent(t *testing.T) {
+	gpu0 := &Device{Device: pluginapi.Device{ID: "GPU-0"}, Index: "0"}
+	gpu1 := &Device{Device: pluginapi.Device{ID: "GPU-1"}, Index: "1"}
+	mig10 := &Device{Device: pluginapi.Device{ID: "MIG-10"}, Index: "1:0"}
+	mig11 := &Device{Device: pluginapi.Device{ID: "MIG-11"}, Index: "1:1"}
+
+	newEvent := func(uuid string, eventType uint64, data uint64, gi uint32, ci uint32) nvml.EventData {
+		return nvml.EventData{
+			Device: &nvml.DeviceMock{
+				GetUUIDFunc: func() (string, nvml.Return) {
+					if uuid == "" {
+						return "", nvml.ERROR_UNKNOWN
+					}
+					return uuid, nvml.SUCCESS
+				},
+			},
+			EventType:         eventType,
+			EventData:         data,
+			GpuInstanceId:     gi,
+			ComputeInstanceId: ci,
+		}
+	}
+
+	singleBitPolicy := &spec.HealthPolicy{
+		Action:    spec.HealthActionCountThreshold,
+		Threshold: 2,
+	}
+
+	testCases := []struct {
+		description string
+		devices     []*Device
+		events      []nvml.EventData
+		expected    []*Device
+	}{
+		{
+			description: "critical xid marks device unhealthy",
+			devices:     []*Device{gpu0},
+			events:      []nvml.EventData{newEvent("GPU-0", nvml.EventTypeXidCriticalError, 79, 0xFFFFFFFF, 0xFFFFFFFF)},
+			expected:    []*Device{gpu0},
+		},
+		{
+			description: "ignored xid is skipped",
+			devices:     []*Device{gpu0},
+			events:      []nvml.EventData{newEvent("GPU-0", nvml.EventTypeXidCriticalError, 13, 0xFFFFFFFF, 0xFFFFFFFF)},
+		},
+		{
+			description: "double bit ecc error marks device unhealthy",
+			devices:     []*Device{gpu0, gpu1},
+			events:      []nvml.EventData{newEvent("GPU-1", nvml.EventTypeDoubleBitEccError, 0, 0xFFFFFFFF, 0xFFFFFFFF)},
+			expected:    []*Device{gpu1},
+		},
+		{
+			description: "single bit ecc error below threshold is ignored",
+			devices:     []*Device{gpu0},
+			events:      []nvml.EventData{newEvent("GPU-0", nvml.EventTypeSingleBitEccError, 0, 0xFFFFFFFF, 0xFFFFFFFF)},
+		},
+		{
+			description: "single bit ecc errors reaching threshold mark device unhealthy",
+			devices:     []*Device{gpu0, gpu1},
+			events: []nvml.EventData{
+				newEvent("GPU-0", nvml.EventTypeSingleBitEccError, 0, 0xFFFFFFFF, 0xFFFFFFFF),
+				newEvent("GPU-1", nvml.EventTypeSingleBitEccError, 0, 0xFFFFFFFF, 0xFFFFFFFF),
+				newEvent("GPU-0", nvml.EventTypeSingleBitEccError, 0, 0xFFFFFFFF, 0xFFFFFFFF),
+			},
+			expected: []*Device{gpu0},
+		},
+		{
+			description: "ecc error on mig device only marks matching mig device unhealthy",
+			devices:     []*Device{mig10, mig11},
+			events:      []nvml.EventData{newEvent("GPU-1", nvml.EventTypeDoubleBitEccError, 0, 1, 0)},
+			expected:    []*Device{mig11},
+		},
+		{
+			description: "single bit ecc errors are counted per mig device",
+			devices:     []*Device{mig10, mig11},
+			events: []nvml.EventData{
+				newEvent("GPU-1", nvml.EventTypeSingleBitEccError, 0, 0, 0),
+				newEvent("GPU-1", nvml.EventTypeSingleBitEccError, 0, 1, 0),
+				newEvent("GPU-1", nvml.EventTypeSingleBitEccError, 0, 1, 0),
+			},
+			expected: []*Device{mig11},
+		},
+		{
+			description: "event without instance ids marks all mig devices unhealthy",
+			devices:     []*Device{mig10, mig11},
+			events:      []nvml.EventData{newEvent("GPU-1", nvml.EventTypeDoubleBitEccError, 0, 0xFFFFFFFF, 0xFFFFFFFF)},
+			expected:    []*Device{mig10, mig11},
+		},
+		{
+			description: "event for unknown device is ignored",
+			devices:     []*Device{gpu0},
+			events:      []nvml.EventData{newEvent("GPU-1", nvml.EventTypeDoubleBitEccError, 0, 0xFFFFFFFF, 0xFFFFFFFF)},
+		},
+		{
+			description: "event with unknown uuid marks all devices unhealthy",
+			devices:     []*Device{gpu0, gpu1},
+			events:      []nvml.EventData{newEvent("", nvml.EventTypeXidCriticalError, 79, 0xFFFFFFFF, 0xFFFFFFFF)},
+			expected:    []*Device{gpu0, gpu1},
+		},
+	}
+
+	placements := map[string]struct {
+		parent string
+		gi, ci int
+	}{
+		"GPU-0":  {"GPU-0", 0xFFFFFFFF, 0xFFFFFFFF},
+		"GPU-1":  {"GPU-1", 0xFFFFFFFF, 0xFFFFFFFF},
+		"MIG-10": {"GPU-1", 0, 0},
+		"MIG-11": {"GPU-1", 1, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			devices := make(Devices)
+			for _, d := range tc.devices {
+				devices[d.ID] = d
+			}
+
+			policy := newHealthPolicy(&spec.Health{ECC: spec.ECCPolicy{SingleBit: singleBitPolicy}}, nil)
+			checker := newDeviceHealthChecker(devices, policy)
+			for _, d := range tc.devices {
+				p := placements[d.ID]
+				checker.addDevice(p.parent, p.gi, p.ci, d)
+			}
+
+			var unhealthy []*Device
+			for _, e := range tc.events {
+				unhealthy = append(unhealthy, checker.processEvent(e)...)
+			}
+			require.ElementsMatch(t, tc.expected, unhealthy)
+		})
+	}
+}
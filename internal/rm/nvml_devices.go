@@ -44,11 +44,11 @@ type nvmlMigDevice nvmlDevice
 var _ deviceInfo = (*nvmlDevice)(nil)
 var _ deviceInfo = (*nvmlMigDevice)(nil)
 
-func newGPUDevice(i int, gpu nvml.Device) (string, nvmlDevice) {
+func newGPUDevice(i int, gpu nvml.Device) (string, deviceInfo) {
 	return fmt.Sprintf("%v", i), nvmlDevice{gpu}
 }
 
-func newMigDevice(i int, j int, mig nvml.Device) (string, nvmlMigDevice) {
+func newMigDevice(i int, j int, mig nvml.Device) (string, deviceInfo) {
 	return fmt.Sprintf("%v:%v", i, j), nvmlMigDevice{mig}
 }
 
@@ -125,14 +125,11 @@ func (d nvmlMigDevice) GetPaths() ([]string, error) {
 
 // GetNumaNode returns the NUMA node associated with the GPU device
 func (d nvmlDevice) GetNumaNode() (bool, int, error) {
-	info, ret := d.GetPciInfo()
-	if ret != nvml.SUCCESS {
-		return false, 0, fmt.Errorf("error getting PCI Bus Info of device: %v", ret)
+	busID, err := d.GetPCIBusID()
+	if err != nil {
+		return false, 0, err
 	}
 
-	// Discard leading zeros.
-	busID := strings.ToLower(strings.TrimPrefix(int8Slice(info.BusId[:]).String(), "0000"))
-
 	b, err := os.ReadFile(fmt.Sprintf("/sys/bus/pci/devices/%s/numa_node", busID))
 	if err != nil {
 		return false, 0, nil
@@ -159,3 +156,38 @@ func (d nvmlMigDevice) GetNumaNode() (bool, int, error) {
 
 	return nvmlDevice{parent}.GetNumaNode()
 }
+
+// GetPCIBusID returns the PCI bus ID of the GPU device as used in sysfs
+func (d nvmlDevice) GetPCIBusID() (string, error) {
+	info, ret := d.GetPciInfo()
+	if ret != nvml.SUCCESS {
+		return "", fmt.Errorf("error getting PCI Bus Info of device: %v", ret)
+	}
+
+	// Discard leading zeros.
+	return strings.ToLower(strings.TrimPrefix(int8Slice(info.BusId[:]).String(), "0000")), nil
+}
+
+// GetPCIBusID for a MIG device is the PCI bus ID of the parent device.
+func (d nvmlMigDevice) GetPCIBusID() (string, error) {
+	parent, ret := d.GetDeviceHandleFromMigDeviceHandle()
+	if ret != nvml.SUCCESS {
+		return "", fmt.Errorf("error getting parent GPU device from MIG device: %v", ret)
+	}
+
+	return nvmlDevice{parent}.GetPCIBusID()
+}
+
+// GetTotalMemory returns the total memory of the GPU device in bytes
+func (d nvmlDevice) GetTotalMemory() (uint64, error) {
+	info, ret := d.GetMemoryInfo()
+	if ret != nvml.SUCCESS {
+		return 0, fmt.Errorf("error getting memory info: %v", ret)
+	}
+	return info.Total, nil
+}
+
+// GetTotalMemory returns the total memory of the MIG device in bytes
+func (d nvmlMigDevice) GetTotalMemory() (uint64, error) {
+	return nvmlDevice(d).GetTotalMemory()
+}
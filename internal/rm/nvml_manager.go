@@ -20,19 +20,23 @@ import (
 	"fmt"
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
+	"github.com/NVIDIA/k8s-device-plugin/internal/rdma"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
 	"k8s.io/klog/v2"
 )
 
 type nvmlResourceManager struct {
 	resourceManager
-	nvml nvml.Interface
+	nvml          nvml.Interface
+	migPlacements map[string]MigPlacement
 }
 
 var _ ResourceManager = (*nvmlResourceManager)(nil)
 
 // NewNVMLResourceManagers returns a set of ResourceManagers, one for each NVML resource in 'config'.
-func NewNVMLResourceManagers(nvmllib nvml.Interface, config *spec.Config) ([]ResourceManager, error) {
+// If podResources is non-nil, it is used to balance allocations across devices.
+func NewNVMLResourceManagers(nvmllib nvml.Interface, config *spec.Config, podResources podresources.Interface) ([]ResourceManager, error) {
 	ret := nvmllib.Init()
 	if ret != nvml.SUCCESS {
 		return nil, fmt.Errorf("failed to initialize NVML: %v", ret)
@@ -49,6 +53,14 @@ func NewNVMLResourceManagers(nvmllib nvml.Interface, config *spec.Config) ([]Res
 		return nil, fmt.Errorf("error building device map: %v", err)
 	}
 
+	if config.Flags.MOFEDEnabled != nil && *config.Flags.MOFEDEnabled {
+		topology, err := rdma.New()
+		if err != nil {
+			return nil, fmt.Errorf("error discovering RDMA devices: %v", err)
+		}
+		deviceMap.setRDMADevices(topology)
+	}
+
 	var rms []ResourceManager
 	for resourceName, devices := range deviceMap {
 		if len(devices) == 0 {
@@ -56,12 +68,14 @@ func NewNVMLResourceManagers(nvmllib nvml.Interface, config *spec.Config) ([]Res
 		}
 		r := &nvmlResourceManager{
 			resourceManager: resourceManager{
-				config:   config,
-				resource: resourceName,
-				devices:  devices,
+				config:       config,
+				resource:     resourceName,
+				devices:      devices,
+				podResources: podResources,
 			},
 			nvml: nvmllib,
 		}
+		r.migPlacements = r.getMigPlacements()
 		rms = append(rms, r)
 	}
 
@@ -90,7 +104,33 @@ func (r *nvmlResourceManager) GetDevicePaths(ids []string) []string {
 	return paths
 }
 
-// CheckHealth performs health checks on a set of devices, writing to the 'unhealthy' channel with any unhealthy devices
-func (r *nvmlResourceManager) CheckHealth(stop <-chan interface{}, unhealthy chan<- *Device) error {
-	return r.checkHealth(stop, r.devices, unhealthy)
+// GetMigPlacements returns the placement of each MIG device on its parent GPU, keyed by device ID.
+// Replicas of a MIG device share the placement of the device.
+func (r *nvmlResourceManager) GetMigPlacements() map[string]MigPlacement {
+	return r.migPlacements
+}
+
+// getMigPlacements determines the placement of each MIG device on its parent GPU.
+// This is done once when the resource manager is created, while NVML is initialized.
+// The placement of a device that cannot be determined holds the error instead.
+func (r *nvmlResourceManager) getMigPlacements() map[string]MigPlacement {
+	placements := make(map[string]MigPlacement)
+	for id, d := range r.devices {
+		if !d.IsMigDevice() {
+			continue
+		}
+		parent, gi, ci, err := r.getDevicePlacement(d)
+		if err != nil {
+			klog.Warningf("Could not determine placement of device %v: %v", id, err)
+			placements[id] = MigPlacement{Error: err.Error()}
+			continue
+		}
+		placements[id] = MigPlacement{Parent: parent, GI: gi, CI: ci}
+	}
+	return placements
+}
+
+// CheckHealth performs health checks on a set of devices, writing to the 'events' channel with any health transitions
+func (r *nvmlResourceManager) CheckHealth(stop <-chan interface{}, events chan<- *HealthEvent) error {
+	return r.checkHealth(stop, r.devices, events)
 }
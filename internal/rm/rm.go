@@ -21,6 +21,7 @@ import (
 	"strings"
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvlib/device"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvlib/info"
 	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
@@ -32,6 +33,9 @@ type resourceManager struct {
 	config   *spec.Config
 	resource spec.ResourceName
 	devices  Devices
+	// podResources provides the devices allocated by the kubelet. If nil,
+	// all devices that are not available are assumed to be allocated.
+	podResources podresources.Interface
 }
 
 // ResourceManager provides an interface for listing a set of Devices and checking health on them
@@ -39,12 +43,14 @@ type ResourceManager interface {
 	Resource() spec.ResourceName
 	Devices() Devices
 	GetDevicePaths([]string) []string
+	GetMigPlacements() map[string]MigPlacement
 	GetPreferredAllocation(available, required []string, size int) ([]string, error)
-	CheckHealth(stop <-chan interface{}, unhealthy chan<- *Device) error
+	CheckHealth(stop <-chan interface{}, events chan<- *HealthEvent) error
 }
 
 // NewResourceManagers returns a []ResourceManager, one for each resource in 'config'.
-func NewResourceManagers(nvmllib nvml.Interface, config *spec.Config) ([]ResourceManager, error) {
+// If podResources is non-nil, it is used to balance allocations across devices.
+func NewResourceManagers(nvmllib nvml.Interface, config *spec.Config, podResources podresources.Interface) ([]ResourceManager, error) {
 	// logWithReason logs the output of the has* / is* checks from the info.Interface
 	logWithReason := func(f func() (bool, string), tag string) bool {
 		is, reason := f()
@@ -81,7 +87,7 @@ func NewResourceManagers(nvmllib nvml.Interface, config *spec.Config) ([]Resourc
 	var resourceManagers []ResourceManager
 
 	if hasNVML {
-		nvmlManagers, err := NewNVMLResourceManagers(nvmllib, config)
+		nvmlManagers, err := NewNVMLResourceManagers(nvmllib, config, podResources)
 		if err != nil {
 			return nil, fmt.Errorf("failed to construct NVML resource managers: %v", err)
 		}
@@ -89,7 +95,7 @@ func NewResourceManagers(nvmllib nvml.Interface, config *spec.Config) ([]Resourc
 	}
 
 	if isTegra {
-		tegraManagers, err := NewTegraResourceManagers(config)
+		tegraManagers, err := NewTegraResourceManagers(config, podResources)
 		if err != nil {
 			return nil, fmt.Errorf("failed to construct Tegra resource managers: %v", err)
 		}
@@ -111,44 +117,59 @@ func (r *resourceManager) Devices() Devices {
 
 // AddDefaultResourcesToConfig adds default resource matching rules to config.Resources
 func AddDefaultResourcesToConfig(config *spec.Config) error {
+	return addDefaultResourcesToConfig(config, visitNodeMigProfiles)
+}
+
+// addDefaultResourcesToConfig adds default resource matching rules to config.Resources.
+// With the mixed MIG strategy, a rule is added for each MIG profile visited by visitMigProfiles.
+func addDefaultResourcesToConfig(config *spec.Config, visitMigProfiles func(*spec.Config, func(device.MigProfile) error) error) error {
 	config.Resources.AddGPUResource("*", "gpu")
 	switch *config.Flags.MigStrategy {
 	case spec.MigStrategySingle:
 		return config.Resources.AddMIGResource("*", "gpu")
 	case spec.MigStrategyMixed:
-		hasNVML, reason := info.New().HasNvml()
-		if !hasNVML {
-			klog.Warningf("mig-strategy=%q is only supported with NVML", spec.MigStrategyMixed)
-			klog.Warningf("NVML not detected: %v", reason)
-			return nil
-		}
-
-		nvmllib := nvml.New()
-		ret := nvmllib.Init()
-		if ret != nvml.SUCCESS {
-			if *config.Flags.FailOnInitError {
-				return fmt.Errorf("failed to initialize NVML: %v", ret)
-			}
-			return nil
-		}
-		defer func() {
-			ret := nvmllib.Shutdown()
-			if ret != nvml.SUCCESS {
-				klog.Errorf("Error shutting down NVML: %v", ret)
-			}
-		}()
-
-		devicelib := device.New(
-			device.WithNvml(nvmllib),
-		)
-		return devicelib.VisitMigProfiles(func(p device.MigProfile) error {
+		return visitMigProfiles(config, func(p device.MigProfile) error {
 			info := p.GetInfo()
 			if info.C != info.G {
 				return nil
 			}
-			resourceName := strings.ReplaceAll("mig-"+p.String(), "+", ".")
-			return config.Resources.AddMIGResource(p.String(), resourceName)
+			return config.Resources.AddMIGResource(p.String(), defaultMigResourceName(p.String()))
 		})
 	}
 	return nil
 }
+
+// visitNodeMigProfiles visits the MIG profiles supported by the GPUs on the node.
+func visitNodeMigProfiles(config *spec.Config, visit func(device.MigProfile) error) error {
+	hasNVML, reason := info.New().HasNvml()
+	if !hasNVML {
+		klog.Warningf("mig-strategy=%q is only supported with NVML", spec.MigStrategyMixed)
+		klog.Warningf("NVML not detected: %v", reason)
+		return nil
+	}
+
+	nvmllib := nvml.New()
+	ret := nvmllib.Init()
+	if ret != nvml.SUCCESS {
+		if *config.Flags.FailOnInitError {
+			return fmt.Errorf("failed to initialize NVML: %v", ret)
+		}
+		return nil
+	}
+	defer func() {
+		ret := nvmllib.Shutdown()
+		if ret != nvml.SUCCESS {
+			klog.Errorf("Error shutting down NVML: %v", ret)
+		}
+	}()
+
+	devicelib := device.New(
+		device.WithNvml(nvmllib),
+	)
+	return devicelib.VisitMigProfiles(visit)
+}
+
+// defaultMigResourceName returns the name of the default resource for a MIG profile with the mixed strategy.
+func defaultMigResourceName(profile string) string {
+	return strings.ReplaceAll("mig-"+profile, "+", ".")
+}
@@ -67,3 +67,13 @@ func (d *tegraDevice) GetPaths() ([]string, error) {
 func (d *tegraDevice) GetNumaNode() (bool, int, error) {
 	return false, -1, nil
 }
+
+// GetPCIBusID always returns an empty bus ID since a Tegra device is not a PCI device
+func (d *tegraDevice) GetPCIBusID() (string, error) {
+	return "", nil
+}
+
+// GetTotalMemory always returns 0 for a Tegra device since its memory is shared with the system
+func (d *tegraDevice) GetTotalMemory() (uint64, error) {
+	return 0, nil
+}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/NVIDIA/k8s-device-plugin/internal/podresources"
 )
 
 type tegraResourceManager struct {
@@ -29,7 +30,15 @@ type tegraResourceManager struct {
 var _ ResourceManager = (*tegraResourceManager)(nil)
 
 // NewTegraResourceManagers returns a set of ResourceManagers for tegra resources
-func NewTegraResourceManagers(config *spec.Config) ([]ResourceManager, error) {
+// If podResources is non-nil, it is used to balance allocations across devices.
+func NewTegraResourceManagers(config *spec.Config, podResources podresources.Interface) ([]ResourceManager, error) {
+	switch config.Sharing.SharingStrategy() {
+	case spec.SharingStrategyMPS:
+		return nil, fmt.Errorf("MPS sharing is not supported for Tegra devices")
+	case spec.SharingStrategyMemory:
+		return nil, fmt.Errorf("sharing by memory is not supported for Tegra devices")
+	}
+
 	deviceMap, err := buildTegraDeviceMap(config)
 	if err != nil {
 		return nil, fmt.Errorf("error building Tegra device map: %v", err)
@@ -37,7 +46,7 @@ func NewTegraResourceManagers(config *spec.Config) ([]ResourceManager, error) {
 
 	deviceMap, err = updateDeviceMapWithReplicas(config, deviceMap)
 	if err != nil {
-		return nil, fmt.Errorf("error updating device map with replicas from config.sharing.timeSlicing.resources: %v", err)
+		return nil, fmt.Errorf("error updating device map with replicas from config.sharing: %v", err)
 	}
 
 	var rms []ResourceManager
@@ -47,9 +56,10 @@ func NewTegraResourceManagers(config *spec.Config) ([]ResourceManager, error) {
 		}
 		r := &tegraResourceManager{
 			resourceManager: resourceManager{
-				config:   config,
-				resource: resourceName,
-				devices:  devices,
+				config:       config,
+				resource:     resourceName,
+				devices:      devices,
+				podResources: podResources,
 			},
 		}
 		if len(devices) != 0 {
@@ -70,7 +80,12 @@ func (r *tegraResourceManager) GetDevicePaths(ids []string) []string {
 	return nil
 }
 
+// GetMigPlacements returns an empty map for the tegraResourceManager
+func (r *tegraResourceManager) GetMigPlacements() map[string]MigPlacement {
+	return nil
+}
+
 // CheckHealth is disabled for the tegraResourceManager
-func (r *tegraResourceManager) CheckHealth(stop <-chan interface{}, unhealthy chan<- *Device) error {
+func (r *tegraResourceManager) CheckHealth(stop <-chan interface{}, events chan<- *HealthEvent) error {
 	return nil
 }
@@ -0,0 +1,360 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rm
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvlib/device"
+	"gitlab.com/nvidia/cloud-native/go-nvlib/pkg/nvml"
+	"sigs.k8s.io/yaml"
+)
+
+// Topology describes the GPUs and MIG devices on a node. It is used to build
+// a DeviceMap without access to the devices, e.g. to validate a config offline.
+type Topology struct {
+	GPUs []TopologyGPU `json:"gpus" yaml:"gpus"`
+}
+
+// TopologyGPU describes a GPU and the MIG devices configured on it.
+// MIG is considered enabled on the GPU if any MIG devices are listed.
+type TopologyGPU struct {
+	Name string `json:"name"               yaml:"name"`
+	UUID string `json:"uuid,omitempty"     yaml:"uuid,omitempty"`
+	// Memory is the total memory of the GPU in MiB.
+	Memory     uint64   `json:"memory,omitempty"     yaml:"memory,omitempty"`
+	NUMANode   *int     `json:"numaNode,omitempty"   yaml:"numaNode,omitempty"`
+	MigDevices []string `json:"migDevices,omitempty" yaml:"migDevices,omitempty"`
+}
+
+// topologyDevice implements the deviceInfo interface for a device described by a Topology.
+type topologyDevice struct {
+	uuid     string
+	paths    []string
+	numaNode *int
+	memory   uint64
+}
+
+var _ deviceInfo = (*topologyDevice)(nil)
+
+// ParseTopology parses a topology file as either YAML or JSON.
+func ParseTopology(path string) (*Topology, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading topology file: %v", err)
+	}
+
+	var topology Topology
+	err = yaml.UnmarshalStrict(contents, &topology)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing topology file: %v", err)
+	}
+
+	devicelib := device.New()
+	for i, gpu := range topology.GPUs {
+		if gpu.Name == "" {
+			return nil, fmt.Errorf("no name specified for GPU %d", i)
+		}
+		for _, profile := range gpu.MigDevices {
+			err := devicelib.AssertValidMigProfileFormat(profile)
+			if err != nil {
+				return nil, fmt.Errorf("invalid MIG profile %q for GPU %d: %v", profile, i, err)
+			}
+		}
+	}
+
+	return &topology, nil
+}
+
+// topologyMigGPUMemory is the memory reported for a MIG-enabled GPU of a topology.
+// The memory of a MIG profile is computed as a fraction of the memory of its GPU in
+// eighths. With 8 GiB, this yields the memory of each MIG device in the topology.
+const topologyMigGPUMemory = 8 << 30
+
+// NewDeviceMapFromTopology creates a device map for the devices in the specified topology and config.
+// The devices are exposed through a mock NVML library so that the device map is built in the same
+// way as for the devices on a node.
+func NewDeviceMapFromTopology(topology *Topology, config *spec.Config) (DeviceMap, error) {
+	devicelib, err := topology.newDeviceLib()
+	if err != nil {
+		return nil, err
+	}
+	b := deviceMapBuilder{
+		Interface: devicelib,
+		config:    config,
+		newGPUDevice: func(i int, _ nvml.Device) (string, deviceInfo) {
+			return newTopologyGPUDevice(i, topology.GPUs[i])
+		},
+		newMigDevice: func(i int, j int, _ nvml.Device) (string, deviceInfo) {
+			return newTopologyMigDevice(i, j, topology.GPUs[i], topology.GPUs[i].MigDevices[j])
+		},
+	}
+	return b.build()
+}
+
+// AddDefaultResourcesToConfig adds default resource matching rules for the devices in the topology to config.Resources.
+// With the mixed MIG strategy, rules are added for the MIG profiles supported by the GPUs in the topology.
+func (t *Topology) AddDefaultResourcesToConfig(config *spec.Config) error {
+	return addDefaultResourcesToConfig(config, func(_ *spec.Config, visit func(device.MigProfile) error) error {
+		devicelib, err := t.newDeviceLib()
+		if err != nil {
+			return err
+		}
+		return devicelib.VisitMigProfiles(visit)
+	})
+}
+
+// newDeviceLib returns a device library backed by a mock NVML library with the devices in the topology.
+func (t *Topology) newDeviceLib() (device.Interface, error) {
+	// The mock library only provides the MIG profiles, so it is used without verifying the NVML symbols.
+	devicelib := device.New(device.WithVerifySymbols(false))
+
+	var gpus []nvml.Device
+	for i, gpu := range t.GPUs {
+		d, err := newTopologyNvmlDevice(devicelib, i, gpu)
+		if err != nil {
+			return nil, fmt.Errorf("error creating GPU %d of topology: %v", i, err)
+		}
+		gpus = append(gpus, d)
+	}
+
+	nvmllib := &nvml.InterfaceMock{
+		DeviceGetCountFunc: func() (int, nvml.Return) {
+			return len(gpus), nvml.SUCCESS
+		},
+		DeviceGetHandleByIndexFunc: func(i int) (nvml.Device, nvml.Return) {
+			if i < 0 || i >= len(gpus) {
+				return nil, nvml.ERROR_INVALID_ARGUMENT
+			}
+			return gpus[i], nvml.SUCCESS
+		},
+	}
+	return device.New(device.WithNvml(nvmllib), device.WithVerifySymbols(false)), nil
+}
+
+// newTopologyNvmlDevice creates a mock NVML device for a GPU in a topology.
+// MIG is enabled on the device if MIG devices are listed for the GPU. Each of these is
+// in a separate GPU instance with a single compute instance.
+func newTopologyNvmlDevice(devicelib device.Interface, i int, gpu TopologyGPU) (nvml.Device, error) {
+	_, info := newTopologyGPUDevice(i, gpu)
+	d := &nvml.DeviceMock{
+		GetNameFunc: func() (string, nvml.Return) {
+			return gpu.Name, nvml.SUCCESS
+		},
+		GetUUIDFunc: func() (string, nvml.Return) {
+			return info.uuid, nvml.SUCCESS
+		},
+		GetMigModeFunc: func() (int, int, nvml.Return) {
+			return 0, 0, nvml.ERROR_NOT_SUPPORTED
+		},
+		GetMaxMigDeviceCountFunc: func() (int, nvml.Return) {
+			return len(gpu.MigDevices), nvml.SUCCESS
+		},
+	}
+	if len(gpu.MigDevices) == 0 {
+		return d, nil
+	}
+
+	giProfiles := make(map[int]nvml.GpuInstanceProfileInfo)
+	var gis []nvml.GpuInstance
+	var migs []nvml.Device
+	for j, profile := range gpu.MigDevices {
+		p, err := getTopologyMigProfile(devicelib, giProfiles, profile)
+		if err != nil {
+			return nil, err
+		}
+		gi, mig := newTopologyNvmlMigDevice(d, i, j, gpu, p)
+		gis = append(gis, gi)
+		migs = append(migs, mig)
+	}
+
+	d.GetMigModeFunc = func() (int, int, nvml.Return) {
+		return nvml.DEVICE_MIG_ENABLE, nvml.DEVICE_MIG_ENABLE, nvml.SUCCESS
+	}
+	d.GetMemoryInfoFunc = func() (nvml.Memory, nvml.Return) {
+		return nvml.Memory{Total: topologyMigGPUMemory}, nvml.SUCCESS
+	}
+	d.GetGpuInstanceProfileInfoFunc = func(profile int) (nvml.GpuInstanceProfileInfo, nvml.Return) {
+		info, exists := giProfiles[profile]
+		if !exists {
+			return nvml.GpuInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+		}
+		return info, nvml.SUCCESS
+	}
+	d.GetGpuInstanceByIdFunc = func(id int) (nvml.GpuInstance, nvml.Return) {
+		if id < 0 || id >= len(gis) {
+			return nil, nvml.ERROR_NOT_FOUND
+		}
+		return gis[id], nvml.SUCCESS
+	}
+	d.GetMigDeviceHandleByIndexFunc = func(j int) (nvml.Device, nvml.Return) {
+		if j < 0 || j >= len(migs) {
+			return nil, nvml.ERROR_INVALID_ARGUMENT
+		}
+		return migs[j], nvml.SUCCESS
+	}
+	return d, nil
+}
+
+// newTopologyNvmlMigDevice creates a mock NVML MIG device and its GPU instance for a MIG device in a topology.
+func newTopologyNvmlMigDevice(parent nvml.Device, i int, j int, gpu TopologyGPU, p device.MigProfileInfo) (nvml.GpuInstance, nvml.Device) {
+	_, info := newTopologyMigDevice(i, j, gpu, gpu.MigDevices[j])
+	ci := &nvml.ComputeInstanceMock{
+		GetInfoFunc: func() (nvml.ComputeInstanceInfo, nvml.Return) {
+			return nvml.ComputeInstanceInfo{ProfileId: uint32(p.CIProfileID)}, nvml.SUCCESS
+		},
+	}
+	gi := &nvml.GpuInstanceMock{
+		GetInfoFunc: func() (nvml.GpuInstanceInfo, nvml.Return) {
+			return nvml.GpuInstanceInfo{Device: parent, Id: uint32(j), ProfileId: uint32(p.GIProfileID)}, nvml.SUCCESS
+		},
+		GetComputeInstanceByIdFunc: func(id int) (nvml.ComputeInstance, nvml.Return) {
+			if id != 0 {
+				return nil, nvml.ERROR_NOT_FOUND
+			}
+			return ci, nvml.SUCCESS
+		},
+		GetComputeInstanceProfileInfoFunc: func(profile int, engProfile int) (nvml.ComputeInstanceProfileInfo, nvml.Return) {
+			if engProfile != nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_SHARED {
+				return nvml.ComputeInstanceProfileInfo{}, nvml.ERROR_NOT_SUPPORTED
+			}
+			return nvml.ComputeInstanceProfileInfo{Id: uint32(profile)}, nvml.SUCCESS
+		},
+	}
+	mig := &nvml.DeviceMock{
+		GetUUIDFunc: func() (string, nvml.Return) {
+			return info.uuid, nvml.SUCCESS
+		},
+		IsMigDeviceHandleFunc: func() (bool, nvml.Return) {
+			return true, nvml.SUCCESS
+		},
+		GetDeviceHandleFromMigDeviceHandleFunc: func() (nvml.Device, nvml.Return) {
+			return parent, nvml.SUCCESS
+		},
+		GetGpuInstanceIdFunc: func() (int, nvml.Return) {
+			return j, nvml.SUCCESS
+		},
+		GetComputeInstanceIdFunc: func() (int, nvml.Return) {
+			return 0, nvml.SUCCESS
+		},
+		GetAttributesFunc: func() (nvml.DeviceAttributes, nvml.Return) {
+			attrs := nvml.DeviceAttributes{
+				GpuInstanceSliceCount:     uint32(p.G),
+				ComputeInstanceSliceCount: uint32(p.C),
+				MemorySizeMB:              getMigProfileMemoryGB(gpu.MigDevices[j]) << 10,
+			}
+			// Media extensions provide the JPEG and OFA engines of a MIG device.
+			if len(p.Attributes) > 0 {
+				attrs.SharedJpegCount = 1
+				attrs.SharedOfaCount = 1
+			}
+			return attrs, nvml.SUCCESS
+		},
+	}
+	return gi, mig
+}
+
+// getTopologyMigProfile returns the info, including the GPU and compute instance profile IDs, of a MIG profile.
+// The GPU instance profiles already used on the GPU are passed in giProfiles, which is updated with the
+// GPU instance profile of the MIG profile. MIG profiles with the same number of slices but different memory, such
+// as 1g.5gb and 1g.10gb, use different revisions of a GPU instance profile.
+func getTopologyMigProfile(devicelib device.Interface, giProfiles map[int]nvml.GpuInstanceProfileInfo, profile string) (device.MigProfileInfo, error) {
+	memoryMB := getMigProfileMemoryGB(profile) << 10
+	for i := 0; i < nvml.GPU_INSTANCE_PROFILE_COUNT; i++ {
+		if info, exists := giProfiles[i]; exists && info.MemorySizeMB != memoryMB {
+			continue
+		}
+		for j := 0; j < nvml.COMPUTE_INSTANCE_PROFILE_COUNT; j++ {
+			p, err := devicelib.NewMigProfile(i, j, nvml.COMPUTE_INSTANCE_ENGINE_PROFILE_SHARED, memoryMB, topologyMigGPUMemory)
+			if err != nil || !p.Matches(profile) {
+				continue
+			}
+			giProfiles[i] = nvml.GpuInstanceProfileInfo{
+				Id:           uint32(i),
+				SliceCount:   uint32(p.GetInfo().G),
+				MemorySizeMB: memoryMB,
+			}
+			return p.GetInfo(), nil
+		}
+	}
+	return device.MigProfileInfo{}, fmt.Errorf("unsupported MIG profile %q", profile)
+}
+
+func newTopologyGPUDevice(i int, gpu TopologyGPU) (string, *topologyDevice) {
+	uuid := gpu.UUID
+	if uuid == "" {
+		uuid = fmt.Sprintf("GPU-%d", i)
+	}
+	return strconv.Itoa(i), &topologyDevice{
+		uuid:     uuid,
+		paths:    []string{fmt.Sprintf("/dev/nvidia%d", i)},
+		numaNode: gpu.NUMANode,
+		memory:   gpu.Memory << 20,
+	}
+}
+
+// newTopologyMigDevice returns the index and info of a MIG device in a topology. The UUID of the MIG device
+// has the form MIG-<GPU UUID>/<GPU instance ID>/<compute instance ID> used by older drivers.
+func newTopologyMigDevice(i int, j int, gpu TopologyGPU, profile string) (string, *topologyDevice) {
+	_, parent := newTopologyGPUDevice(i, gpu)
+	return fmt.Sprintf("%d:%d", i, j), &topologyDevice{
+		uuid:     fmt.Sprintf("MIG-%s/%d/0", parent.uuid, j),
+		paths:    []string{fmt.Sprintf("/dev/nvidia%d", i)},
+		numaNode: gpu.NUMANode,
+		memory:   getMigProfileMemoryGB(profile) << 30,
+	}
+}
+
+// getMigProfileMemoryGB returns the memory in GB of a MIG profile such as '1g.5gb' or '1c.2g.10gb+me'.
+func getMigProfileMemoryGB(profile string) uint64 {
+	profile = strings.SplitN(profile, "+", 2)[0]
+	fields := strings.Split(profile, ".")
+	gb, _ := strconv.ParseUint(strings.TrimSuffix(fields[len(fields)-1], "gb"), 10, 64)
+	return gb
+}
+
+// GetUUID returns the UUID of the device
+func (d *topologyDevice) GetUUID() (string, error) {
+	return d.uuid, nil
+}
+
+// GetPaths returns the paths of the device
+func (d *topologyDevice) GetPaths() ([]string, error) {
+	return d.paths, nil
+}
+
+// GetNumaNode returns the NUMA node of the device, if specified
+func (d *topologyDevice) GetNumaNode() (bool, int, error) {
+	if d.numaNode == nil {
+		return false, 0, nil
+	}
+	return true, *d.numaNode, nil
+}
+
+// GetTotalMemory returns the total memory of the device in bytes
+func (d *topologyDevice) GetTotalMemory() (uint64, error) {
+	return d.memory, nil
+}
+
+// GetPCIBusID returns an empty PCI bus ID, since it is not part of the topology
+func (d *topologyDevice) GetPCIBusID() (string, error) {
+	return "", nil
+}
@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2023, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	spec "github.com/NVIDIA/k8s-device-plugin/api/config/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTopology(t *testing.T) {
+	numaNode := 1
+	testCases := []struct {
+		description      string
+		contents         string
+		expectedError    bool
+		expectedTopology *Topology
+	}{
+		{
+			description: "GPUs and MIG devices",
+			contents: `
+gpus:
+- name: NVIDIA A100-SXM4-40GB
+  memory: 40960
+  migDevices: ["1g.5gb", "3g.20gb"]
+- name: Tesla T4
+  numaNode: 1
+`,
+			expectedTopology: &Topology{
+				GPUs: []TopologyGPU{
+					{Name: "NVIDIA A100-SXM4-40GB", Memory: 40960, MigDevices: []string{"1g.5gb", "3g.20gb"}},
+					{Name: "Tesla T4", NUMANode: &numaNode},
+				},
+			},
+		},
+		{
+			description:   "missing name",
+			contents:      "gpus:\n- memory: 16384\n",
+			expectedError: true,
+		},
+		{
+			description:   "invalid MIG profile",
+			contents:      "gpus:\n- name: NVIDIA A100-SXM4-40GB\n  migDevices: [\"1g\"]\n",
+			expectedError: true,
+		},
+		{
+			description:   "unknown field",
+			contents:      "gpus:\n- name: Tesla T4\n  memoryMiB: 16384\n",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "topology.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(tc.contents), 0644))
+
+			topology, err := ParseTopology(path)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedTopology, topology)
+		})
+	}
+}
+
+func TestNewDeviceMapFromTopology(t *testing.T) {
+	topology := &Topology{
+		GPUs: []TopologyGPU{
+			{Name: "NVIDIA A100-SXM4-40GB", Memory: 40960, MigDevices: []string{"1g.5gb", "1g.5gb", "3g.20gb"}},
+			{Name: "Tesla T4", Memory: 16384},
+		},
+	}
+
+	testCases := []struct {
+		description     string
+		migStrategy     string
+		sharing         spec.Sharing
+		expectedError   bool
+		expectedDevices map[spec.ResourceName]int
+	}{
+		{
+			description:     "none strategy exposes MIG-enabled GPUs as GPUs",
+			migStrategy:     spec.MigStrategyNone,
+			expectedDevices: map[spec.ResourceName]int{"nvidia.com/gpu": 2},
+		},
+		{
+			description: "mixed strategy",
+			migStrategy: spec.MigStrategyMixed,
+			expectedDevices: map[spec.ResourceName]int{
+				"nvidia.com/gpu":         1,
+				"nvidia.com/mig-1g.5gb":  2,
+				"nvidia.com/mig-3g.20gb": 1,
+			},
+		},
+		{
+			description:   "single strategy with different MIG devices",
+			migStrategy:   spec.MigStrategySingle,
+			expectedError: true,
+		},
+		{
+			description: "mixed strategy with replicas",
+			migStrategy: spec.MigStrategyMixed,
+			sharing: spec.Sharing{
+				TimeSlicing: spec.TimeSlicing{
+					Resources: []spec.ReplicatedResource{
+						{Name: "nvidia.com/mig-1g.5gb", Devices: spec.ReplicatedDevices{All: true}, Replicas: 3},
+					},
+				},
+			},
+			expectedDevices: map[spec.ResourceName]int{
+				"nvidia.com/gpu":         1,
+				"nvidia.com/mig-1g.5gb":  6,
+				"nvidia.com/mig-3g.20gb": 1,
+			},
+		},
+		{
+			description: "replicas of a missing device",
+			migStrategy: spec.MigStrategyNone,
+			sharing: spec.Sharing{
+				TimeSlicing: spec.TimeSlicing{
+					Resources: []spec.ReplicatedResource{
+						{Name: "nvidia.com/gpu", Devices: spec.ReplicatedDevices{List: []spec.ReplicatedDeviceRef{"2"}}, Replicas: 2},
+					},
+				},
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			config := &spec.Config{
+				Flags: spec.Flags{
+					CommandLineFlags: spec.CommandLineFlags{MigStrategy: &tc.migStrategy},
+				},
+				Sharing: tc.sharing,
+			}
+			require.NoError(t, topology.AddDefaultResourcesToConfig(config))
+
+			deviceMap, err := NewDeviceMapFromTopology(topology, config)
+			if tc.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			devices := make(map[spec.ResourceName]int)
+			for name, d := range deviceMap {
+				devices[name] = len(d)
+			}
+			require.Equal(t, tc.expectedDevices, devices)
+		})
+	}
+}
+
+func TestTopologyAddDefaultResourcesToConfig(t *testing.T) {
+	topology := &Topology{
+		GPUs: []TopologyGPU{
+			{Name: "NVIDIA A100-SXM4-40GB", MigDevices: []string{"1g.5gb", "1c.3g.20gb"}},
+			{Name: "NVIDIA A100-SXM4-80GB", MigDevices: []string{"1g.10gb", "1g.10gb+me"}},
+			{Name: "Tesla T4"},
+		},
+	}
+
+	migStrategy := spec.MigStrategyMixed
+	config := &spec.Config{
+		Flags: spec.Flags{
+			CommandLineFlags: spec.CommandLineFlags{MigStrategy: &migStrategy},
+		},
+	}
+	require.NoError(t, topology.AddDefaultResourcesToConfig(config))
+
+	var profiles []string
+	for _, resource := range config.Resources.MIGs {
+		profiles = append(profiles, string(resource.Pattern))
+	}
+	require.ElementsMatch(t, []string{"1g.5gb", "3g.20gb", "1g.10gb", "1g.10gb+me"}, profiles)
+
+	deviceMap, err := NewDeviceMapFromTopology(topology, config)
+	require.NoError(t, err)
+
+	devices := make(map[spec.ResourceName]int)
+	for name, d := range deviceMap {
+		devices[name] = len(d)
+	}
+	// Resource patterns match part of a MIG profile as on a node, so that the
+	// 1c.3g.20gb and 1g.10gb+me devices match the 3g.20gb and 1g.10gb resources.
+	expected := map[spec.ResourceName]int{
+		"nvidia.com/gpu":         1,
+		"nvidia.com/mig-1g.5gb":  1,
+		"nvidia.com/mig-3g.20gb": 1,
+		"nvidia.com/mig-1g.10gb": 2,
+	}
+	require.Equal(t, expected, devices)
+}
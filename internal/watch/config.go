@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2022, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package watch
+
+import (
+	"sync"
+)
+
+// SyncableConfig is used to synchronize on changes to a configuration value
+// That is, callers of Get() will block until a call to Set() is made.
+// Multiple calls to Set() do not queue, meaning that only calls to Get() made
+// *before* a call to Set() will be notified.
+type SyncableConfig struct {
+	cond     *sync.Cond
+	mutex    sync.Mutex
+	current  string
+	lastRead string
+}
+
+// NewSyncableConfig creates a new SyncableConfig
+func NewSyncableConfig() *SyncableConfig {
+	var m SyncableConfig
+	m.cond = sync.NewCond(&m.mutex)
+	return &m
+}
+
+// Set sets the value of the config.
+// All callers of Get() before the Set() will be unblocked.
+func (m *SyncableConfig) Set(value string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.current = value
+	m.cond.Broadcast()
+}
+
+// Get gets the value of the config.
+// A call to Get() will block until a subsequent Set() call is made.
+func (m *SyncableConfig) Get() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.lastRead == m.current {
+		m.cond.Wait()
+	}
+	m.lastRead = m.current
+	return m.lastRead
+}
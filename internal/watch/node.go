@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2022, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package watch
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// ResourceNodes represents the name the K8s resource 'nodes'
+	ResourceNodes = "nodes"
+)
+
+// NodeLabel continuously syncs the value of a label on the specified node into config.
+// The returned channel must be closed to stop watching the node.
+func NodeLabel(clientset kubernetes.Interface, nodeName string, label string, config *SyncableConfig) chan struct{} {
+	listWatch := cache.NewListWatchFromClient(
+		clientset.CoreV1().RESTClient(),
+		ResourceNodes,
+		v1.NamespaceAll,
+		fields.OneTermEqualSelector("metadata.name", nodeName),
+	)
+
+	_, controller := cache.NewInformer(
+		listWatch, &v1.Node{}, 0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				config.Set(obj.(*v1.Node).Labels[label])
+			},
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				oldLabel := oldObj.(*v1.Node).Labels[label]
+				newLabel := newObj.(*v1.Node).Labels[label]
+				if oldLabel != newLabel {
+					config.Set(newLabel)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				oldLabel := obj.(*v1.Node).Labels[label]
+				if oldLabel != "" {
+					config.Set("")
+				}
+			},
+		},
+	)
+
+	stop := make(chan struct{})
+	go controller.Run(stop)
+	return stop
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2022, NVIDIA CORPORATION.  All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package watch
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/prometheus/procfs"
+)
+
+// SignalProcess sends a signal to the process with the specified name.
+func SignalProcess(name string, signal syscall.Signal) error {
+	pid, err := findPidToSignal(name)
+	if err != nil {
+		return fmt.Errorf("error finding pid: %v", err)
+	}
+	err = syscall.Kill(pid, signal)
+	if err != nil {
+		return fmt.Errorf("error sending signal: %v", err)
+	}
+	return nil
+}
+
+func findPidToSignal(name string) (int, error) {
+	procs, err := procfs.AllProcs()
+	if err != nil {
+		return -1, fmt.Errorf("error getting list of all procs: %v", err)
+	}
+	for _, p := range procs {
+		cmdline, err := p.CmdLine()
+		if err != nil {
+			return -1, fmt.Errorf("error getting cmdline: %v", err)
+		}
+		if len(cmdline) > 0 && cmdline[0] == name {
+			return p.PID, nil
+		}
+	}
+	return -1, fmt.Errorf("no process found")
+}